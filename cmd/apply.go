@@ -0,0 +1,214 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"prism/internal/model"
+	"prism/internal/service/manifest"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Deploy the releases of a manifest",
+	Long: fmt.Sprintf(
+		"%s\n%s",
+		"Deploy the releases listed in the manifest file to the clusters,",
+		"taking into account the dependencies between releases.",
+	),
+	Run: apply,
+}
+
+func apply(cmd *cobra.Command, args []string) {
+	command := readManifestCommand(cmd)
+
+	waitTime, err := cmd.Flags().GetInt("wait-time")
+	if err != nil {
+		fmt.Printf("failed to read flag \"wait-time\", %s\n", err)
+		os.Exit(1)
+	}
+
+	createNamespace, err := cmd.Flags().GetBool("create-namespace")
+	if err != nil {
+		fmt.Printf("failed to read flag \"create-namespace\", %s\n", err)
+		os.Exit(1)
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		fmt.Printf("failed to read flag \"dry-run\", %s\n", err)
+		os.Exit(1)
+	}
+
+	skipUnchanged, err := cmd.Flags().GetBool("skip-unchanged")
+	if err != nil {
+		fmt.Printf("failed to read flag \"skip-unchanged\", %s\n", err)
+		os.Exit(1)
+	}
+
+	var printMutex sync.Mutex
+
+	run := func(release model.ManifestRelease) model.ReleaseResult {
+		result := model.ReleaseResult{Status: manifest.StatusFailed}
+
+		configStructure, namespace, err := command.render(release)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+
+		var outputConfig []string
+
+		for _, job := range configStructure {
+			output, err := services.Output.OutputConfig(job.Config, job.Declarations...)
+			if err != nil {
+				result.Error = err
+				return result
+			}
+
+			outputConfig = append(outputConfig, output)
+			result.Jobs = append(result.Jobs, job.Config.Label)
+		}
+
+		// Dry run.
+		if dryRun {
+			var outputs []string
+
+			for _, job := range configStructure {
+				output, err := services.Output.OutputConfig(
+					outputJob(job, command.showSecrets),
+					outputDeclarations(job, command.showSecrets)...,
+				)
+				if err != nil {
+					result.Error = err
+					return result
+				}
+
+				outputs = append(outputs, transformerChain(job)+fileVariablesPolicy(job, namespace)+output)
+			}
+
+			printMutex.Lock()
+			fmt.Printf("Release \"%s\" config:\n\n", release.Name)
+
+			for _, output := range outputs {
+				fmt.Printf("%v\n\n", output)
+			}
+
+			printMutex.Unlock()
+
+			result.Status = manifest.StatusRendered
+			return result
+		}
+
+		client, err := command.client(release)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+
+		checkNamespace := model.CheckNamespace{
+			Client:          client,
+			Namespace:       namespace,
+			CreateNamespace: createNamespace,
+		}
+
+		err = services.Deployment.CheckNamespace(checkNamespace)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to check the namespace: %s", err)
+			return result
+		}
+
+		var deployed bool
+
+		for index, output := range outputConfig {
+			deployment := model.Deployment{
+				Client:       client,
+				JobName:      result.Jobs[index],
+				Config:       output,
+				Namespace:    namespace,
+				WaitTime:     waitTime,
+				Variables:    configStructure[index].Variables,
+				HCLVariables: configStructure[index].HCLVariables,
+			}
+
+			// Jobs identical to the jobs in the cluster are not registered.
+			if skipUnchanged {
+				plan, err := services.Deployment.Plan(deployment)
+				if err != nil {
+					result.Error = fmt.Errorf(
+						"failed to plan job \"%s\": %s",
+						plan.JobName,
+						outputError(err, configStructure[index], command.showSecrets),
+					)
+
+					return result
+				}
+
+				if !plan.Changed {
+					continue
+				}
+			}
+
+			jobName, err := services.Deployment.Deployment(deployment)
+			if err != nil {
+				result.Error = fmt.Errorf(
+					"failed to deploy job \"%s\": %s",
+					jobName,
+					outputError(err, configStructure[index], command.showSecrets),
+				)
+
+				return result
+			}
+
+			deployed = true
+		}
+
+		result.Status = manifest.StatusDeployed
+
+		if !deployed {
+			result.Status = manifest.StatusUnchanged
+		}
+
+		return result
+	}
+
+	results := services.Manifest.Run(command.releases, command.concurrency, false, run)
+
+	if printReport(results) {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	addManifestFlags(applyCmd)
+
+	applyCmd.Flags().IntP("wait-time", "w", 300, "deployment wait time in seconds")
+
+	applyCmd.Flags().Bool(
+		"create-namespace",
+		false,
+		"create a namespace in the cluster if one is not created",
+	)
+
+	applyCmd.Flags().Bool(
+		"skip-unchanged",
+		false,
+		"do not deploy the jobs that are identical to the jobs in the cluster",
+	)
+
+	applyCmd.Flags().Bool(
+		"dry-run",
+		false,
+		"print the job configurations of the releases to the console (blocking the deployment)",
+	)
+}
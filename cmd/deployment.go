@@ -9,13 +9,15 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"prism/internal/model"
+	"prism/pkg"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/nomad/api"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -42,8 +44,6 @@ func deployment(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	path = filepath.Join(path)
-
 	namespace, err := cmd.Flags().GetString("namespace")
 	if err != nil {
 		fmt.Printf("failed to read flag \"namespace\", %s\n", err)
@@ -98,7 +98,19 @@ func deployment(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	envFilePath, err := cmd.Flags().GetString("env-file")
+	skipUnchanged, err := cmd.Flags().GetBool("skip-unchanged")
+	if err != nil {
+		fmt.Printf("failed to read flag \"skip-unchanged\", %s\n", err)
+		os.Exit(1)
+	}
+
+	showSecrets, err := cmd.Flags().GetBool("show-secrets")
+	if err != nil {
+		fmt.Printf("failed to read flag \"show-secrets\", %s\n", err)
+		os.Exit(1)
+	}
+
+	envFilePaths, err := cmd.Flags().GetStringSlice("env-file")
 	if err != nil {
 		fmt.Printf("failed to read flag \"env-file\", %s\n", err)
 		os.Exit(1)
@@ -110,6 +122,84 @@ func deployment(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	ageIdentities, err := cmd.Flags().GetStringSlice("age-identity")
+	if err != nil {
+		fmt.Printf("failed to read flag \"age-identity\", %s\n", err)
+		os.Exit(1)
+	}
+
+	hclVars, err := cmd.Flags().GetStringArray("var")
+	if err != nil {
+		fmt.Printf("failed to read flag \"var\", %s\n", err)
+		os.Exit(1)
+	}
+
+	hclVarFiles, err := cmd.Flags().GetStringSlice("var-file")
+	if err != nil {
+		fmt.Printf("failed to read flag \"var-file\", %s\n", err)
+		os.Exit(1)
+	}
+
+	verify, err := cmd.Flags().GetBool("verify")
+	if err != nil {
+		fmt.Printf("failed to read flag \"verify\", %s\n", err)
+		os.Exit(1)
+	}
+
+	keyring, err := cmd.Flags().GetString("keyring")
+	if err != nil {
+		fmt.Printf("failed to read flag \"keyring\", %s\n", err)
+		os.Exit(1)
+	}
+
+	valueFiles, err := cmd.Flags().GetStringSlice("values")
+	if err != nil {
+		fmt.Printf("failed to read flag \"values\", %s\n", err)
+		os.Exit(1)
+	}
+
+	values, err := cmd.Flags().GetStringArray("set")
+	if err != nil {
+		fmt.Printf("failed to read flag \"set\", %s\n", err)
+		os.Exit(1)
+	}
+
+	stringValues, err := cmd.Flags().GetStringArray("set-string")
+	if err != nil {
+		fmt.Printf("failed to read flag \"set-string\", %s\n", err)
+		os.Exit(1)
+	}
+
+	fileValues, err := cmd.Flags().GetStringArray("set-file")
+	if err != nil {
+		fmt.Printf("failed to read flag \"set-file\", %s\n", err)
+		os.Exit(1)
+	}
+
+	patches, err := cmd.Flags().GetStringSlice("patch")
+	if err != nil {
+		fmt.Printf("failed to read flag \"patch\", %s\n", err)
+		os.Exit(1)
+	}
+
+	postRenderers, err := readPostRenderers(cmd)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	naming, err := readNaming(cmd)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	deployMeta, err := readDeployMeta(cmd)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	if path == "" {
 		fmt.Printf(
 			"%s %s %s\n",
@@ -121,6 +211,19 @@ func deployment(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	// Get the local pack directory, the pack can be
+	// specified as an archive or an OCI reference.
+	verification := model.Verification{
+		Enabled:     verify,
+		KeyringPath: keyring,
+	}
+
+	path, err = services.Deployment.PackPath(path, verification)
+	if err != nil {
+		fmt.Printf("failed to get pack: %s\n", err)
+		os.Exit(1)
+	}
+
 	// Get the project directory name.
 	dirFormat, err := regexp.Compile(`([\w+-]+)$`)
 	if err != nil {
@@ -134,13 +237,38 @@ func deployment(cmd *cobra.Command, args []string) {
 	}
 
 	// Create a configuration structure.
+	// The namespace of the release from the pack file
+	// is used if the namespace is not specified.
+	packRelease, err := services.Deployment.Release(path, release, verification)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if packRelease.Namespace != "" && !cmd.Flags().Changed("namespace") {
+		namespace = packRelease.Namespace
+	}
+
 	parameter := model.ConfigParameter{
 		ProjectDirPath: path,
 		Namespace:      namespace,
 		Release:        release,
 		Files:          file,
-		EnvFilePath:    envFilePath,
+		EnvFilePaths:   envFilePaths,
 		EnvVars:        envVars,
+		AgeIdentities:  ageIdentities,
+		HCLVars:        hclVars,
+		HCLVarFiles:    hclVarFiles,
+		Verification:   verification,
+		ValueFiles:     valueFiles,
+		Values:         values,
+		StringValues:   stringValues,
+		FileValues:     fileValues,
+		Patches:        patches,
+		PostRenderers:  postRenderers,
+		Naming:         naming,
+		DeployMeta:     deployMeta,
+		NomadConfig:    nomadConfig(address, token),
 	}
 
 	configStructure, err := services.Deployment.CreateConfigStructure(
@@ -154,30 +282,36 @@ func deployment(cmd *cobra.Command, args []string) {
 
 	var outputConfig []map[string]string
 
-	for _, config := range configStructure {
-		output, err := services.Output.OutputConfig(config)
+	for _, job := range configStructure {
+		output, err := services.Output.OutputConfig(job.Config, job.Declarations...)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 
 		sc := make(map[string]string)
-		sc[config.Label] = output
+		sc[job.Config.Label] = output
 		outputConfig = append(outputConfig, sc)
 	}
 
 	// Dry run.
 	if dryRun {
 		if outputPath != "" {
-			for _, config := range configStructure {
+			for _, job := range configStructure {
 				findProjectDir := dirFormat.FindStringSubmatch(path)
-				projectDir := fmt.Sprintf("%s_%s", findProjectDir[1], config.Label)
+				projectDir := fmt.Sprintf("%s_%s", findProjectDir[1], job.Config.Label)
 
 				jobName := strings.ReplaceAll(projectDir, "-", "_")
 				fileName := jobName
 
+				// The file has the same comments as the output,
+				// the transformers and the ACL policy of the files.
 				err := services.Output.CreateConfigFile(
-					fileName, outputPath, config,
+					fileName,
+					outputPath,
+					transformerChain(job)+fileVariablesPolicy(job, namespace),
+					outputJob(job, showSecrets),
+					outputDeclarations(job, showSecrets)...,
 				)
 
 				if err != nil {
@@ -189,10 +323,17 @@ func deployment(cmd *cobra.Command, args []string) {
 
 		fmt.Printf("Output config:\n\n")
 
-		for _, output := range outputConfig {
-			for _, v := range output {
-				fmt.Printf("%v\n\n", v)
+		for _, job := range configStructure {
+			output, err := services.Output.OutputConfig(
+				outputJob(job, showSecrets),
+				outputDeclarations(job, showSecrets)...,
+			)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
 			}
+
+			fmt.Printf("%s%s%v\n\n", transformerChain(job), fileVariablesPolicy(job, namespace), output)
 		}
 
 		return
@@ -237,16 +378,47 @@ func deployment(cmd *cobra.Command, args []string) {
 	for index, config := range outputConfig {
 		for k, v := range config {
 			deployment := model.Deployment{
-				Client:    client,
-				JobName:   k,
-				Config:    v,
-				Namespace: namespace,
-				WaitTime:  waitTime,
+				Client:       client,
+				JobName:      k,
+				Config:       v,
+				Namespace:    namespace,
+				WaitTime:     waitTime,
+				Variables:    configStructure[index].Variables,
+				HCLVariables: configStructure[index].HCLVariables,
+			}
+
+			// Jobs identical to the jobs in the cluster are not registered.
+			if skipUnchanged {
+				plan, err := services.Deployment.Plan(deployment)
+				if err != nil {
+					fmt.Printf(
+						"failed to plan job \"%s\": %s\n",
+						plan.JobName,
+						outputError(err, configStructure[index], showSecrets),
+					)
+
+					os.Exit(1)
+				}
+
+				if !plan.Changed {
+					fmt.Printf("Job \"%s\" unchanged, deployment skipped.\n", plan.JobName)
+
+					if index != len(outputConfig)-1 {
+						fmt.Println()
+					}
+
+					continue
+				}
 			}
 
 			jobName, err := services.Deployment.Deployment(deployment)
 			if err != nil {
-				fmt.Printf("failed to deploy job \"%s\": %s\n", jobName, err)
+				fmt.Printf(
+					"failed to deploy job \"%s\": %s\n",
+					jobName,
+					outputError(err, configStructure[index], showSecrets),
+				)
+
 				os.Exit(1)
 			}
 
@@ -260,11 +432,272 @@ func deployment(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Returns the post-renderers from the flags, the command is specified
+// with the arguments separated by spaces.
+func readPostRenderers(cmd *cobra.Command) ([]model.Transformer, error) {
+	var transformers []model.Transformer
+
+	commands, err := cmd.Flags().GetStringArray("post-renderer")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flag \"post-renderer\", %s", err)
+	}
+
+	timeout, err := cmd.Flags().GetDuration("post-renderer-timeout")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flag \"post-renderer-timeout\", %s", err)
+	}
+
+	for _, command := range commands {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("post-renderer command is empty")
+		}
+
+		transformers = append(transformers, model.Transformer{
+			Name:    command,
+			Command: fields[0],
+			Args:    fields[1:],
+			Timeout: timeout.String(),
+		})
+	}
+
+	return transformers, nil
+}
+
+// Adds the flags of the post-renderers to the command.
+func addPostRendererFlags(flags *pflag.FlagSet) {
+	flags.StringArray(
+		"post-renderer",
+		[]string{},
+		"command that changes the rendered job, the job is passed as JSON to stdin and read from stdout",
+	)
+
+	flags.Duration(
+		"post-renderer-timeout",
+		30*time.Second,
+		"maximum run time of each post-renderer",
+	)
+}
+
+// Returns the naming templates of the release from the flags.
+func readNaming(cmd *cobra.Command) (model.Naming, error) {
+	var naming model.Naming
+
+	for _, item := range []struct {
+		flag  string
+		value *string
+	}{
+		{flag: "job-name-template", value: &naming.Job},
+		{flag: "group-name-template", value: &naming.Group},
+		{flag: "task-name-template", value: &naming.Task},
+	} {
+		value, err := cmd.Flags().GetString(item.flag)
+		if err != nil {
+			return naming, fmt.Errorf("failed to read flag \"%s\", %s", item.flag, err)
+		}
+
+		*item.value = value
+	}
+
+	return naming, nil
+}
+
+// Adds the flags of the naming templates of the release to the command.
+func addNamingFlags(flags *pflag.FlagSet) {
+	flags.String(
+		"job-name-template",
+		"",
+		"template of the job name of the release, by default \"{{ .Job }}-{{ .Release }}\"",
+	)
+
+	flags.String(
+		"group-name-template",
+		"",
+		"template of the group names of the release, by default the names are not changed",
+	)
+
+	flags.String(
+		"task-name-template",
+		"",
+		"template of the task names of the release, by default the names are not changed",
+	)
+}
+
+// Returns the parameters of the deployment meta from the flags.
+// The fields are nil if the flag is not specified.
+func readDeployMeta(cmd *cobra.Command) (model.DeployMeta, error) {
+	deployMeta := model.DeployMeta{PrismVersion: version}
+
+	fields, err := cmd.Flags().GetStringSlice("deploy-meta")
+	if err != nil {
+		return deployMeta, fmt.Errorf("failed to read flag \"deploy-meta\", %s", err)
+	}
+
+	if cmd.Flags().Changed("deploy-meta") {
+		deployMeta.Fields = append([]string{}, fields...)
+	}
+
+	deployMeta.ForceRedeploy, err = cmd.Flags().GetBool("force-redeploy")
+	if err != nil {
+		return deployMeta, fmt.Errorf("failed to read flag \"force-redeploy\", %s", err)
+	}
+
+	return deployMeta, nil
+}
+
+// Adds the flags of the deployment meta to the command.
+func addDeployMetaFlags(flags *pflag.FlagSet) {
+	flags.StringSlice(
+		"deploy-meta",
+		[]string{},
+		"fields of the deployment added to the job meta: version, pack, git, user, timestamp, checksum, templates or none",
+	)
+
+	flags.Bool(
+		"force-redeploy",
+		false,
+		"add a unique value to the job meta to create a new version of the job",
+	)
+}
+
+// Returns the client configuration of the cluster with the address
+// and token from the flags. If they are not specified,
+// the NOMAD_ADDR and NOMAD_TOKEN environment variables are used.
+func nomadConfig(address, token string) *api.Config {
+	configAPI := api.DefaultConfig()
+
+	if address != "" {
+		configAPI.Address = address
+	}
+
+	if token != "" {
+		configAPI.SecretID = token
+	}
+
+	if TLSConfigAPI != nil {
+		configAPI.TLSConfig = TLSConfigAPI
+	}
+
+	return configAPI
+}
+
+// Returns the job configuration for the output, the values
+// of the secrets are masked unless --show-secrets is specified.
+func outputJob(job model.RenderedJob, showSecrets bool) model.TemplateBlock {
+	if showSecrets {
+		return job.Config
+	}
+
+	return pkg.MaskConfig(job.Config, job.Sensitive)
+}
+
+// Returns the variable and locals blocks of the job for the output,
+// the values of the secrets are masked unless --show-secrets is specified.
+func outputDeclarations(job model.RenderedJob, showSecrets bool) []model.TemplateBlock {
+	if showSecrets {
+		return job.Declarations
+	}
+
+	var declarations []model.TemplateBlock
+
+	for _, block := range job.Declarations {
+		declarations = append(declarations, pkg.MaskConfig(block, job.Sensitive))
+	}
+
+	return declarations
+}
+
+// Returns the error message of the job with the values of the secrets
+// masked unless --show-secrets is specified.
+func outputError(err error, job model.RenderedJob, showSecrets bool) string {
+	if showSecrets {
+		return err.Error()
+	}
+
+	return pkg.MaskSecrets(err.Error(), job.Sensitive)
+}
+
+// Adds the flag that shows the values of the secrets in the output.
+func addShowSecretsFlag(flags *pflag.FlagSet) {
+	flags.Bool(
+		"show-secrets",
+		false,
+		"show the values of the vault and nomadvar secrets in the output instead of masking them",
+	)
+}
+
+// Adds the flag with the age identities that decrypt the env files encrypted with SOPS.
+func addAgeIdentityFlag(flags *pflag.FlagSet) {
+	flags.StringSlice(
+		"age-identity",
+		[]string{},
+		"path to the age identity file to decrypt the env files encrypted with SOPS",
+	)
+}
+
+// Adds the flags with the values of the HCL2 input variables of the jobs.
+func addHCLVarFlags(flags *pflag.FlagSet) {
+	flags.StringArray(
+		"var",
+		[]string{},
+		"value of the HCL2 variable declared in the variables section of the job, name=value",
+	)
+
+	flags.StringSlice(
+		"var-file",
+		[]string{},
+		"file name or full path to the HCL2 file with the values of the variables of the job",
+	)
+}
+
+// Returns the comment with the ACL policy that allows the tasks
+// to read the files of the job from the Nomad Variables.
+func fileVariablesPolicy(job model.RenderedJob, namespace string) string {
+	if len(job.Variables) == 0 {
+		return ""
+	}
+
+	lines := []string{
+		fmt.Sprintf("Files of the template blocks are stored in the Nomad Variables %s/*.", job.VariablesPath),
+		"The tasks read them with their workload identity, which requires the ACL policy:",
+		fmt.Sprintf(
+			"  nomad acl policy apply -namespace %s -job %s prism-files-%s policy.hcl",
+			namespace,
+			job.Config.Label,
+			job.Config.Label,
+		),
+		fmt.Sprintf("  namespace %q {", namespace),
+		"    variables {",
+		fmt.Sprintf("      path %q {", job.VariablesPath+"/*"),
+		"        capabilities = [\"read\"]",
+		"      }",
+		"    }",
+		"  }",
+	}
+
+	return "# " + strings.Join(lines, "\n# ") + "\n"
+}
+
+// Returns the comment with the transformers applied to the job.
+func transformerChain(job model.RenderedJob) string {
+	if len(job.Transformers) == 0 {
+		return ""
+	}
+
+	var names []string
+
+	for _, transformer := range job.Transformers {
+		names = append(names, transformer.Name)
+	}
+
+	return fmt.Sprintf("# Transformers: %s\n", strings.Join(names, " -> "))
+}
+
 func init() {
 	rootCmd.AddCommand(deployCmd)
 
-	deployCmd.PersistentFlags().StringP("path", "p", "", "path to project directory") // required
-	deployCmd.PersistentFlags().StringP("address", "a", "", "cluster address")        // required for deployment
+	deployCmd.PersistentFlags().StringP("path", "p", "", "path to project directory, pack archive or OCI reference") // required
+	deployCmd.PersistentFlags().StringP("address", "a", "", "cluster address")                                       // required for deployment
 	deployCmd.PersistentFlags().StringP("token", "t", "", "cluster access token")
 	deployCmd.PersistentFlags().IntP("wait-time", "w", 300, "deployment wait time in seconds")
 	deployCmd.PersistentFlags().StringP("release", "r", "", "release name")
@@ -276,14 +709,28 @@ func init() {
 		"create a namespace in the cluster if one is not created",
 	)
 
-	deployCmd.PersistentFlags().String(
-		"env-file", "", "full path to the file with environment variables",
+	deployCmd.PersistentFlags().StringSlice(
+		"env-file",
+		[]string{},
+		"full path to the file with environment variables, the last file takes precedence",
 	)
 
 	deployCmd.PersistentFlags().StringToStringP(
 		"env", "e", map[string]string{}, "environment variables in the form key=value",
 	)
 
+	deployCmd.PersistentFlags().Bool(
+		"verify",
+		false,
+		"deploy only signed packs and dependencies with a valid signature",
+	)
+
+	deployCmd.PersistentFlags().String(
+		"keyring",
+		"",
+		"path to a file or directory with trusted public keys to verify pack signatures",
+	)
+
 	deployCmd.PersistentFlags().StringSliceP(
 		"file",
 		"f",
@@ -291,6 +738,49 @@ func init() {
 		"file name or full path to file to update configuration",
 	)
 
+	deployCmd.PersistentFlags().StringSlice(
+		"values",
+		[]string{},
+		"path to a values file for the configuration templates",
+	)
+
+	deployCmd.PersistentFlags().StringArray(
+		"set",
+		[]string{},
+		"value in the form key.subkey=value or job.group[name].parameter=value",
+	)
+
+	deployCmd.PersistentFlags().StringArray(
+		"set-string",
+		[]string{},
+		"string value in the form key.subkey=value or job.group[name].parameter=value",
+	)
+
+	deployCmd.PersistentFlags().StringArray(
+		"set-file",
+		[]string{},
+		"value from a file in the form key.subkey=path or job.group[name].parameter=path",
+	)
+
+	deployCmd.PersistentFlags().StringSlice(
+		"patch",
+		[]string{},
+		"file name or full path to a JSON Patch or JSON Merge Patch file",
+	)
+
+	addPostRendererFlags(deployCmd.PersistentFlags())
+	addNamingFlags(deployCmd.PersistentFlags())
+	addDeployMetaFlags(deployCmd.PersistentFlags())
+	addShowSecretsFlag(deployCmd.PersistentFlags())
+	addAgeIdentityFlag(deployCmd.PersistentFlags())
+	addHCLVarFlags(deployCmd.PersistentFlags())
+
+	deployCmd.PersistentFlags().Bool(
+		"skip-unchanged",
+		false,
+		"do not deploy the jobs that are identical to the jobs in the cluster",
+	)
+
 	deployCmd.PersistentFlags().Bool(
 		"dry-run",
 		false,
@@ -0,0 +1,97 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"prism/internal/model"
+	"prism/internal/service/manifest"
+
+	"github.com/spf13/cobra"
+)
+
+var destroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Stop the releases of a manifest",
+	Long: fmt.Sprintf(
+		"%s\n%s",
+		"Stop the jobs of the releases listed in the manifest file,",
+		"releases are stopped before the releases they need.",
+	),
+	Run: destroy,
+}
+
+func destroy(cmd *cobra.Command, args []string) {
+	command := readManifestCommand(cmd)
+
+	purge, err := cmd.Flags().GetBool("purge")
+	if err != nil {
+		fmt.Printf("failed to read flag \"purge\", %s\n", err)
+		os.Exit(1)
+	}
+
+	run := func(release model.ManifestRelease) model.ReleaseResult {
+		result := model.ReleaseResult{Status: manifest.StatusFailed}
+
+		configStructure, namespace, err := command.render(release)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+
+		client, err := command.client(release)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+
+		// The job of the pack is stopped before its dependencies.
+		for index := len(configStructure) - 1; index >= 0; index-- {
+			config := configStructure[index].Config
+
+			output, err := services.Output.OutputConfig(config, configStructure[index].Declarations...)
+			if err != nil {
+				result.Error = err
+				return result
+			}
+
+			deployment := model.Deployment{
+				Client:       client,
+				JobName:      config.Label,
+				Config:       output,
+				Namespace:    namespace,
+				HCLVariables: configStructure[index].HCLVariables,
+			}
+
+			jobName, err := services.Deployment.Destroy(deployment, purge)
+			if err != nil {
+				result.Error = fmt.Errorf("failed to stop job \"%s\": %s", jobName, err)
+				return result
+			}
+
+			result.Jobs = append(result.Jobs, jobName)
+		}
+
+		result.Status = manifest.StatusDestroyed
+		return result
+	}
+
+	results := services.Manifest.Run(command.releases, command.concurrency, true, run)
+
+	if printReport(results) {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(destroyCmd)
+
+	addManifestFlags(destroyCmd)
+
+	destroyCmd.Flags().Bool("purge", false, "remove the jobs from the cluster")
+}
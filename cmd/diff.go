@@ -0,0 +1,118 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"prism/internal/model"
+	"prism/internal/service/manifest"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the changes of the releases of a manifest",
+	Long: fmt.Sprintf(
+		"%s\n%s",
+		"Show the difference between the jobs in the clusters",
+		"and the job configurations of the releases listed in the manifest file.",
+	),
+	Run: diff,
+}
+
+func diff(cmd *cobra.Command, args []string) {
+	command := readManifestCommand(cmd)
+
+	var printMutex sync.Mutex
+
+	run := func(release model.ManifestRelease) model.ReleaseResult {
+		result := model.ReleaseResult{Status: manifest.StatusFailed}
+
+		configStructure, namespace, err := command.render(release)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+
+		client, err := command.client(release)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+
+		var plans []model.PlanResult
+
+		for _, job := range configStructure {
+			config := job.Config
+
+			output, err := services.Output.OutputConfig(config, job.Declarations...)
+			if err != nil {
+				result.Error = err
+				return result
+			}
+
+			deployment := model.Deployment{
+				Client:       client,
+				JobName:      config.Label,
+				Config:       output,
+				Namespace:    namespace,
+				HCLVariables: job.HCLVariables,
+			}
+
+			// The diff of the cluster contains the values of the secrets.
+			if !command.showSecrets {
+				deployment.Sensitive = job.Sensitive
+			}
+
+			plan, err := services.Deployment.Plan(deployment)
+			if err != nil {
+				result.Error = fmt.Errorf(
+					"failed to plan job \"%s\": %s",
+					plan.JobName,
+					outputError(err, job, command.showSecrets),
+				)
+
+				return result
+			}
+
+			plans = append(plans, plan)
+			result.Jobs = append(result.Jobs, plan.JobName)
+		}
+
+		result.Status = manifest.StatusUnchanged
+
+		printMutex.Lock()
+		defer printMutex.Unlock()
+
+		for _, plan := range plans {
+			if !plan.Changed {
+				continue
+			}
+
+			result.Status = manifest.StatusChanged
+
+			fmt.Printf("Release \"%s\":\n%s\n\n", release.Name, plan.Diff)
+		}
+
+		return result
+	}
+
+	results := services.Manifest.Run(command.releases, command.concurrency, false, run)
+
+	if printReport(results) {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	addManifestFlags(diffCmd)
+}
@@ -0,0 +1,485 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"prism/internal/model"
+	"prism/internal/service/sops"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage environment variables and env files encrypted with SOPS",
+	Long: fmt.Sprintf(
+		"%s\n%s\n%s",
+		"List and check the PRISM_ environment variables of a pack, generate an env file.",
+		"Edit, encrypt and decrypt env files (yaml, json or env) with SOPS-compatible age or PGP keys.",
+		"The decrypted content is written only to the standard output or to a temporary file in memory.",
+	),
+}
+
+var envListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the environment variables of a pack",
+	Long: fmt.Sprintf(
+		"%s\n%s",
+		"List the PRISM_ environment variables of the pack, the packs it extends and its dependencies,",
+		"with the default value, the usages and the value and source for the release and env flags.",
+	),
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		variables := readEnvVariables(cmd)
+
+		if len(variables) == 0 {
+			fmt.Println("No environment variables found.")
+			return
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAME\tDEFAULT\tVALUE\tSOURCE\tUSAGES")
+
+		for _, variable := range variables {
+			value := "<unresolved>"
+			source := "-"
+
+			if variable.Resolved {
+				value = fmt.Sprintf("%q", variable.Value)
+				source = variable.Source
+			}
+
+			fmt.Fprintf(
+				writer,
+				"%s\t%s\t%s\t%s\t%s\n",
+				variable.Name,
+				envDefaults(variable),
+				value,
+				source,
+				envUsages(variable),
+			)
+		}
+
+		writer.Flush()
+	},
+}
+
+var envCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that all environment variables of a pack are resolved",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		variables := readEnvVariables(cmd)
+
+		var unresolved []string
+
+		for _, variable := range variables {
+			if variable.Resolved {
+				continue
+			}
+
+			message := fmt.Sprintf("%s (%s)", variable.Name, envUsages(variable))
+
+			if variable.Required != "" {
+				message = fmt.Sprintf("%s: %s", message, variable.Required)
+			}
+
+			unresolved = append(unresolved, message)
+		}
+
+		if len(unresolved) > 0 {
+			fmt.Printf("environment variables not found:\n  %s\n", strings.Join(unresolved, "\n  "))
+			os.Exit(1)
+		}
+
+		fmt.Printf("All environment variables are resolved (%d).\n", len(variables))
+	},
+}
+
+var envTemplateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Generate an env file with the environment variables of a pack",
+	Long: fmt.Sprintf(
+		"%s\n%s",
+		"Print an env file with the PRISM_ environment variables of the pack.",
+		"Variables without a default value are empty, variables with a default value are commented out.",
+	),
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		variables := readEnvVariables(cmd)
+
+		for index, variable := range variables {
+			if index > 0 {
+				fmt.Println()
+			}
+
+			fmt.Printf("# %s\n", envUsages(variable))
+
+			if variable.Required != "" {
+				fmt.Printf("# Required: %s\n", variable.Required)
+			}
+
+			if len(variable.Defaults) > 0 {
+				fmt.Printf("# %s=%s\n", variable.Name, variable.Defaults[0])
+				continue
+			}
+
+			fmt.Printf("%s=\n", variable.Name)
+		}
+	},
+}
+
+var envEncryptCmd = &cobra.Command{
+	Use:   "encrypt <file>",
+	Short: "Encrypt an env file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		inPlace, err := cmd.Flags().GetBool("in-place")
+		if err != nil {
+			fmt.Printf("failed to read flag \"in-place\", %s\n", err)
+			os.Exit(1)
+		}
+
+		keys := readSopsKeys(cmd, args[0])
+
+		format, err := sops.FileFormat(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		info, err := os.Stat(args[0])
+		if err != nil {
+			fmt.Printf("failed to read file: %s\n", err)
+			os.Exit(1)
+		}
+
+		content, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Printf("failed to read file: %s\n", err)
+			os.Exit(1)
+		}
+
+		encrypted, err := services.Sops.Encrypt(content, format, keys)
+		if err != nil {
+			fmt.Printf("failed to encrypt file: %s\n", err)
+			os.Exit(1)
+		}
+
+		if !inPlace {
+			fmt.Print(string(encrypted))
+			return
+		}
+
+		err = os.WriteFile(args[0], encrypted, info.Mode().Perm())
+		if err != nil {
+			fmt.Printf("failed to write file: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("File \"%s\" successfully encrypted.\n", args[0])
+	},
+}
+
+var envDecryptCmd = &cobra.Command{
+	Use:   "decrypt <file>",
+	Short: "Decrypt an env file to the standard output",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ageIdentities, err := cmd.Flags().GetStringSlice("age-identity")
+		if err != nil {
+			fmt.Printf("failed to read flag \"age-identity\", %s\n", err)
+			os.Exit(1)
+		}
+
+		format, err := sops.FileFormat(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		content, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Printf("failed to read file: %s\n", err)
+			os.Exit(1)
+		}
+
+		decrypted, err := services.Sops.Decrypt(content, format, ageIdentities)
+		if err != nil {
+			fmt.Printf("failed to decrypt file: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Print(string(decrypted))
+	},
+}
+
+var envEditCmd = &cobra.Command{
+	Use:   "edit <file>",
+	Short: "Edit an env file in the editor",
+	Long: fmt.Sprintf(
+		"%s\n%s",
+		"Opens the decrypted env file in $VISUAL or $EDITOR and encrypts the changes.",
+		"A file that does not exist is created with the keys of the flags or of the .sops.yaml file.",
+	),
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ageIdentities, err := cmd.Flags().GetStringSlice("age-identity")
+		if err != nil {
+			fmt.Printf("failed to read flag \"age-identity\", %s\n", err)
+			os.Exit(1)
+		}
+
+		keys := readSopsKeys(cmd, args[0])
+
+		err = services.Sops.Edit(args[0], ageIdentities, keys)
+		if err != nil {
+			fmt.Printf("failed to edit file: %s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// Returns the environment variables of the pack with the values
+// of the release and the env flags.
+func readEnvVariables(cmd *cobra.Command) []model.EnvVariable {
+	path, err := cmd.Flags().GetString("path")
+	if err != nil {
+		fmt.Printf("failed to read flag \"path\", %s\n", err)
+		os.Exit(1)
+	}
+
+	release, err := cmd.Flags().GetString("release")
+	if err != nil {
+		fmt.Printf("failed to read flag \"release\", %s\n", err)
+		os.Exit(1)
+	}
+
+	file, err := cmd.Flags().GetStringSlice("file")
+	if err != nil {
+		fmt.Printf("failed to read flag \"file\", %s\n", err)
+		os.Exit(1)
+	}
+
+	envFilePaths, err := cmd.Flags().GetStringSlice("env-file")
+	if err != nil {
+		fmt.Printf("failed to read flag \"env-file\", %s\n", err)
+		os.Exit(1)
+	}
+
+	envVars, err := cmd.Flags().GetStringToString("env")
+	if err != nil {
+		fmt.Printf("failed to read flag \"env\", %s\n", err)
+		os.Exit(1)
+	}
+
+	ageIdentities, err := cmd.Flags().GetStringSlice("age-identity")
+	if err != nil {
+		fmt.Printf("failed to read flag \"age-identity\", %s\n", err)
+		os.Exit(1)
+	}
+
+	verify, err := cmd.Flags().GetBool("verify")
+	if err != nil {
+		fmt.Printf("failed to read flag \"verify\", %s\n", err)
+		os.Exit(1)
+	}
+
+	keyring, err := cmd.Flags().GetString("keyring")
+	if err != nil {
+		fmt.Printf("failed to read flag \"keyring\", %s\n", err)
+		os.Exit(1)
+	}
+
+	verification := model.Verification{
+		Enabled:     verify,
+		KeyringPath: keyring,
+	}
+
+	path, err = services.Deployment.PackPath(path, verification)
+	if err != nil {
+		fmt.Printf("failed to get pack: %s\n", err)
+		os.Exit(1)
+	}
+
+	parameter := model.ConfigParameter{
+		ProjectDirPath: path,
+		Release:        release,
+		Files:          file,
+		EnvFilePaths:   envFilePaths,
+		EnvVars:        envVars,
+		AgeIdentities:  ageIdentities,
+		Verification:   verification,
+	}
+
+	variables, err := services.Deployment.EnvVariables(parameter)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	return variables
+}
+
+// Returns the default values of the variable for the output.
+func envDefaults(variable model.EnvVariable) string {
+	if len(variable.Defaults) == 0 {
+		return "-"
+	}
+
+	var defaults []string
+
+	for _, value := range variable.Defaults {
+		defaults = append(defaults, fmt.Sprintf("%q", value))
+	}
+
+	return strings.Join(defaults, ", ")
+}
+
+// Returns the places where the variable is referenced in the form path:line.
+func envUsages(variable model.EnvVariable) string {
+	var usages []string
+
+	for _, usage := range variable.Usages {
+		usages = append(usages, fmt.Sprintf("%s:%d", usage.Path, usage.Line))
+	}
+
+	return strings.Join(usages, ", ")
+}
+
+// Adds the flags of the pack and the sources of the environment variables.
+func addEnvSourceFlags(flags *pflag.FlagSet) {
+	flags.StringP("path", "p", ".", "path to project directory, pack archive or OCI reference")
+	flags.StringP("release", "r", "", "release name")
+
+	flags.StringSliceP(
+		"file",
+		"f",
+		[]string{},
+		"file name or full path to file to update configuration",
+	)
+
+	flags.StringSlice(
+		"env-file",
+		[]string{},
+		"full path to the file with environment variables, the last file takes precedence",
+	)
+
+	flags.StringToStringP(
+		"env", "e", map[string]string{}, "environment variables in the form key=value",
+	)
+
+	flags.Bool(
+		"verify",
+		false,
+		"use only signed packs and dependencies with a valid signature",
+	)
+
+	flags.String(
+		"keyring",
+		"",
+		"path to a file or directory with trusted public keys to verify pack signatures",
+	)
+
+	addAgeIdentityFlag(flags)
+}
+
+// Returns the keys of the file from the flags. The keys of the
+// creation rules of .sops.yaml are used if no key is specified.
+func readSopsKeys(cmd *cobra.Command, path string) model.SopsKeys {
+	age, err := cmd.Flags().GetStringSlice("age")
+	if err != nil {
+		fmt.Printf("failed to read flag \"age\", %s\n", err)
+		os.Exit(1)
+	}
+
+	pgp, err := cmd.Flags().GetStringSlice("pgp")
+	if err != nil {
+		fmt.Printf("failed to read flag \"pgp\", %s\n", err)
+		os.Exit(1)
+	}
+
+	unencryptedSuffix, err := cmd.Flags().GetString("unencrypted-suffix")
+	if err != nil {
+		fmt.Printf("failed to read flag \"unencrypted-suffix\", %s\n", err)
+		os.Exit(1)
+	}
+
+	encryptedRegex, err := cmd.Flags().GetString("encrypted-regex")
+	if err != nil {
+		fmt.Printf("failed to read flag \"encrypted-regex\", %s\n", err)
+		os.Exit(1)
+	}
+
+	keys := model.SopsKeys{
+		Age:               age,
+		PGP:               pgp,
+		UnencryptedSuffix: unencryptedSuffix,
+		EncryptedRegex:    encryptedRegex,
+	}
+
+	if len(keys.Age) > 0 || len(keys.PGP) > 0 {
+		return keys
+	}
+
+	keys, err = services.Sops.CreationKeys(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if unencryptedSuffix != "" || encryptedRegex != "" {
+		keys.UnencryptedSuffix = unencryptedSuffix
+		keys.EncryptedRegex = encryptedRegex
+	}
+
+	return keys
+}
+
+// Adds the flags with the keys of the encrypted file.
+func addSopsKeyFlags(flags *pflag.FlagSet) {
+	flags.StringSlice("age", []string{}, "age recipient of the file")
+	flags.StringSlice("pgp", []string{}, "fingerprint of the PGP key of the file")
+
+	flags.String(
+		"unencrypted-suffix",
+		"",
+		"suffix of the keys that are not encrypted (default \"_unencrypted\")",
+	)
+
+	flags.String(
+		"encrypted-regex",
+		"",
+		"only the keys matching the regular expression are encrypted",
+	)
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+
+	envCmd.AddCommand(envListCmd)
+	envCmd.AddCommand(envCheckCmd)
+	envCmd.AddCommand(envTemplateCmd)
+	envCmd.AddCommand(envEncryptCmd)
+	envCmd.AddCommand(envDecryptCmd)
+	envCmd.AddCommand(envEditCmd)
+
+	addEnvSourceFlags(envListCmd.Flags())
+	addEnvSourceFlags(envCheckCmd.Flags())
+	addEnvSourceFlags(envTemplateCmd.Flags())
+	addSopsKeyFlags(envEncryptCmd.Flags())
+	addSopsKeyFlags(envEditCmd.Flags())
+	addAgeIdentityFlag(envDecryptCmd.Flags())
+	addAgeIdentityFlag(envEditCmd.Flags())
+
+	envEncryptCmd.Flags().BoolP("in-place", "i", false, "write the encrypted file in place")
+}
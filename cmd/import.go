@@ -0,0 +1,276 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <job file> | --from-cluster <job id>",
+	Short: "Create a pack from a Nomad job",
+	Long: fmt.Sprintf(
+		"%s\n%s\n%s",
+		"Create a pack from a Nomad job file in HCL or JSON format or from a job of the cluster.",
+		"The data of the template blocks is moved to the files directory of the pack.",
+		"With the cluster address, the job rendered from the pack is compared with the source job.",
+	),
+	Args: cobra.ExactArgs(1),
+	Run:  importJob,
+}
+
+func importJob(cmd *cobra.Command, args []string) {
+	fromCluster, err := cmd.Flags().GetBool("from-cluster")
+	if err != nil {
+		fmt.Printf("failed to read flag \"from-cluster\", %s\n", err)
+		os.Exit(1)
+	}
+
+	address, err := cmd.Flags().GetString("address")
+	if err != nil {
+		fmt.Printf("failed to read flag \"address\", %s\n", err)
+		os.Exit(1)
+	}
+
+	token, err := cmd.Flags().GetString("token")
+	if err != nil {
+		fmt.Printf("failed to read flag \"token\", %s\n", err)
+		os.Exit(1)
+	}
+
+	namespace, err := cmd.Flags().GetString("namespace")
+	if err != nil {
+		fmt.Printf("failed to read flag \"namespace\", %s\n", err)
+		os.Exit(1)
+	}
+
+	destination, err := cmd.Flags().GetString("destination")
+	if err != nil {
+		fmt.Printf("failed to read flag \"destination\", %s\n", err)
+		os.Exit(1)
+	}
+
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		fmt.Printf("failed to read flag \"name\", %s\n", err)
+		os.Exit(1)
+	}
+
+	noVerify, err := cmd.Flags().GetBool("no-verify")
+	if err != nil {
+		fmt.Printf("failed to read flag \"no-verify\", %s\n", err)
+		os.Exit(1)
+	}
+
+	// The HCL files and the jobs of the cluster are read with the cluster.
+	var client *api.Client
+
+	if address != "" {
+		client, err = api.NewClient(nomadConfig(address, token))
+		if err != nil {
+			fmt.Printf("error create nomad api client: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var job *api.Job
+	var source string
+
+	if fromCluster {
+		if client == nil {
+			fmt.Printf(
+				"%s %s %s\n",
+				"failed execute import command,",
+				"one of the required flags is not specified:",
+				"address",
+			)
+
+			os.Exit(1)
+		}
+
+		job, err = services.Importer.ClusterJob(args[0], namespace, client)
+		source = fmt.Sprintf("job %s of namespace %s", args[0], namespace)
+	} else {
+		job, err = services.Importer.ReadJob(args[0], client)
+		source = filepath.Base(args[0])
+	}
+
+	if err != nil {
+		fmt.Printf("failed to import job: %s\n", err)
+		os.Exit(1)
+	}
+
+	result, err := services.Importer.CreatePack(job, model.ImportParameter{
+		DirPath: destination,
+		Name:    name,
+		Source:  source,
+	})
+	if err != nil {
+		fmt.Printf("failed to create pack: %s\n", err)
+		os.Exit(1)
+	}
+
+	printImportResult(result, "job")
+
+	if noVerify {
+		return
+	}
+
+	// The import fails if the pack cannot be verified or differs from the job,
+	// so the pack is not used by mistake.
+	if client == nil {
+		fmt.Printf(
+			"\n%s %s\n",
+			"The pack is not verified, the rendered job is parsed by the cluster,",
+			"specify --address or skip the verification with --no-verify.",
+		)
+
+		os.Exit(1)
+	}
+
+	if job.Namespace != nil && *job.Namespace != "" {
+		namespace = *job.Namespace
+	}
+
+	differences, err := verifyImport(result.PackDirPath, namespace, job, client, nomadConfig(address, token))
+	if err != nil {
+		fmt.Printf("failed to verify pack: %s\n", err)
+		os.Exit(1)
+	}
+
+	if len(differences) == 0 {
+		fmt.Printf("\nThe job rendered from the pack matches the source job.\n")
+		return
+	}
+
+	fmt.Printf("\nThe job rendered from the pack differs from the source job:\n")
+
+	for _, difference := range differences {
+		fmt.Printf("  %s\n", difference)
+	}
+
+	os.Exit(1)
+}
+
+var importComposeCmd = &cobra.Command{
+	Use:   "compose <compose file>",
+	Short: "Create a pack from a docker-compose file",
+	Long: fmt.Sprintf(
+		"%s\n%s\n%s",
+		"Create a pack from a docker-compose file, each service is converted to a task of the docker driver.",
+		"The variables of the compose file are replaced with the environment variables with the PRISM_ prefix.",
+		"The parts of the compose file that cannot be converted are listed.",
+	),
+	Args: cobra.ExactArgs(1),
+	Run:  importCompose,
+}
+
+func importCompose(cmd *cobra.Command, args []string) {
+	destination, err := cmd.Flags().GetString("destination")
+	if err != nil {
+		fmt.Printf("failed to read flag \"destination\", %s\n", err)
+		os.Exit(1)
+	}
+
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		fmt.Printf("failed to read flag \"name\", %s\n", err)
+		os.Exit(1)
+	}
+
+	result, err := services.Importer.CreateComposePack(args[0], model.ImportParameter{
+		DirPath: destination,
+		Name:    name,
+		Source:  filepath.Base(args[0]),
+	})
+	if err != nil {
+		fmt.Printf("failed to create pack: %s\n", err)
+		os.Exit(1)
+	}
+
+	printImportResult(result, "compose file")
+}
+
+// Prints the directory of the created pack, the files and the warnings of the import.
+func printImportResult(result model.ImportResult, source string) {
+	fmt.Printf("Pack successfully created in \"%s\".\n", result.PackDirPath)
+
+	if len(result.Files) != 0 {
+		fmt.Printf("\nThe data of the templates is moved to the files:\n")
+
+		for _, file := range result.Files {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+
+	if len(result.Warnings) != 0 {
+		fmt.Printf("\nThe parts of the %s that are not imported:\n", source)
+
+		for _, warning := range result.Warnings {
+			fmt.Printf("  %s\n", warning)
+		}
+	}
+}
+
+// Renders the job of the imported pack without the deployment meta and
+// returns its differences with the source job. The job is parsed by the cluster.
+func verifyImport(
+	packDirPath, namespace string,
+	source *api.Job,
+	client *api.Client,
+	config *api.Config,
+) ([]string, error) {
+	configStructure, err := services.Deployment.CreateConfigStructure(model.ConfigParameter{
+		ProjectDirPath: packDirPath,
+		Namespace:      namespace,
+		DeployMeta:     model.DeployMeta{Fields: []string{"none"}},
+		NomadConfig:    config,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(configStructure) == 0 {
+		return nil, fmt.Errorf("pack %s does not contain a job", packDirPath)
+	}
+
+	job := configStructure[0]
+
+	output, err := services.Output.OutputConfig(job.Config, job.Declarations...)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := client.Jobs().ParseHCLOpts(&api.JobsParseRequest{
+		JobHCL:    output,
+		Variables: job.HCLVariables,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rendered job, %s", err)
+	}
+
+	return services.Importer.Compare(source, rendered)
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.AddCommand(importComposeCmd)
+
+	importCmd.Flags().Bool("from-cluster", false, "import the job with the ID from the cluster")
+	importCmd.Flags().StringP("address", "a", "", "cluster address, required to parse HCL and to verify the pack")
+	importCmd.Flags().StringP("token", "t", "", "cluster access token")
+	importCmd.Flags().StringP("namespace", "n", "default", "namespace of the job in the cluster")
+	importCmd.Flags().Bool("no-verify", false, "do not compare the job rendered from the pack with the source job")
+	importCmd.PersistentFlags().StringP("destination", "d", ".", "directory in which the pack will be created")
+	importCmd.PersistentFlags().String("name", "", "name of the pack, the name of the job by default")
+}
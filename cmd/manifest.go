@@ -0,0 +1,323 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"prism/internal/model"
+	"prism/internal/service/manifest"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/spf13/cobra"
+)
+
+// Manifest releases and the parameters common to the manifest commands.
+type manifestCommand struct {
+	manifest       model.Manifest
+	releases       []model.ManifestRelease
+	concurrency    int
+	verification   model.Verification
+	defaultCluster model.ManifestCluster
+	postRenderers  []model.Transformer
+	deployMeta     model.DeployMeta
+	showSecrets    bool
+	ageIdentities  []string
+	hclVars        []string
+	hclVarFiles    []string
+}
+
+// Reads the manifest and the flags common to the manifest commands.
+func readManifestCommand(cmd *cobra.Command) manifestCommand {
+	var command manifestCommand
+
+	manifestPath, err := cmd.Flags().GetString("file")
+	if err != nil {
+		fmt.Printf("failed to read flag \"file\", %s\n", err)
+		os.Exit(1)
+	}
+
+	selectors, err := cmd.Flags().GetStringSlice("selector")
+	if err != nil {
+		fmt.Printf("failed to read flag \"selector\", %s\n", err)
+		os.Exit(1)
+	}
+
+	concurrency, err := cmd.Flags().GetInt("concurrency")
+	if err != nil {
+		fmt.Printf("failed to read flag \"concurrency\", %s\n", err)
+		os.Exit(1)
+	}
+
+	address, err := cmd.Flags().GetString("address")
+	if err != nil {
+		fmt.Printf("failed to read flag \"address\", %s\n", err)
+		os.Exit(1)
+	}
+
+	token, err := cmd.Flags().GetString("token")
+	if err != nil {
+		fmt.Printf("failed to read flag \"token\", %s\n", err)
+		os.Exit(1)
+	}
+
+	verify, err := cmd.Flags().GetBool("verify")
+	if err != nil {
+		fmt.Printf("failed to read flag \"verify\", %s\n", err)
+		os.Exit(1)
+	}
+
+	keyring, err := cmd.Flags().GetString("keyring")
+	if err != nil {
+		fmt.Printf("failed to read flag \"keyring\", %s\n", err)
+		os.Exit(1)
+	}
+
+	postRenderers, err := readPostRenderers(cmd)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	deployMeta, err := readDeployMeta(cmd)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	showSecrets, err := cmd.Flags().GetBool("show-secrets")
+	if err != nil {
+		fmt.Printf("failed to read flag \"show-secrets\", %s\n", err)
+		os.Exit(1)
+	}
+
+	ageIdentities, err := cmd.Flags().GetStringSlice("age-identity")
+	if err != nil {
+		fmt.Printf("failed to read flag \"age-identity\", %s\n", err)
+		os.Exit(1)
+	}
+
+	hclVars, err := cmd.Flags().GetStringArray("var")
+	if err != nil {
+		fmt.Printf("failed to read flag \"var\", %s\n", err)
+		os.Exit(1)
+	}
+
+	hclVarFiles, err := cmd.Flags().GetStringSlice("var-file")
+	if err != nil {
+		fmt.Printf("failed to read flag \"var-file\", %s\n", err)
+		os.Exit(1)
+	}
+
+	command.manifest, err = services.Manifest.Read(manifestPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	command.releases, err = services.Manifest.Select(command.manifest, selectors)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	command.concurrency = concurrency
+	command.postRenderers = postRenderers
+	command.deployMeta = deployMeta
+	command.showSecrets = showSecrets
+	command.ageIdentities = ageIdentities
+	command.hclVars = hclVars
+	command.hclVarFiles = hclVarFiles
+	command.verification = model.Verification{
+		Enabled:     verify,
+		KeyringPath: keyring,
+	}
+
+	command.defaultCluster = model.ManifestCluster{
+		Address: address,
+		Token:   token,
+	}
+
+	return command
+}
+
+// Renders the job configurations of the manifest release.
+// Returns the configurations and the namespace of the release.
+func (c manifestCommand) render(
+	release model.ManifestRelease,
+) ([]model.RenderedJob, string, error) {
+	path, err := services.Deployment.ResolvePack(release.Pack, ".", c.verification)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get pack: %s", err)
+	}
+
+	packRelease, err := services.Deployment.Release(path, release.Release, c.verification)
+	if err != nil {
+		return nil, "", err
+	}
+
+	namespace := release.Namespace
+
+	if namespace == "" {
+		namespace = packRelease.Namespace
+	}
+
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	parameter := model.ConfigParameter{
+		ProjectDirPath: path,
+		Namespace:      namespace,
+		Release:        release.Release,
+		Files:          release.Files,
+		EnvFilePaths:   release.EnvFiles,
+		EnvVars:        release.Env,
+		AgeIdentities:  c.ageIdentities,
+		HCLVars:        append(append([]string{}, release.Vars...), c.hclVars...),
+		HCLVarFiles:    append(append([]string{}, release.VarFiles...), c.hclVarFiles...),
+		Verification:   c.verification,
+		ValueFiles:     release.Values,
+		Values:         release.Set,
+		Patches:        release.Patches,
+		PostRenderers:  c.postRenderers,
+		Naming:         release.Naming,
+		DeployMeta:     c.deployMeta,
+		NomadConfig:    c.config(release),
+	}
+
+	configStructure, err := services.Deployment.CreateConfigStructure(parameter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return configStructure, namespace, nil
+}
+
+// Returns the client of the Nomad cluster of the manifest release.
+func (c manifestCommand) client(release model.ManifestRelease) (*api.Client, error) {
+	client, err := api.NewClient(c.config(release))
+	if err != nil {
+		return nil, fmt.Errorf("error create nomad api client: %s", err)
+	}
+
+	return client, nil
+}
+
+// Returns the client configuration of the Nomad cluster of the manifest release.
+// If the cluster is not specified, the address and token from the flags
+// or the NOMAD_ADDR and NOMAD_TOKEN environment variables are used.
+func (c manifestCommand) config(release model.ManifestRelease) *api.Config {
+	cluster := c.defaultCluster
+
+	if release.Cluster != "" {
+		cluster = c.manifest.Clusters[release.Cluster]
+	}
+
+	configAPI := api.DefaultConfig()
+
+	if cluster.Address != "" {
+		configAPI.Address = cluster.Address
+	}
+
+	if cluster.Token != "" {
+		configAPI.SecretID = cluster.Token
+	}
+
+	if cluster.Region != "" {
+		configAPI.Region = cluster.Region
+	}
+
+	if TLSConfigAPI != nil {
+		configAPI.TLSConfig = TLSConfigAPI
+	}
+
+	if cluster.CACert != "" || cluster.ClientCert != "" || cluster.TLSSkipVerify {
+		configAPI.TLSConfig = &api.TLSConfig{
+			CACert:        cluster.CACert,
+			ClientCert:    cluster.ClientCert,
+			ClientKey:     cluster.ClientKey,
+			TLSServerName: cluster.TLSServerName,
+			Insecure:      cluster.TLSSkipVerify,
+		}
+	}
+
+	return configAPI
+}
+
+// Prints the report of the manifest releases.
+// Returns true if the command failed for at least one release.
+func printReport(results []model.ReleaseResult) bool {
+	var failed bool
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Println()
+	fmt.Fprintln(w, "RELEASE\tSTATUS\tJOBS\tDURATION\tERROR")
+
+	for _, result := range results {
+		var errorMessage string
+
+		if result.Error != nil {
+			errorMessage = result.Error.Error()
+		}
+
+		if result.Status == manifest.StatusFailed || result.Status == manifest.StatusSkipped {
+			failed = true
+		}
+
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\n",
+			result.Name,
+			result.Status,
+			strings.Join(result.Jobs, ","),
+			result.Duration,
+			errorMessage,
+		)
+	}
+
+	w.Flush()
+
+	return failed
+}
+
+// Adds the flags common to the manifest commands.
+func addManifestFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("file", "f", "prismfile.yaml", "path to the manifest file")
+
+	cmd.Flags().StringSliceP(
+		"selector",
+		"l",
+		[]string{},
+		"only releases with the label in the form label=value",
+	)
+
+	cmd.Flags().Int("concurrency", 1, "maximum number of releases processed at the same time")
+	cmd.Flags().StringP("address", "a", "", "address of the cluster for releases without a cluster")
+	cmd.Flags().StringP("token", "t", "", "access token of the cluster for releases without a cluster")
+
+	cmd.Flags().Bool(
+		"verify",
+		false,
+		"use only signed packs and dependencies with a valid signature",
+	)
+
+	cmd.Flags().String(
+		"keyring",
+		"",
+		"path to a file or directory with trusted public keys to verify pack signatures",
+	)
+
+	addPostRendererFlags(cmd.Flags())
+	addDeployMetaFlags(cmd.Flags())
+	addShowSecretsFlag(cmd.Flags())
+	addAgeIdentityFlag(cmd.Flags())
+	addHCLVarFlags(cmd.Flags())
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var packageCmd = &cobra.Command{
+	Use:   "package",
+	Short: "Package a pack into an archive",
+	Long: fmt.Sprintf(
+		"%s\n%s",
+		"Package a pack directory into a \"<name>-<pack_version>.tgz\" archive,",
+		"which can be published to a pack repository.",
+	),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := cmd.Flags().GetString("path")
+		if err != nil {
+			fmt.Printf("failed to read flag \"path\", %s\n", err)
+			os.Exit(1)
+		}
+
+		destination, err := cmd.Flags().GetString("destination")
+		if err != nil {
+			fmt.Printf("failed to read flag \"destination\", %s\n", err)
+			os.Exit(1)
+		}
+
+		sign, err := cmd.Flags().GetBool("sign")
+		if err != nil {
+			fmt.Printf("failed to read flag \"sign\", %s\n", err)
+			os.Exit(1)
+		}
+
+		key, err := cmd.Flags().GetString("key")
+		if err != nil {
+			fmt.Printf("failed to read flag \"key\", %s\n", err)
+			os.Exit(1)
+		}
+
+		if sign && key == "" {
+			fmt.Println("failed to package pack: the \"key\" flag is required to sign the pack")
+			os.Exit(1)
+		}
+
+		archivePath, err := services.Archive.Create(filepath.Join(path), destination)
+		if err != nil {
+			fmt.Printf("failed to package pack: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Pack successfully packaged to \"%s\".\n", archivePath)
+
+		if !sign {
+			return
+		}
+
+		signaturePath, err := services.Signature.Sign(archivePath, key)
+		if err != nil {
+			fmt.Printf("failed to sign pack: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Pack successfully signed \"%s\".\n", signaturePath)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(packageCmd)
+
+	packageCmd.Flags().StringP("path", "p", ".", "path to project directory")
+	packageCmd.Flags().StringP("destination", "d", ".", "directory in which the archive will be created")
+	packageCmd.Flags().Bool("sign", false, "create a detached signature of the pack archive")
+	packageCmd.Flags().String("key", "", "path to the ed25519 private key (PEM) to sign the pack")
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"prism/internal/service/registry"
+
+	"github.com/spf13/cobra"
+)
+
+var pullCmd = &cobra.Command{
+	Use:   "pull <repository>/<name>[@version] | oci://<registry>/<name>:<tag>",
+	Short: "Download a pack from a repository or OCI registry",
+	Long: fmt.Sprintf(
+		"%s\n%s\n%s",
+		"Download a pack archive from a pack repository or OCI registry.",
+		"If the version is not specified for a pack repository, the latest version is downloaded.",
+		"Registry credentials are taken from the docker config.",
+	),
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		destination, err := cmd.Flags().GetString("destination")
+		if err != nil {
+			fmt.Printf("failed to read flag \"destination\", %s\n", err)
+			os.Exit(1)
+		}
+
+		untar, err := cmd.Flags().GetBool("untar")
+		if err != nil {
+			fmt.Printf("failed to read flag \"untar\", %s\n", err)
+			os.Exit(1)
+		}
+
+		var archivePath string
+
+		if registry.IsReference(args[0]) {
+			archivePath, err = services.Registry.Pull(args[0], destination)
+		} else {
+			archivePath, err = services.Repository.Pull(args[0], destination)
+		}
+
+		if err != nil {
+			fmt.Printf("failed to pull pack: %s\n", err)
+			os.Exit(1)
+		}
+
+		if !untar {
+			fmt.Printf("Pack successfully pulled to \"%s\".\n", archivePath)
+			return
+		}
+
+		packDirPath, err := services.Archive.Extract(archivePath, destination)
+		if err != nil {
+			fmt.Printf("failed to extract pack: %s\n", err)
+			os.Exit(1)
+		}
+
+		err = os.Remove(archivePath)
+		if err != nil {
+			fmt.Printf("failed to remove pack archive: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Pack successfully pulled to \"%s\".\n", packDirPath)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pullCmd)
+
+	pullCmd.Flags().StringP("destination", "d", ".", "directory in which the pack will be saved")
+	pullCmd.Flags().Bool("untar", false, "extract the pack archive after downloading")
+}
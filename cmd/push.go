@@ -0,0 +1,39 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var pushCmd = &cobra.Command{
+	Use:   "push <pack.tgz> oci://<registry>/<name>[:tag]",
+	Short: "Push a pack archive to an OCI registry",
+	Long: fmt.Sprintf(
+		"%s\n%s\n%s",
+		"Push a pack archive to an OCI registry as an OCI artifact.",
+		"If the tag is not specified, the pack version is used.",
+		"Registry credentials are taken from the docker config.",
+	),
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		digest, err := services.Registry.Push(args[0], args[1])
+		if err != nil {
+			fmt.Printf("failed to push pack: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Pack successfully pushed to \"%s\", digest: %s\n", args[1], digest)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+}
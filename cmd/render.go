@@ -0,0 +1,336 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"prism/internal/model"
+	"prism/internal/service/patch"
+
+	"github.com/spf13/cobra"
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render the job configuration of a pack",
+	Long: fmt.Sprintf(
+		"%s\n%s\n%s",
+		"Render the job configuration of a pack to the console without deployment.",
+		"With --show-layers, the configuration of each pack it extends is shown.",
+		"With --canonical, the JSON representation to which patches are applied is shown.",
+	),
+	Run: render,
+}
+
+func render(cmd *cobra.Command, args []string) {
+	path, err := cmd.Flags().GetString("path")
+	if err != nil {
+		fmt.Printf("failed to read flag \"path\", %s\n", err)
+		os.Exit(1)
+	}
+
+	namespace, err := cmd.Flags().GetString("namespace")
+	if err != nil {
+		fmt.Printf("failed to read flag \"namespace\", %s\n", err)
+		os.Exit(1)
+	}
+
+	release, err := cmd.Flags().GetString("release")
+	if err != nil {
+		fmt.Printf("failed to read flag \"release\", %s\n", err)
+		os.Exit(1)
+	}
+
+	file, err := cmd.Flags().GetStringSlice("file")
+	if err != nil {
+		fmt.Printf("failed to read flag \"file\", %s\n", err)
+		os.Exit(1)
+	}
+
+	envFilePaths, err := cmd.Flags().GetStringSlice("env-file")
+	if err != nil {
+		fmt.Printf("failed to read flag \"env-file\", %s\n", err)
+		os.Exit(1)
+	}
+
+	envVars, err := cmd.Flags().GetStringToString("env")
+	if err != nil {
+		fmt.Printf("failed to read flag \"env\", %s\n", err)
+		os.Exit(1)
+	}
+
+	ageIdentities, err := cmd.Flags().GetStringSlice("age-identity")
+	if err != nil {
+		fmt.Printf("failed to read flag \"age-identity\", %s\n", err)
+		os.Exit(1)
+	}
+
+	valueFiles, err := cmd.Flags().GetStringSlice("values")
+	if err != nil {
+		fmt.Printf("failed to read flag \"values\", %s\n", err)
+		os.Exit(1)
+	}
+
+	values, err := cmd.Flags().GetStringArray("set")
+	if err != nil {
+		fmt.Printf("failed to read flag \"set\", %s\n", err)
+		os.Exit(1)
+	}
+
+	stringValues, err := cmd.Flags().GetStringArray("set-string")
+	if err != nil {
+		fmt.Printf("failed to read flag \"set-string\", %s\n", err)
+		os.Exit(1)
+	}
+
+	fileValues, err := cmd.Flags().GetStringArray("set-file")
+	if err != nil {
+		fmt.Printf("failed to read flag \"set-file\", %s\n", err)
+		os.Exit(1)
+	}
+
+	patches, err := cmd.Flags().GetStringSlice("patch")
+	if err != nil {
+		fmt.Printf("failed to read flag \"patch\", %s\n", err)
+		os.Exit(1)
+	}
+
+	postRenderers, err := readPostRenderers(cmd)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	naming, err := readNaming(cmd)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	deployMeta, err := readDeployMeta(cmd)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	verify, err := cmd.Flags().GetBool("verify")
+	if err != nil {
+		fmt.Printf("failed to read flag \"verify\", %s\n", err)
+		os.Exit(1)
+	}
+
+	keyring, err := cmd.Flags().GetString("keyring")
+	if err != nil {
+		fmt.Printf("failed to read flag \"keyring\", %s\n", err)
+		os.Exit(1)
+	}
+
+	canonical, err := cmd.Flags().GetBool("canonical")
+	if err != nil {
+		fmt.Printf("failed to read flag \"canonical\", %s\n", err)
+		os.Exit(1)
+	}
+
+	showLayers, err := cmd.Flags().GetBool("show-layers")
+	if err != nil {
+		fmt.Printf("failed to read flag \"show-layers\", %s\n", err)
+		os.Exit(1)
+	}
+
+	showSecrets, err := cmd.Flags().GetBool("show-secrets")
+	if err != nil {
+		fmt.Printf("failed to read flag \"show-secrets\", %s\n", err)
+		os.Exit(1)
+	}
+
+	verification := model.Verification{
+		Enabled:     verify,
+		KeyringPath: keyring,
+	}
+
+	path, err = services.Deployment.PackPath(path, verification)
+	if err != nil {
+		fmt.Printf("failed to get pack: %s\n", err)
+		os.Exit(1)
+	}
+
+	// The namespace of the release from the pack file
+	// is used if the namespace is not specified.
+	packRelease, err := services.Deployment.Release(path, release, verification)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if packRelease.Namespace != "" && !cmd.Flags().Changed("namespace") {
+		namespace = packRelease.Namespace
+	}
+
+	parameter := model.ConfigParameter{
+		ProjectDirPath: path,
+		Namespace:      namespace,
+		Release:        release,
+		Files:          file,
+		EnvFilePaths:   envFilePaths,
+		EnvVars:        envVars,
+		AgeIdentities:  ageIdentities,
+		Verification:   verification,
+		ValueFiles:     valueFiles,
+		Values:         values,
+		StringValues:   stringValues,
+		FileValues:     fileValues,
+		Patches:        patches,
+		PostRenderers:  postRenderers,
+		Naming:         naming,
+		DeployMeta:     deployMeta,
+		NomadConfig:    nomadConfig("", ""),
+	}
+
+	// Configuration of each pack in the inheritance chain.
+	if showLayers {
+		layers, err := services.Deployment.CreateConfigLayers(parameter)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		for index, layer := range layers {
+			output, err := services.Output.OutputConfig(layer.Config, layer.Declarations...)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			fmt.Printf(
+				"# Layer %d: %s %s (%s)\n%s\n\n",
+				index+1,
+				layer.Pack.Name,
+				layer.Pack.PackVersion,
+				layer.DirPath,
+				output,
+			)
+		}
+
+		fmt.Printf("# Result\n")
+	}
+
+	configStructure, err := services.Deployment.CreateConfigStructure(parameter)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	for _, job := range configStructure {
+		config := outputJob(job, showSecrets)
+
+		output, err := services.Output.OutputConfig(config, outputDeclarations(job, showSecrets)...)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// Canonical representation of the job to which patches are applied.
+		if canonical {
+			content, err := json.MarshalIndent(services.Patch.Canonical(config), "", "  ")
+			if err != nil {
+				fmt.Printf("failed to create canonical representation, %s\n", err)
+				os.Exit(1)
+			}
+
+			output = fmt.Sprintf("# %s\n%s", patch.BlockKey(config), content)
+		}
+
+		fmt.Printf("%s%s%v\n\n", transformerChain(job), fileVariablesPolicy(job, namespace), output)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+
+	renderCmd.Flags().StringP("path", "p", ".", "path to project directory, pack archive or OCI reference")
+	renderCmd.Flags().StringP("release", "r", "", "release name")
+	renderCmd.Flags().StringP("namespace", "n", "default", "namespace name")
+
+	renderCmd.Flags().StringSliceP(
+		"file",
+		"f",
+		[]string{},
+		"file name or full path to file to update configuration",
+	)
+
+	renderCmd.Flags().StringSlice(
+		"env-file",
+		[]string{},
+		"full path to the file with environment variables, the last file takes precedence",
+	)
+
+	renderCmd.Flags().StringToStringP(
+		"env", "e", map[string]string{}, "environment variables in the form key=value",
+	)
+
+	renderCmd.Flags().StringSlice(
+		"values",
+		[]string{},
+		"path to a values file for the configuration templates",
+	)
+
+	renderCmd.Flags().StringArray(
+		"set",
+		[]string{},
+		"value in the form key.subkey=value or job.group[name].parameter=value",
+	)
+
+	renderCmd.Flags().StringArray(
+		"set-string",
+		[]string{},
+		"string value in the form key.subkey=value or job.group[name].parameter=value",
+	)
+
+	renderCmd.Flags().StringArray(
+		"set-file",
+		[]string{},
+		"value from a file in the form key.subkey=path or job.group[name].parameter=path",
+	)
+
+	renderCmd.Flags().StringSlice(
+		"patch",
+		[]string{},
+		"file name or full path to a JSON Patch or JSON Merge Patch file",
+	)
+
+	addPostRendererFlags(renderCmd.Flags())
+	addNamingFlags(renderCmd.Flags())
+	addDeployMetaFlags(renderCmd.Flags())
+	addShowSecretsFlag(renderCmd.Flags())
+	addAgeIdentityFlag(renderCmd.Flags())
+
+	renderCmd.Flags().Bool(
+		"verify",
+		false,
+		"render only signed packs and dependencies with a valid signature",
+	)
+
+	renderCmd.Flags().String(
+		"keyring",
+		"",
+		"path to a file or directory with trusted public keys to verify pack signatures",
+	)
+
+	renderCmd.Flags().Bool(
+		"show-layers",
+		false,
+		"show the configuration of each pack in the inheritance chain",
+	)
+
+	renderCmd.Flags().Bool(
+		"canonical",
+		false,
+		"print the canonical JSON representation of the job to which patches are applied",
+	)
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"prism/internal/model"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var repoCmd = &cobra.Command{
+	Use:   "repo",
+	Short: "Manage pack repositories",
+	Long: fmt.Sprintf(
+		"%s\n%s",
+		"Add, update and search pack repositories.",
+		"A pack repository is a directory or HTTP(S) server with an \"index.yaml\" file and pack archives.",
+	),
+}
+
+var repoAddCmd = &cobra.Command{
+	Use:   "add <name> <url>",
+	Short: "Add a pack repository",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		verify, err := cmd.Flags().GetBool("verify")
+		if err != nil {
+			fmt.Printf("failed to read flag \"verify\", %s\n", err)
+			os.Exit(1)
+		}
+
+		keyring, err := cmd.Flags().GetString("keyring")
+		if err != nil {
+			fmt.Printf("failed to read flag \"keyring\", %s\n", err)
+			os.Exit(1)
+		}
+
+		repository := model.Repository{
+			Name:    args[0],
+			URL:     args[1],
+			Verify:  verify,
+			Keyring: keyring,
+		}
+
+		err = services.Repository.Add(repository)
+		if err != nil {
+			fmt.Printf("failed to add repository: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Repository \"%s\" successfully added.\n", args[0])
+	},
+}
+
+var repoUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update the indexes of the pack repositories",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		updated, err := services.Repository.Update()
+		if err != nil {
+			fmt.Printf("failed to update repositories: %s\n", err)
+			os.Exit(1)
+		}
+
+		for _, name := range updated {
+			fmt.Printf("Repository \"%s\" successfully updated.\n", name)
+		}
+	},
+}
+
+var repoSearchCmd = &cobra.Command{
+	Use:   "search [keyword]",
+	Short: "Search for packs in the pack repositories",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var keyword string
+
+		if len(args) > 0 {
+			keyword = args[0]
+		}
+
+		versions, err := cmd.Flags().GetBool("versions")
+		if err != nil {
+			fmt.Printf("failed to read flag \"versions\", %s\n", err)
+			os.Exit(1)
+		}
+
+		result, err := services.Repository.Search(keyword, versions)
+		if err != nil {
+			fmt.Printf("failed to search packs: %s\n", err)
+			os.Exit(1)
+		}
+
+		if len(result) == 0 {
+			fmt.Println("No packs found.")
+			return
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAME\tPACK VERSION\tDEPLOY VERSION\tNOMAD VERSION\tDESCRIPTION")
+
+		for _, item := range result {
+			fmt.Fprintf(
+				writer,
+				"%s/%s\t%s\t%s\t%s\t%s\n",
+				item.Repository,
+				item.Entry.Name,
+				item.Entry.PackVersion,
+				item.Entry.DeployVersion,
+				item.Entry.NomadVersion,
+				strings.TrimSpace(item.Entry.Description),
+			)
+		}
+
+		writer.Flush()
+	},
+}
+
+var repoIndexCmd = &cobra.Command{
+	Use:   "index <dir>",
+	Short: "Generate an index file for a directory with pack archives",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		baseURL, err := cmd.Flags().GetString("url")
+		if err != nil {
+			fmt.Printf("failed to read flag \"url\", %s\n", err)
+			os.Exit(1)
+		}
+
+		indexPath, err := services.Repository.Index(args[0], baseURL)
+		if err != nil {
+			fmt.Printf("failed to create index: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Index successfully created \"%s\".\n", indexPath)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(repoCmd)
+
+	repoCmd.AddCommand(repoAddCmd)
+	repoCmd.AddCommand(repoUpdateCmd)
+	repoCmd.AddCommand(repoSearchCmd)
+	repoCmd.AddCommand(repoIndexCmd)
+
+	repoAddCmd.Flags().Bool("verify", false, "use only signed packs from the repository")
+	repoAddCmd.Flags().String("keyring", "", "path to trusted public keys for the repository packs")
+	repoSearchCmd.Flags().Bool("versions", false, "show all versions of the packs")
+	repoIndexCmd.Flags().String("url", "", "base URL of the pack archives")
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <pack.tgz>",
+	Short: "Verify a pack archive signature",
+	Long: fmt.Sprintf(
+		"%s\n%s",
+		"Verify a pack archive against its detached signature \"<pack.tgz>.sig\"",
+		"using the keyring of trusted public keys.",
+	),
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		keyring, err := cmd.Flags().GetString("keyring")
+		if err != nil {
+			fmt.Printf("failed to read flag \"keyring\", %s\n", err)
+			os.Exit(1)
+		}
+
+		packSignature, err := services.Signature.Verify(args[0], keyring)
+		if err != nil {
+			fmt.Printf("verification failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf(
+			"Pack \"%s\" version \"%s\" is signed with key %s, digest: %s\n",
+			packSignature.Name,
+			packSignature.PackVersion,
+			packSignature.KeyID,
+			packSignature.Digest,
+		)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().String(
+		"keyring",
+		"",
+		"path to a file or directory with trusted public keys",
+	)
+}
@@ -6,7 +6,11 @@
 
 package model
 
-import "github.com/hashicorp/nomad/api"
+import (
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
 
 // Yaml configuration block.
 // Any structure in a file configuration that is not a variable
@@ -34,16 +38,182 @@ type Pack struct {
 	DeployVersion string           `yaml:"deploy_version"`
 	PackVersion   string           `yaml:"pack_version"`
 	NomadVersion  string           `yaml:"nomad_version"`
+	Templating    bool             `yaml:"templating"`
+	Extends       string           `yaml:"extends"`
+	Releases      []PackRelease    `yaml:"releases"`
+	Naming        Naming           `yaml:"naming"`
+	DeployMeta    []string         `yaml:"deploy_meta"`
+	Transformers  []Transformer    `yaml:"transformers"`
 	Dependencies  []PackDependency `yaml:"dependencies"`
 }
 
+// Templates of the names of the job, groups and tasks of the release,
+// if the template is empty, the name is not changed.
+type Naming struct {
+	Job   string `yaml:"job"`
+	Group string `yaml:"group"`
+	Task  string `yaml:"task"`
+}
+
+// Data for the naming templates.
+type NamingData struct {
+	Job       string
+	Group     string
+	Task      string
+	Release   string
+	Namespace string
+	Pack      string
+}
+
+// External executable that changes the rendered job.
+// The job is passed to stdin as JSON, the changed job is read from stdout.
+type Transformer struct {
+	Name    string   `yaml:"name"`
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	Timeout string   `yaml:"timeout"`
+	DirPath string   `yaml:"-"` // directory of the pack, the command is run in it
+}
+
+// Job configuration with the transformers applied to it.
+type RenderedJob struct {
+	Config       TemplateBlock
+	Transformers []Transformer
+	// Values of the secrets used in the job, masked in the output.
+	Sensitive []string
+	// Nomad Variables with the files of the template blocks (file_ref)
+	// and the path under which they are stored.
+	Variables     []FileVariable
+	VariablesPath string
+	// HCL2 variable and locals blocks declared in the configuration file
+	// and the values of the variables from the command line.
+	Declarations []TemplateBlock
+	HCLVariables string
+}
+
+// Nomad Variable with a chunk of the file of the template block.
+type FileVariable struct {
+	Path  string
+	Items map[string]string
+}
+
+// Release declared in the pack file.
+type PackRelease struct {
+	Name      string   `yaml:"name"`
+	Namespace string   `yaml:"namespace"`
+	Files     []string `yaml:"files"`
+	EnvFiles  []string `yaml:"env_files"`
+}
+
+// Pack in the inheritance chain and its own configuration.
+type ConfigLayer struct {
+	Pack    Pack
+	DirPath string
+	Config  TemplateBlock
+	// HCL2 variable and locals blocks of the configuration file.
+	Declarations []TemplateBlock
+}
+
 type PackDependency struct {
 	Name        string   `yaml:"name"`
 	PackVersion string   `yaml:"pack_version"`
 	Path        string   `yaml:"path"`
+	Repository  string   `yaml:"repository"`
+	Library     bool     `yaml:"library"`
 	Files       []string `yaml:"files"`
 }
 
+// Pack repository added with the "repo add" command.
+type Repository struct {
+	Name    string `yaml:"name"`
+	URL     string `yaml:"url"`
+	Verify  bool   `yaml:"verify,omitempty"`
+	Keyring string `yaml:"keyring,omitempty"`
+}
+
+// List of the added pack repositories.
+type RepositoryFile struct {
+	Repositories []Repository `yaml:"repositories"`
+}
+
+// Pack repository index, the "index.yaml" file.
+type RepositoryIndex struct {
+	APIVersion string                            `yaml:"api_version"`
+	Generated  string                            `yaml:"generated"`
+	Packs      map[string][]RepositoryIndexEntry `yaml:"packs"`
+}
+
+// Pack version in the pack repository index.
+type RepositoryIndexEntry struct {
+	Name          string   `yaml:"name"`
+	PackVersion   string   `yaml:"pack_version"`
+	DeployVersion string   `yaml:"deploy_version"`
+	Description   string   `yaml:"description"`
+	Maintainers   []string `yaml:"maintainers"`
+	NomadVersion  string   `yaml:"nomad_version"`
+	Digest        string   `yaml:"digest"`
+	URL           string   `yaml:"url"`
+}
+
+// Detached pack archive signature, the "<archive>.sig" file.
+type PackSignature struct {
+	Name          string `yaml:"name"`
+	PackVersion   string `yaml:"pack_version"`
+	DeployVersion string `yaml:"deploy_version"`
+	Digest        string `yaml:"digest"`
+	KeyID         string `yaml:"key_id"`
+	Signature     string `yaml:"signature"`
+	Created       string `yaml:"created"`
+}
+
+// Pack signature verification settings.
+type Verification struct {
+	Enabled     bool
+	KeyringPath string
+}
+
+// Pack archive downloaded from the pack repository.
+type ResolvedPack struct {
+	ArchivePath  string
+	Verification Verification
+}
+
+// Pack found in the pack repositories.
+type RepositorySearchResult struct {
+	Repository string
+	Entry      RepositoryIndexEntry
+}
+
+// Configuration file and the data necessary to read it.
+type ConfigFile struct {
+	Path         string
+	Include      Include
+	TemplateData *TemplateData
+	// Base configuration, anchors of which are available in the file.
+	Base []byte
+}
+
+// Paths for resolving the $include directive.
+type Include struct {
+	// Path to the pack directory, relative to which the partials are specified.
+	PackDirPath string
+	// Paths to the dependency pack directories by dependency name.
+	Packs map[string]string
+}
+
+// Data available in the configuration file templates.
+type TemplateData struct {
+	Values    map[string]interface{}
+	Release   TemplateRelease
+	Namespace string
+	Pack      Pack
+}
+
+type TemplateRelease struct {
+	Name      string
+	Namespace string
+}
+
 // Necessary data for building the job configuration structure.
 type BuildStructure struct {
 	Config ConfigBlock
@@ -55,8 +225,70 @@ type ConfigParameter struct {
 	Namespace      string
 	Release        string
 	Files          []string
-	EnvFilePath    string
+	EnvFilePaths   []string
 	EnvVars        map[string]string
+	Verification   Verification
+	ValueFiles     []string
+	Values         []string
+	StringValues   []string
+	FileValues     []string
+	Overrides      []ConfigOverride
+	Patches        []string
+	PostRenderers  []Transformer
+	Naming         Naming
+	DeployMeta     DeployMeta
+	// Client configuration of the cluster to read the Nomad Variables and to parse
+	// the jobs for the transformers, if nil, the NOMAD_ADDR and NOMAD_TOKEN
+	// environment variables are used.
+	NomadConfig *api.Config
+	// Files with the age identities to decrypt the encrypted env files.
+	AgeIdentities []string
+	// Values of the HCL2 input variables (name=value) and the variables files.
+	HCLVars     []string
+	HCLVarFiles []string
+}
+
+// Information about the deployment added to the job meta.
+type DeployMeta struct {
+	// Fields of the meta, if nil, the fields from the pack file are used.
+	Fields []string
+	// Adds a unique value to the meta to create a new version of the job.
+	ForceRedeploy bool
+	PrismVersion  string
+}
+
+// Environment variable referenced in the files of the pack.
+type EnvVariable struct {
+	Name string
+	// Default values of the references, the text of each different default.
+	Defaults []string
+	// Message of the required modifier.
+	Required string
+	Usages   []EnvVariableUsage
+	// Value of the variable or its default value and the name of the source.
+	Value    string
+	Source   string
+	Resolved bool
+}
+
+// Place in the file where the variable is referenced.
+type EnvVariableUsage struct {
+	Path string
+	Line int
+}
+
+// Keys and rules to encrypt the files with SOPS.
+type SopsKeys struct {
+	Age               []string // age recipients
+	PGP               []string // fingerprints of the PGP keys
+	UnencryptedSuffix string
+	EncryptedRegex    string
+}
+
+// Change to the job configuration from the command line value.
+type ConfigOverride struct {
+	Path   string                 // job.group[web].count
+	Config map[string]interface{} // job block of the config file with the value
 }
 
 type CheckNamespace struct {
@@ -66,21 +298,24 @@ type CheckNamespace struct {
 }
 
 type Changes struct {
-	Release      string
-	Namespace    string
-	Files        []TemplateBlock
-	FilesDirPath string
-	Pack         Pack
-	EnvFilePath  string
-	EnvVars      map[string]string
+	Release       string
+	Namespace     string
+	Files         []TemplateBlock
+	FilesDirPaths []string
+	Pack          Pack
+	Naming        Naming
+	TemplateData  TemplateData // data of the files of the template blocks
 }
 
 type BlockChanges struct {
-	Release      string
-	Namespace    string
-	File         TemplateBlock
-	FilesDirPath string
-	Pack         Pack
+	Release       string
+	Namespace     string
+	File          TemplateBlock
+	FilesDirPaths []string
+	Pack          Pack
+	Naming        Naming
+	NamingData    NamingData // names of the parent blocks before renaming
+	TemplateData  TemplateData
 }
 
 type Deployment struct {
@@ -89,4 +324,82 @@ type Deployment struct {
 	Namespace string
 	Config    string
 	WaitTime  int
+	// Nomad Variables with the files of the job, written before the job is registered.
+	Variables []FileVariable
+	// Values of the HCL2 input variables of the job, in the format of a variables file.
+	HCLVariables string
+	// Values of the secrets masked in the difference of the plan.
+	Sensitive []string
+}
+
+// Manifest with the releases managed by the apply, diff and destroy commands.
+type Manifest struct {
+	Clusters map[string]ManifestCluster `yaml:"clusters"`
+	Releases []ManifestRelease          `yaml:"releases"`
+}
+
+// Nomad cluster in which the manifest releases are deployed.
+type ManifestCluster struct {
+	Address       string `yaml:"address"`
+	Token         string `yaml:"token"`
+	Region        string `yaml:"region"`
+	CACert        string `yaml:"ca_cert"`
+	ClientCert    string `yaml:"client_cert"`
+	ClientKey     string `yaml:"client_key"`
+	TLSServerName string `yaml:"tls_server_name"`
+	TLSSkipVerify bool   `yaml:"tls_skip_verify"`
+}
+
+type ManifestRelease struct {
+	Name      string            `yaml:"name"`
+	Pack      string            `yaml:"pack"`
+	Release   string            `yaml:"release"`
+	Namespace string            `yaml:"namespace"`
+	Cluster   string            `yaml:"cluster"`
+	Files     []string          `yaml:"files"`
+	EnvFiles  []string          `yaml:"env_files"`
+	Env       map[string]string `yaml:"env"`
+	Values    []string          `yaml:"values"`
+	Set       []string          `yaml:"set"`
+	Patches   []string          `yaml:"patches"`
+	Vars      []string          `yaml:"vars"`
+	VarFiles  []string          `yaml:"var_files"`
+	Naming    Naming            `yaml:"naming"`
+	Needs     []string          `yaml:"needs"`
+	Labels    map[string]string `yaml:"labels"`
+}
+
+// Result of the command for the manifest release.
+type ReleaseResult struct {
+	Name     string
+	Jobs     []string
+	Status   string
+	Duration time.Duration
+	Error    error
+}
+
+// Result of the job plan in the cluster.
+type PlanResult struct {
+	JobName string
+	Changed bool
+	Diff    string
+}
+
+// Parameters of the import of the Nomad job into a pack.
+type ImportParameter struct {
+	// Directory in which the pack directory is created.
+	DirPath string
+	// Name of the pack, if empty, the name of the job is used.
+	Name string
+	// Source of the job, added to the description of the pack.
+	Source string
+}
+
+// Pack created from the imported job.
+type ImportResult struct {
+	PackDirPath string
+	// Files of the template blocks moved to the files directory.
+	Files []string
+	// Parts of the job that are not translated to the configuration.
+	Warnings []string
 }
@@ -0,0 +1,294 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"prism/internal/model"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Archive struct{}
+
+func NewArchive() *Archive {
+	return &Archive{}
+}
+
+// Packages the pack directory into a "<name>-<pack_version>.tgz" archive
+// in the destination directory. Returns the path to the created archive.
+func (s *Archive) Create(packDirPath, destination string) (string, error) {
+	pack, err := ReadPackFile(filepath.Join(packDirPath, "pack.yaml"))
+	if err != nil {
+		return "", err
+	}
+
+	if pack.Name == "" || pack.PackVersion == "" {
+		return "", fmt.Errorf(
+			"pack file must contain the \"name\" and \"pack_version\" parameters",
+		)
+	}
+
+	err = os.MkdirAll(destination, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create destination directory, %s", err)
+	}
+
+	archiveName := fmt.Sprintf("%s-%s.tgz", pack.Name, pack.PackVersion)
+	archivePath := filepath.Join(destination, archiveName)
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive, %s", err)
+	}
+
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err = filepath.Walk(packDirPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(packDirPath, filePath)
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden files and directories, such as ".git".
+		if relPath != "." && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if relPath == "." || !(info.IsDir() || info.Mode().IsRegular()) {
+			return nil
+		}
+
+		// Skip the pack archives, the archive being written can be
+		// in the pack directory with the default destination.
+		if !info.IsDir() && filepath.Ext(info.Name()) == ".tgz" {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+
+		header.Name = path.Join(pack.Name, filepath.ToSlash(relPath))
+
+		err = tarWriter.WriteHeader(header)
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		content, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+
+		defer content.Close()
+
+		_, err = io.Copy(tarWriter, content)
+		return err
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("failed to write archive, %s", err)
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to write archive, %s", err)
+	}
+
+	err = gzipWriter.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to write archive, %s", err)
+	}
+
+	return archivePath, nil
+}
+
+// Extracts the pack archive into the destination directory.
+// Returns the path to the extracted pack directory.
+func (s *Archive) Extract(archivePath, destination string) (string, error) {
+	var packDirPath string
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive, %s", err)
+	}
+
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read archive %s, %s", archivePath, err)
+	}
+
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("failed to read archive %s, %s", archivePath, err)
+		}
+
+		name := filepath.FromSlash(path.Clean(header.Name))
+		if filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+			return "", fmt.Errorf("archive contains an invalid path %s", header.Name)
+		}
+
+		targetPath := filepath.Join(destination, name)
+
+		if packDirPath == "" {
+			packDirPath = filepath.Join(destination, strings.Split(name, string(filepath.Separator))[0])
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(targetPath, 0755)
+		case tar.TypeReg:
+			err = extractFile(tarReader, targetPath, header.FileInfo().Mode())
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("failed to extract archive %s, %s", archivePath, err)
+		}
+	}
+
+	if packDirPath == "" {
+		return "", fmt.Errorf("archive %s is empty", archivePath)
+	}
+
+	return packDirPath, nil
+}
+
+// Reads the pack file from the pack archive.
+func (s *Archive) ReadPack(archivePath string) (model.Pack, error) {
+	var pack model.Pack
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return pack, fmt.Errorf("failed to open archive, %s", err)
+	}
+
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return pack, fmt.Errorf("failed to read archive %s, %s", archivePath, err)
+	}
+
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return pack, fmt.Errorf("failed to read archive %s, %s", archivePath, err)
+		}
+
+		parts := strings.Split(path.Clean(header.Name), "/")
+		if len(parts) != 2 || parts[1] != "pack.yaml" {
+			continue
+		}
+
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return pack, fmt.Errorf("failed to read pack file, %s", err)
+		}
+
+		err = yaml.Unmarshal(content, &pack)
+		if err != nil {
+			return pack, fmt.Errorf("failed to parsing pack file, %s", err)
+		}
+
+		return pack, nil
+	}
+
+	return pack, fmt.Errorf("pack file not found in archive %s", archivePath)
+}
+
+// Returns the digest of the file in the "sha256:<hex>" format.
+func Digest(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file, %s", err)
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate digest, %s", err)
+	}
+
+	return fmt.Sprintf("sha256:%x", hash.Sum(nil)), nil
+}
+
+// Reads and parses the pack file.
+func ReadPackFile(filePath string) (model.Pack, error) {
+	var pack model.Pack
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return pack, fmt.Errorf("error to read pack file, %s", err)
+	}
+
+	err = yaml.Unmarshal(content, &pack)
+	if err != nil {
+		return pack, fmt.Errorf("failed to parsing pack file, %s", err)
+	}
+
+	return pack, nil
+}
+
+func extractFile(reader io.Reader, targetPath string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(targetPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(targetPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	_, err = io.Copy(file, reader)
+	return err
+}
@@ -1370,6 +1370,7 @@ func (b *BlockBuilder) Template(block model.ConfigBlock) model.TemplateBlock {
 	parameterName := []string{
 		"name",
 		"file",
+		"file_ref",
 		"change_mode",
 		"change_signal",
 		"destination",
@@ -1380,6 +1381,9 @@ func (b *BlockBuilder) Template(block model.ConfigBlock) model.TemplateBlock {
 		"uid",
 		"gid",
 		"right_delimiter",
+		"render",
+		"render_left_delimiter",
+		"render_right_delimiter",
 		"source",
 		"splay",
 		"vault_grace",
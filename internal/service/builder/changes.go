@@ -7,8 +7,11 @@
 package builder
 
 import (
+	"bytes"
 	"prism/internal/model"
+	"prism/internal/service/resolver"
 	"slices"
+	gotemplate "text/template"
 )
 
 var (
@@ -24,18 +27,20 @@ func NewChanges() *Changes {
 }
 
 // Making changes to the configuration file.
-// Adds parameters and blocks specified in additional files,
-// parameters from flags and environment variables.
+// Adds parameters and blocks specified in additional files
+// and parameters from flags.
 func (s *Changes) SetChanges(
 	config *model.TemplateBlock,
 	changes *model.Changes,
 ) error {
 	blockChanges := model.BlockChanges{
-		Release:      changes.Release,
-		Namespace:    changes.Namespace,
-		File:         model.TemplateBlock{},
-		FilesDirPath: changes.FilesDirPath,
-		Pack:         changes.Pack,
+		Release:       changes.Release,
+		Namespace:     changes.Namespace,
+		File:          model.TemplateBlock{},
+		FilesDirPaths: changes.FilesDirPaths,
+		Pack:          changes.Pack,
+		Naming:        changes.Naming,
+		TemplateData:  changes.TemplateData,
 	}
 
 	if len(changes.Files) > 0 {
@@ -51,24 +56,21 @@ func (s *Changes) SetChanges(
 			job(config, &blockChanges)
 		}
 
-		err := findAndReplaceEnvVars(config, changes.EnvFilePath, changes.EnvVars)
-		if err != nil {
-			return err
-		}
-
 		return nil
 	}
 
 	job(config, &blockChanges)
-
-	err := findAndReplaceEnvVars(config, changes.EnvFilePath, changes.EnvVars)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
+// Replaces environment variables in the configuration.
+func (s *Changes) ReplaceEnvVars(
+	config *model.TemplateBlock,
+	resolver *resolver.Resolver,
+) error {
+	return replaceEnvVars(config, resolver)
+}
+
 // Checks for the presence of blocks
 // in the specified file that can be specified only once.
 // If the block specified in the file is in the configuration, it is ignored.
@@ -254,11 +256,14 @@ func checkFileChanges(
 	}
 
 	blockChanges := model.BlockChanges{
-		Release:      changes.Release,
-		Namespace:    changes.Namespace,
-		File:         fileChanges,
-		FilesDirPath: changes.FilesDirPath,
-		Pack:         changes.Pack,
+		Release:       changes.Release,
+		Namespace:     changes.Namespace,
+		File:          fileChanges,
+		FilesDirPaths: changes.FilesDirPaths,
+		Pack:          changes.Pack,
+		Naming:        changes.Naming,
+		NamingData:    changes.NamingData,
+		TemplateData:  changes.TemplateData,
 	}
 
 	return blockChanges
@@ -311,3 +316,26 @@ func setFileChanges(config, changes *model.TemplateBlock) {
 		}
 	}
 }
+
+// Returns the name of the block of the release by the naming template.
+// If the template is empty, the name is not changed.
+func releaseName(name, nameTemplate string, data model.NamingData) string {
+	if nameTemplate == "" {
+		return name
+	}
+
+	// Templates are checked before making changes.
+	tmpl, err := gotemplate.New("name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return name
+	}
+
+	var buf bytes.Buffer
+
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return name
+	}
+
+	return buf.String()
+}
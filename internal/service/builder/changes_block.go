@@ -132,10 +132,6 @@ func device(block *model.TemplateBlock, changes *model.BlockChanges) {
 	checkSingleBlocks(block, &changes.File, singleBlock)
 	setFileChanges(block, &changes.File)
 
-	if changes.Release != "" {
-		block.Label = fmt.Sprintf("%s-%s", block.Label, changes.Release)
-	}
-
 	for index, item := range block.Block {
 		blockChanges := checkFileChanges(
 			&block.Block[index], changes, single,
@@ -335,8 +331,10 @@ func group(block *model.TemplateBlock, changes *model.BlockChanges) {
 
 	setFileChanges(block, &changes.File)
 
+	// Renaming the group by the naming template of the release.
 	if changes.Release != "" {
-		block.Label = fmt.Sprintf("%s-%s", block.Label, changes.Release)
+		changes.NamingData.Group = block.Label
+		block.Label = releaseName(block.Label, changes.Naming.Group, changes.NamingData)
 	}
 
 	for index, item := range block.Block {
@@ -461,9 +459,16 @@ func job(block *model.TemplateBlock, changes *model.BlockChanges) {
 	// Set changes.
 	setFileChanges(block, &changes.File)
 
-	// Adding the release name to the job name.
+	// Renaming the job by the naming template of the release.
 	if changes.Release != "" {
-		block.Label = fmt.Sprintf("%s-%s", block.Label, changes.Release)
+		changes.NamingData = model.NamingData{
+			Job:       block.Label,
+			Release:   changes.Release,
+			Namespace: changes.Namespace,
+			Pack:      changes.Pack.Name,
+		}
+
+		block.Label = releaseName(block.Label, changes.Naming.Job, changes.NamingData)
 	}
 
 	for index, item := range block.Block {
@@ -847,10 +852,15 @@ func task(block *model.TemplateBlock, changes *model.BlockChanges) {
 
 	setFileChanges(block, &changes.File)
 
+	// Renaming the task by the naming template of the release.
 	if changes.Release != "" {
-		block.Label = fmt.Sprintf("%s-%s", block.Label, changes.Release)
+		changes.NamingData.Task = block.Label
+		block.Label = releaseName(block.Label, changes.Naming.Task, changes.NamingData)
 	}
 
+	// Template blocks with a glob pattern in the file.
+	block.Block = expandTemplateGlobs(block.Block, changes.FilesDirPaths)
+
 	for index, item := range block.Block {
 		blockChanges := checkFileChanges(&block.Block[index], changes, single)
 
@@ -930,7 +940,7 @@ func template(block *model.TemplateBlock, changes *model.BlockChanges) {
 				if len(findSeparator) > 0 {
 					fileFullPath = v.(string)
 				} else {
-					fileFullPath = filepath.Join(changes.FilesDirPath, v.(string))
+					fileFullPath = findFile(changes.FilesDirPaths, v.(string))
 				}
 
 				// Read the file and add data to the "data" parameter.
@@ -940,6 +950,8 @@ func template(block *model.TemplateBlock, changes *model.BlockChanges) {
 					os.Exit(1)
 				}
 
+				file = renderTemplateFile(block, fileFullPath, file, changes.TemplateData)
+
 				i := make(map[string]interface{})
 				i["data"] = string(file)
 				block.Parameter = append(block.Parameter, i)
@@ -950,6 +962,7 @@ func template(block *model.TemplateBlock, changes *model.BlockChanges) {
 	}
 
 	pkg.RemoveParameter(block, "name")
+	removeRenderParameters(block)
 
 	for index, item := range block.Block {
 		blockChanges := checkFileChanges(
@@ -965,6 +978,24 @@ func template(block *model.TemplateBlock, changes *model.BlockChanges) {
 	}
 }
 
+// Returns the path to the file in the first files directory in which it exists.
+// Directories of the pack take precedence over the directories of the parent packs.
+func findFile(dirPaths []string, name string) string {
+	for _, dirPath := range dirPaths {
+		path := filepath.Join(dirPath, name)
+
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	if len(dirPaths) == 0 {
+		return name
+	}
+
+	return filepath.Join(dirPaths[0], name)
+}
+
 func templateWait(block *model.TemplateBlock, changes *model.BlockChanges) {
 	setFileChanges(block, &changes.File)
 }
@@ -9,267 +9,155 @@ package builder
 import (
 	"fmt"
 	"prism/internal/model"
-	"regexp"
-	"slices"
-	"strconv"
+	"prism/internal/service/patch"
+	"prism/internal/service/resolver"
+	"prism/pkg"
 	"strings"
-
-	"github.com/spf13/viper"
 )
 
-var missingEnvVars []string
+// Environment variable that is not found, with the location in the configuration.
+type missingEnvVar struct {
+	variable resolver.Missing
+	location string
+}
 
-// Searching for environment variables in the configuration structure
-// to replace them with values from one of
-// the sources in which the variable is specified.
-func findAndReplaceEnvVars(
-	config *model.TemplateBlock,
-	filePath string,
-	envVars map[string]string,
-) error {
-	err := setEnvVar(config, filePath, envVars)
+// Replaces environment variables with the "PRISM_" key in the labels
+// and parameters of the configuration in one pass over the configuration.
+// Returns an error with all the variables that are not found.
+func replaceEnvVars(config *model.TemplateBlock, resolver *resolver.Resolver) error {
+	var missing []missingEnvVar
+
+	err := setEnvVar(config, resolver, "", &missing)
 	if err != nil {
-		return fmt.Errorf(
-			"an error occurred while searching and inserting environment variables, %s",
-			err,
-		)
+		return err
 	}
 
-	if len(missingEnvVars) > 0 {
-		var missingVars string
+	if len(missing) > 0 {
+		var items []string
+
+		for _, item := range missing {
+			message := fmt.Sprintf("%s (%s)", item.variable.Name, item.location)
 
-		for i, m := range missingEnvVars {
-			if len(missingEnvVars)-1 != i {
-				missingVars += fmt.Sprintf("%s, ", m)
-			} else {
-				missingVars += m
+			if item.variable.Message != "" {
+				message = fmt.Sprintf("%s: %s", message, item.variable.Message)
 			}
+
+			items = append(items, message)
 		}
 
-		return fmt.Errorf("environment variables not found: %v", missingVars)
+		return fmt.Errorf("environment variables not found: %s", strings.Join(items, ", "))
 	}
 
 	return nil
 }
 
-// Searching for environment variables with the "PRISM_" key
-// in the configuration file and replacing them with the found values
-// from local environment variables, a file with variables
-// or values specified in the deployment command flag.
+// Replaces environment variables in the label and parameters
+// of the block and its nested blocks. Parameters that consist of one
+// expression get the type of the expression, the other parameters are strings.
 func setEnvVar(
 	config *model.TemplateBlock,
-	filePath string,
-	envVars map[string]string,
+	resolver *resolver.Resolver,
+	path string,
+	missing *[]missingEnvVar,
 ) error {
-	// Find format.
-	envFormat, err := regexp.Compile(
-		`\${(PRISM_([\w+-]+))}|\${((PRISM_([\w+-]+))\|default=([\w+-]+))}`,
-	)
+	evaluate := func(value, location string) (interface{}, error) {
+		result, variables, err := resolver.Evaluate(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to replace environment variables in %s, %s", location, err)
+		}
 
-	if err != nil {
-		return fmt.Errorf("error parse regex, %s", err)
-	}
+		for _, variable := range variables {
+			*missing = append(*missing, missingEnvVar{variable: variable, location: location})
+		}
 
-	envDefaultFormat, err := regexp.Compile(`\|default=([\w+-]+)`)
-	if err != nil {
-		return fmt.Errorf("error parse regex, %s", err)
+		return result, nil
 	}
 
-	// Finding and replace a variable in a block label.
 	if config.Label != "" {
-		newLabel, err := replaceEnvVar(
-			config.Label,
-			filePath,
-			envVars,
-			envFormat,
-			envDefaultFormat,
-		)
+		location := joinPath(path, config.Type) + " label"
 
+		label, variables, err := resolver.Replace(config.Label)
 		if err != nil {
-			return fmt.Errorf(
-				"failed set environment variable for label in block %s, %s",
-				config.Type, err,
-			)
+			return fmt.Errorf("failed to replace environment variables in %s, %s", location, err)
 		}
 
-		config.Label = newLabel
-	}
+		for _, variable := range variables {
+			*missing = append(*missing, missingEnvVar{variable: variable, location: location})
+		}
 
-	// Finding and replace a variables in a parameters.
-	if len(config.Parameter) > 0 {
-		for index, item := range config.Parameter {
-			for key, value := range item {
-
-				switch v := value.(type) {
-				case string:
-					newValue, err := replaceEnvVar(
-						v,
-						filePath,
-						envVars,
-						envFormat,
-						envDefaultFormat,
-					)
+		config.Label = label
+	}
 
-					if err != nil {
-						return fmt.Errorf(
-							"failed set environment variable for paramenter %s in block %s, %s",
-							key, config.Type, err,
-						)
-					}
+	path = joinPath(path, patch.BlockKey(*config))
 
-					config.Parameter[index][key] = envTyping(newValue)
-				case []interface{}:
-					var paramenters []interface{}
-
-					for _, item := range v {
-						newValue, err := replaceEnvVar(
-							item.(string),
-							filePath,
-							envVars,
-							envFormat,
-							envDefaultFormat,
-						)
-
-						if err != nil {
-							return fmt.Errorf(
-								"failed set environment variable for paramenter %s in block %s, %s",
-								key, config.Type, err,
-							)
-						}
-
-						paramenters = append(paramenters, envTyping(newValue))
-					}
+	for index, item := range config.Parameter {
+		for key, value := range item {
+			location := joinPath(path, key)
 
-					config.Parameter[index][key] = paramenters
+			switch v := value.(type) {
+			case string:
+				result, err := evaluate(v, location)
+				if err != nil {
+					return err
 				}
-			}
-		}
-	}
 
-	if len(config.Block) > 0 {
-		for index := range config.Block {
-			err := setEnvVar(&config.Block[index], filePath, envVars)
-			if err != nil {
-				return err
-			}
-		}
-	}
+				config.Parameter[index][key] = result
+			case pkg.HCLExpression:
+				// The variables are replaced in the text of the expression.
+				result, variables, err := resolver.Replace(string(v))
+				if err != nil {
+					return fmt.Errorf("failed to replace environment variables in %s, %s", location, err)
+				}
 
-	return nil
-}
+				for _, variable := range variables {
+					*missing = append(*missing, missingEnvVar{variable: variable, location: location})
+				}
 
-// Searches for an environment variable with the "PRISM_" key
-// and replace it with the value of a variable found in the local environment,
-// a file with variables, or specified in the deployment command flag.
-func replaceEnvVar(
-	origin, path string,
-	envVars map[string]string,
-	format, defFormat *regexp.Regexp,
-) (string, error) {
-	envGroup := format.FindAllStringSubmatch(origin, -1)
-
-	for _, item := range envGroup {
-		missingDefaultValue := true
-
-		// Finding a variable by key "PRISM_".
-		value, err := getEnv(item[1], path)
-		if err != nil {
-			return "", err
-		}
+				config.Parameter[index][key] = pkg.HCLExpression(result)
+			case []interface{}:
+				parameters := make([]interface{}, 0, len(v))
 
-		// Finding a variable by key "PRISM_", with default value.
-		if value == nil {
-			value, err = getEnv(item[4], path)
-			if err != nil {
-				return "", err
-			}
-		}
+				for _, element := range v {
+					text, ok := element.(string)
+					if !ok {
+						parameters = append(parameters, element)
+						continue
+					}
 
-		// Set the env variable from the set flags.
-		if len(envVars) > 0 {
-			for k, v := range envVars {
-				if k == fmt.Sprint(item[1], item[4]) {
-					value = v
-				}
-			}
-		}
+					result, err := evaluate(text, location)
+					if err != nil {
+						return err
+					}
 
-		// Replacing variables with values.
-		if value != nil {
-			// Environment variable.
-			origin = strings.Replace(origin, item[0], fmt.Sprint(value), -1)
-		} else {
-			// Default value.
-			envDefaultGroup := defFormat.FindAllStringSubmatch(item[0], -1)
-
-			for _, defaultItem := range envDefaultGroup {
-				origin = strings.Replace(origin, item[0], defaultItem[1], -1)
-				missingDefaultValue = false
-			}
-		}
+					// The list expression is expanded into the elements.
+					if list, ok := result.([]interface{}); ok {
+						parameters = append(parameters, list...)
+						continue
+					}
 
-		// If the variable is not found, add it to the list of not found to display an error.
-		if value == nil && missingDefaultValue {
-			mEnv := fmt.Sprint(item[1], item[4])
+					parameters = append(parameters, result)
+				}
 
-			if !slices.Contains(missingEnvVars, mEnv) {
-				missingEnvVars = append(missingEnvVars, mEnv)
+				config.Parameter[index][key] = parameters
 			}
 		}
 	}
 
-	return origin, nil
-}
-
-// Checking the value type of a variable.
-// Returns string, int, float32, float64, bool.
-func envTyping(value string) any {
-	var a any
-
-	if v, err := strconv.Atoi(value); err == nil {
-		a = v
-	} else if v, err := strconv.ParseBool(value); err == nil {
-		a = v
-	} else if v, err := strconv.ParseFloat(value, 32); err == nil {
-		a = v
-	} else if v, err := strconv.ParseFloat(value, 64); err == nil {
-		a = v
-	} else {
-		return value
-	}
-
-	return a
-}
-
-// Search for an environment variable in a file or local environment.
-// Priority is given to the variables specified in the file,
-// i.e. if a variable is specified both in the local environment
-// and in a file at the same time,
-// the value will be taken from the variable specified in the file.
-func getEnv(name, filePath string) (interface{}, error) {
-	var envValue interface{}
-	vp := viper.New()
-
-	// Get environment variable from file.
-	if filePath != "" {
-		vp.SetConfigFile(filePath)
-
-		err := vp.ReadInConfig()
+	for index := range config.Block {
+		err := setEnvVar(&config.Block[index], resolver, path, missing)
 		if err != nil {
-			return nil, fmt.Errorf("error get env %s, %s", name, err)
+			return err
 		}
+	}
 
-		envValue = vp.Get(name)
+	return nil
+}
 
-		if envValue != nil {
-			return envValue, nil
-		}
+// Returns the location of the block or parameter in the configuration.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
 	}
 
-	// If the environment variable is not in the file,
-	// try to find it in the local environment.
-	vp.AutomaticEnv()
-	envValue = vp.Get(name)
-
-	return envValue, nil
+	return path + "." + key
 }
@@ -0,0 +1,200 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"prism/internal/model"
+	"prism/internal/service/parser"
+	"prism/pkg"
+	"slices"
+	"strings"
+)
+
+// Default delimiters of the local rendering of the template files,
+// the Nomad template syntax {{ }} is kept in the files.
+const (
+	renderLeftDelimiter  = "[["
+	renderRightDelimiter = "]]"
+)
+
+// Replaces the template blocks in which the file is a glob pattern with
+// a template block for each matched file. The destination of the block
+// is the directory of the files, the file name is added to it.
+func expandTemplateGlobs(
+	blocks []model.TemplateBlock,
+	dirPaths []string,
+) []model.TemplateBlock {
+	var result []model.TemplateBlock
+
+	for _, item := range blocks {
+		pattern, ok := parameterValue(item, "file").(string)
+		if item.Type != "template" || !ok || !strings.ContainsAny(pattern, "*?[") {
+			result = append(result, item)
+			continue
+		}
+
+		matches, err := globTemplateFiles(dirPaths, pattern)
+		if err != nil {
+			fmt.Printf("error read template files - %v\n", err)
+			os.Exit(1)
+		}
+
+		destination, _ := parameterValue(item, "destination").(string)
+
+		for _, match := range matches {
+			expanded := copyTemplateBlock(item)
+
+			setParameterValue(&expanded, "file", match)
+			setParameterValue(&expanded, "destination", path.Join(destination, filepath.Base(match)))
+
+			result = append(result, expanded)
+		}
+	}
+
+	return result
+}
+
+// Returns the files matching the pattern, sorted by name. A pattern without
+// a directory is matched in the files directories, the files of the pack
+// take precedence over the files of the parent packs with the same name.
+func globTemplateFiles(dirPaths []string, pattern string) ([]string, error) {
+	var matches []string
+
+	if strings.ContainsAny(pattern, `\/`) {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s, %s", pattern, err)
+		}
+
+		matches = files
+	} else {
+		var names []string
+
+		for _, dirPath := range dirPaths {
+			files, err := filepath.Glob(filepath.Join(dirPath, pattern))
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s, %s", pattern, err)
+			}
+
+			for _, file := range files {
+				if !slices.Contains(names, filepath.Base(file)) {
+					names = append(names, filepath.Base(file))
+					matches = append(matches, file)
+				}
+			}
+		}
+	}
+
+	var result []string
+
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+			result = append(result, match)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no files match the pattern %s", pattern)
+	}
+
+	slices.SortFunc(result, func(a, b string) int {
+		return strings.Compare(filepath.Base(a), filepath.Base(b))
+	})
+
+	return result, nil
+}
+
+// Renders the file of the template block as a Go template, if the render
+// parameter of the block is enabled. The file is rendered with the render
+// delimiters, [[ ]] by default.
+func renderTemplateFile(
+	block *model.TemplateBlock,
+	filePath string,
+	file []byte,
+	data model.TemplateData,
+) []byte {
+	render := parameterValue(*block, "render")
+	if render != true && render != "true" {
+		return file
+	}
+
+	left, ok := parameterValue(*block, "render_left_delimiter").(string)
+	if !ok || left == "" {
+		left = renderLeftDelimiter
+	}
+
+	right, ok := parameterValue(*block, "render_right_delimiter").(string)
+	if !ok || right == "" {
+		right = renderRightDelimiter
+	}
+
+	content, err := parser.RenderTemplateDelims(filepath.Base(filePath), file, data, left, right)
+	if err != nil {
+		fmt.Printf("failed to render template file %s, %s\n", filePath, err)
+		os.Exit(1)
+	}
+
+	return content
+}
+
+// Removes the parameters of the local rendering from the template block.
+func removeRenderParameters(block *model.TemplateBlock) {
+	for _, name := range []string{"render", "render_left_delimiter", "render_right_delimiter"} {
+		pkg.RemoveParameter(block, name)
+	}
+}
+
+// Returns the value of the parameter of the block.
+func parameterValue(block model.TemplateBlock, name string) interface{} {
+	for _, item := range block.Parameter {
+		if value, ok := item[name]; ok {
+			return value
+		}
+	}
+
+	return nil
+}
+
+// Sets the value of the parameter of the block.
+func setParameterValue(block *model.TemplateBlock, name string, value interface{}) {
+	for _, item := range block.Parameter {
+		if _, ok := item[name]; ok {
+			item[name] = value
+			return
+		}
+	}
+
+	block.Parameter = append(block.Parameter, map[string]interface{}{name: value})
+}
+
+// Returns a copy of the block with its parameters and nested blocks.
+func copyTemplateBlock(block model.TemplateBlock) model.TemplateBlock {
+	result := model.TemplateBlock{
+		Type:  block.Type,
+		Label: block.Label,
+	}
+
+	for _, item := range block.Parameter {
+		parameter := make(map[string]interface{}, len(item))
+
+		for key, value := range item {
+			parameter[key] = value
+		}
+
+		result.Parameter = append(result.Parameter, parameter)
+	}
+
+	for _, item := range block.Block {
+		result.Block = append(result.Block, copyTemplateBlock(item))
+	}
+
+	return result
+}
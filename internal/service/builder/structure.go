@@ -11,8 +11,6 @@ import (
 	"prism/pkg"
 )
 
-var blockBuilder BlockBuilder
-
 type StructureBuilder struct {
 	blockBuilder BlockBuilder
 }
@@ -25,8 +23,7 @@ func NewStructureBuilder(blockBuilder BlockBuilder) *StructureBuilder {
 func (s *StructureBuilder) BuildConfigStructure(
 	buildStructure model.BuildStructure,
 ) model.TemplateBlock {
-	blockBuilder = s.blockBuilder
-	return jobStructure(buildStructure.Config)
+	return s.jobStructure(buildStructure.Config)
 }
 
 // Get configuration block by nomad block name.
@@ -62,34 +59,34 @@ func getConfigBlock(
 	return block
 }
 
-func jobStructure(config model.ConfigBlock) model.TemplateBlock {
-	job := blockBuilder.Job(config)
+func (s *StructureBuilder) jobStructure(config model.ConfigBlock) model.TemplateBlock {
+	job := s.blockBuilder.Job(config)
 
 	configBlock := make(
 		map[string]func(model.ConfigBlock) model.TemplateBlock,
 	)
 
-	configBlock["affinity"] = blockBuilder.Affinity
-	configBlock["constraint"] = blockBuilder.Constraint
-	configBlock["meta"] = blockBuilder.Meta
-	configBlock["parameterized"] = blockBuilder.Parameterized
-	configBlock["periodic"] = blockBuilder.Periodic
-	configBlock["migrate"] = blockBuilder.Migrate
-	configBlock["reschedule"] = blockBuilder.Reschedule
-	configBlock["update"] = blockBuilder.Update
-	configBlock["vault"] = blockBuilder.Vault
+	configBlock["affinity"] = s.blockBuilder.Affinity
+	configBlock["constraint"] = s.blockBuilder.Constraint
+	configBlock["meta"] = s.blockBuilder.Meta
+	configBlock["parameterized"] = s.blockBuilder.Parameterized
+	configBlock["periodic"] = s.blockBuilder.Periodic
+	configBlock["migrate"] = s.blockBuilder.Migrate
+	configBlock["reschedule"] = s.blockBuilder.Reschedule
+	configBlock["update"] = s.blockBuilder.Update
+	configBlock["vault"] = s.blockBuilder.Vault
 
 	blockList := getConfigBlock(config, configBlock)
 	job.Block = append(job.Block, blockList...)
 
 	// multiregion, set job block.
-	multiregion := multiregionStructure(config)
+	multiregion := s.multiregionStructure(config)
 	if len(multiregion.Block) != 0 {
 		job.Block = append(job.Block, multiregion)
 	}
 
 	// spread, set job block.
-	spread := spreadStructure(config)
+	spread := s.spreadStructure(config)
 	if len(spread.Block) != 0 {
 		job.Block = append(job.Block, spread)
 	}
@@ -97,7 +94,7 @@ func jobStructure(config model.ConfigBlock) model.TemplateBlock {
 	// group.
 	for _, block := range config.Block {
 		if block.Type == "group" {
-			group := groupStructure(block)
+			group := s.groupStructure(block)
 			job.Block = append(job.Block, group)
 		}
 	}
@@ -105,7 +102,7 @@ func jobStructure(config model.ConfigBlock) model.TemplateBlock {
 	return job
 }
 
-func multiregionStructure(config model.ConfigBlock) model.TemplateBlock {
+func (s *StructureBuilder) multiregionStructure(config model.ConfigBlock) model.TemplateBlock {
 	var multiregionBlock []model.ConfigBlock
 
 	for _, block := range config.Block {
@@ -127,27 +124,27 @@ func multiregionStructure(config model.ConfigBlock) model.TemplateBlock {
 		Block: multiregionBlock,
 	}
 
-	multiregion := blockBuilder.Multiregion(multiregionConfig)
+	multiregion := s.blockBuilder.Multiregion(multiregionConfig)
 	return multiregion
 }
 
-func groupStructure(config model.ConfigBlock) model.TemplateBlock {
-	group := blockBuilder.Group(config)
+func (s *StructureBuilder) groupStructure(config model.ConfigBlock) model.TemplateBlock {
+	group := s.blockBuilder.Group(config)
 
 	configBlock := make(
 		map[string]func(model.ConfigBlock) model.TemplateBlock,
 	)
 
-	configBlock["affinity"] = blockBuilder.Affinity
-	configBlock["consul"] = blockBuilder.Consul
-	configBlock["constraint"] = blockBuilder.Constraint
-	configBlock["meta"] = blockBuilder.Meta
-	configBlock["restart"] = blockBuilder.Restart
-	configBlock["vault"] = blockBuilder.Vault
-	configBlock["ephemeral_disk"] = blockBuilder.EphemeralDisk
-	configBlock["migrate"] = blockBuilder.Migrate
-	configBlock["reschedule"] = blockBuilder.Reschedule
-	configBlock["update"] = blockBuilder.Update
+	configBlock["affinity"] = s.blockBuilder.Affinity
+	configBlock["consul"] = s.blockBuilder.Consul
+	configBlock["constraint"] = s.blockBuilder.Constraint
+	configBlock["meta"] = s.blockBuilder.Meta
+	configBlock["restart"] = s.blockBuilder.Restart
+	configBlock["vault"] = s.blockBuilder.Vault
+	configBlock["ephemeral_disk"] = s.blockBuilder.EphemeralDisk
+	configBlock["migrate"] = s.blockBuilder.Migrate
+	configBlock["reschedule"] = s.blockBuilder.Reschedule
+	configBlock["update"] = s.blockBuilder.Update
 
 	group.Block = append(
 		group.Block,
@@ -157,7 +154,7 @@ func groupStructure(config model.ConfigBlock) model.TemplateBlock {
 	// scaling.
 	for _, block := range config.Block {
 		if block.Type == "scaling" {
-			scaling := blockBuilder.Scaling(block)
+			scaling := s.blockBuilder.Scaling(block)
 
 			if len(scaling.Parameter) != 0 || len(scaling.Block) != 0 {
 				group.Block = append(group.Block, scaling)
@@ -168,7 +165,7 @@ func groupStructure(config model.ConfigBlock) model.TemplateBlock {
 	// volume block.
 	for _, block := range config.Block {
 		if block.Type == "volume" {
-			volume := blockBuilder.Volume(block)
+			volume := s.blockBuilder.Volume(block)
 
 			if len(volume.Parameter) != 0 || len(volume.Block) != 0 {
 				group.Block = append(group.Block, volume)
@@ -179,7 +176,7 @@ func groupStructure(config model.ConfigBlock) model.TemplateBlock {
 	// service block.
 	for _, block := range config.Block {
 		if block.Type == "service" {
-			service := serviceStructure(block)
+			service := s.serviceStructure(block)
 
 			if len(service.Parameter) != 0 || len(service.Block) != 0 {
 				group.Block = append(group.Block, service)
@@ -190,7 +187,7 @@ func groupStructure(config model.ConfigBlock) model.TemplateBlock {
 	// task block.
 	for _, block := range config.Block {
 		if block.Type == "task" {
-			task := taskStructure(block)
+			task := s.taskStructure(block)
 
 			if len(task.Parameter) != 0 || len(task.Block) != 0 {
 				group.Block = append(group.Block, task)
@@ -199,13 +196,13 @@ func groupStructure(config model.ConfigBlock) model.TemplateBlock {
 	}
 
 	// network, set group block.
-	network := networkStructure(config)
+	network := s.networkStructure(config)
 	if len(network.Parameter) != 0 || len(network.Block) != 0 {
 		group.Block = append(group.Block, network)
 	}
 
 	// spread, set group block.
-	spread := spreadStructure(config)
+	spread := s.spreadStructure(config)
 	if len(spread.Block) != 0 {
 		group.Block = append(group.Block, network)
 	}
@@ -213,7 +210,7 @@ func groupStructure(config model.ConfigBlock) model.TemplateBlock {
 	return group
 }
 
-func spreadStructure(config model.ConfigBlock) model.TemplateBlock {
+func (s *StructureBuilder) spreadStructure(config model.ConfigBlock) model.TemplateBlock {
 	var spreadParameter []map[string]interface{}
 	var spreadBlock []model.ConfigBlock
 
@@ -239,11 +236,11 @@ func spreadStructure(config model.ConfigBlock) model.TemplateBlock {
 		Block:     spreadBlock,
 	}
 
-	spread := blockBuilder.Spread(spreadConfig)
+	spread := s.blockBuilder.Spread(spreadConfig)
 	return spread
 }
 
-func networkStructure(config model.ConfigBlock) model.TemplateBlock {
+func (s *StructureBuilder) networkStructure(config model.ConfigBlock) model.TemplateBlock {
 	var networkParameter []map[string]interface{}
 	var networkBlock []model.ConfigBlock
 
@@ -269,30 +266,30 @@ func networkStructure(config model.ConfigBlock) model.TemplateBlock {
 		Block:     networkBlock,
 	}
 
-	network := blockBuilder.Network(networkConfig)
+	network := s.blockBuilder.Network(networkConfig)
 	return network
 }
 
-func taskStructure(config model.ConfigBlock) model.TemplateBlock {
-	task := blockBuilder.Task(config)
+func (s *StructureBuilder) taskStructure(config model.ConfigBlock) model.TemplateBlock {
+	task := s.blockBuilder.Task(config)
 
 	configBlock := make(
 		map[string]func(model.ConfigBlock) model.TemplateBlock,
 	)
 
-	configBlock["artifact"] = blockBuilder.Artifact
-	configBlock["affinity"] = blockBuilder.Affinity
-	configBlock["consul"] = blockBuilder.Consul
-	configBlock["constraint"] = blockBuilder.Constraint
-	configBlock["csi_plugin"] = blockBuilder.CSIPlugin
-	configBlock["dispatch_payload"] = blockBuilder.DispatchPayload
-	configBlock["env"] = blockBuilder.Env
-	configBlock["identity"] = blockBuilder.Identity
-	configBlock["lifecycle"] = blockBuilder.Lifecycle
-	configBlock["logs"] = blockBuilder.Logs
-	configBlock["meta"] = blockBuilder.Meta
-	configBlock["restart"] = blockBuilder.Restart
-	configBlock["vault"] = blockBuilder.Vault
+	configBlock["artifact"] = s.blockBuilder.Artifact
+	configBlock["affinity"] = s.blockBuilder.Affinity
+	configBlock["consul"] = s.blockBuilder.Consul
+	configBlock["constraint"] = s.blockBuilder.Constraint
+	configBlock["csi_plugin"] = s.blockBuilder.CSIPlugin
+	configBlock["dispatch_payload"] = s.blockBuilder.DispatchPayload
+	configBlock["env"] = s.blockBuilder.Env
+	configBlock["identity"] = s.blockBuilder.Identity
+	configBlock["lifecycle"] = s.blockBuilder.Lifecycle
+	configBlock["logs"] = s.blockBuilder.Logs
+	configBlock["meta"] = s.blockBuilder.Meta
+	configBlock["restart"] = s.blockBuilder.Restart
+	configBlock["vault"] = s.blockBuilder.Vault
 
 	task.Block = append(
 		task.Block,
@@ -302,7 +299,7 @@ func taskStructure(config model.ConfigBlock) model.TemplateBlock {
 	// scaling.
 	for _, block := range config.Block {
 		if block.Type == "scaling" {
-			scaling := blockBuilder.Scaling(block)
+			scaling := s.blockBuilder.Scaling(block)
 
 			if len(scaling.Parameter) != 0 || len(scaling.Block) != 0 {
 				task.Block = append(task.Block, scaling)
@@ -313,7 +310,7 @@ func taskStructure(config model.ConfigBlock) model.TemplateBlock {
 	// volume mount.
 	for _, block := range config.Block {
 		if block.Type == "volume_mount" {
-			volumeMount := blockBuilder.VolumeMount(block)
+			volumeMount := s.blockBuilder.VolumeMount(block)
 
 			if len(volumeMount.Parameter) != 0 || len(volumeMount.Block) != 0 {
 				task.Block = append(task.Block, volumeMount)
@@ -324,7 +321,7 @@ func taskStructure(config model.ConfigBlock) model.TemplateBlock {
 	// template.
 	for _, block := range config.Block {
 		if block.Type == "template" {
-			template := templateStructure(block)
+			template := s.templateStructure(block)
 
 			if len(template.Parameter) != 0 || len(template.Block) != 0 {
 				task.Block = append(task.Block, template)
@@ -335,7 +332,7 @@ func taskStructure(config model.ConfigBlock) model.TemplateBlock {
 	// service.
 	for _, block := range config.Block {
 		if block.Type == "service" {
-			service := serviceStructure(block)
+			service := s.serviceStructure(block)
 
 			if len(service.Parameter) != 0 || len(service.Block) != 0 {
 				task.Block = append(task.Block, service)
@@ -345,7 +342,7 @@ func taskStructure(config model.ConfigBlock) model.TemplateBlock {
 
 	// resources.
 	resourcesConfig := getBlockByType("resources", config)
-	resources := resourcesStructure(resourcesConfig)
+	resources := s.resourcesStructure(resourcesConfig)
 
 	if len(resources.Parameter) != 0 || len(resources.Block) != 0 {
 		task.Block = append(task.Block, resources)
@@ -354,15 +351,15 @@ func taskStructure(config model.ConfigBlock) model.TemplateBlock {
 	return task
 }
 
-func templateStructure(config model.ConfigBlock) model.TemplateBlock {
-	template := blockBuilder.Template(config)
+func (s *StructureBuilder) templateStructure(config model.ConfigBlock) model.TemplateBlock {
+	template := s.blockBuilder.Template(config)
 
 	// change script.
 	configBlock := make(
 		map[string]func(model.ConfigBlock) model.TemplateBlock,
 	)
 
-	configBlock["change_script"] = blockBuilder.ChangeScript
+	configBlock["change_script"] = s.blockBuilder.ChangeScript
 
 	template.Block = append(
 		template.Block,
@@ -372,13 +369,13 @@ func templateStructure(config model.ConfigBlock) model.TemplateBlock {
 	return template
 }
 
-func serviceStructure(config model.ConfigBlock) model.TemplateBlock {
-	service := blockBuilder.Service(config)
+func (s *StructureBuilder) serviceStructure(config model.ConfigBlock) model.TemplateBlock {
+	service := s.blockBuilder.Service(config)
 
 	// check.
 	for _, block := range config.Block {
 		if block.Type == "check" {
-			check := checkStructure(block)
+			check := s.checkStructure(block)
 
 			if len(check.Parameter) != 0 || len(check.Block) != 0 {
 				service.Block = append(service.Block, check)
@@ -391,7 +388,7 @@ func serviceStructure(config model.ConfigBlock) model.TemplateBlock {
 		map[string]func(model.ConfigBlock) model.TemplateBlock,
 	)
 
-	configBlock["check_restart"] = blockBuilder.CheckRestart
+	configBlock["check_restart"] = s.blockBuilder.CheckRestart
 
 	service.Block = append(
 		service.Block,
@@ -400,7 +397,7 @@ func serviceStructure(config model.ConfigBlock) model.TemplateBlock {
 
 	// connect.
 	connectConfig := getBlockByType("connect", config)
-	connect := connectStructure(connectConfig)
+	connect := s.connectStructure(connectConfig)
 
 	if len(connect.Parameter) != 0 || len(connect.Block) != 0 {
 		service.Block = append(service.Block, connect)
@@ -409,15 +406,15 @@ func serviceStructure(config model.ConfigBlock) model.TemplateBlock {
 	return service
 }
 
-func checkStructure(config model.ConfigBlock) model.TemplateBlock {
-	check := blockBuilder.Check(config)
+func (s *StructureBuilder) checkStructure(config model.ConfigBlock) model.TemplateBlock {
+	check := s.blockBuilder.Check(config)
 
 	// check restart.
 	configBlock := make(
 		map[string]func(model.ConfigBlock) model.TemplateBlock,
 	)
 
-	configBlock["check_restart"] = blockBuilder.CheckRestart
+	configBlock["check_restart"] = s.blockBuilder.CheckRestart
 
 	check.Block = append(
 		check.Block,
@@ -427,8 +424,8 @@ func checkStructure(config model.ConfigBlock) model.TemplateBlock {
 	return check
 }
 
-func connectStructure(config model.ConfigBlock) model.TemplateBlock {
-	connect := blockBuilder.Connect(config)
+func (s *StructureBuilder) connectStructure(config model.ConfigBlock) model.TemplateBlock {
+	connect := s.blockBuilder.Connect(config)
 
 	for _, item := range connect.Parameter {
 		for k, v := range item {
@@ -453,7 +450,7 @@ func connectStructure(config model.ConfigBlock) model.TemplateBlock {
 
 	// sidecar service.
 	sidecarServiceConfig := getBlockByType("sidecar_service", config)
-	sidecarService := sidecarServiceStructure(sidecarServiceConfig)
+	sidecarService := s.sidecarServiceStructure(sidecarServiceConfig)
 
 	if len(sidecarService.Parameter) != 0 || len(sidecarService.Block) != 0 {
 		connect.Block = append(connect.Block, sidecarService)
@@ -461,7 +458,7 @@ func connectStructure(config model.ConfigBlock) model.TemplateBlock {
 
 	// sidecar task.
 	sidecarTaskConfig := getBlockByType("sidecar_task", config)
-	sidecarTask := sidecarTaskStructure(sidecarTaskConfig)
+	sidecarTask := s.sidecarTaskStructure(sidecarTaskConfig)
 
 	if len(sidecarTask.Parameter) != 0 || len(sidecarTask.Block) != 0 {
 		connect.Block = append(connect.Block, sidecarTask)
@@ -472,7 +469,7 @@ func connectStructure(config model.ConfigBlock) model.TemplateBlock {
 		map[string]func(model.ConfigBlock) model.TemplateBlock,
 	)
 
-	configBlock["gateway"] = blockBuilder.Gateway
+	configBlock["gateway"] = s.blockBuilder.Gateway
 
 	connect.Block = append(
 		connect.Block,
@@ -482,12 +479,12 @@ func connectStructure(config model.ConfigBlock) model.TemplateBlock {
 	return connect
 }
 
-func sidecarServiceStructure(config model.ConfigBlock) model.TemplateBlock {
-	sidecarService := blockBuilder.SidecarService(config)
+func (s *StructureBuilder) sidecarServiceStructure(config model.ConfigBlock) model.TemplateBlock {
+	sidecarService := s.blockBuilder.SidecarService(config)
 
 	// proxy.
 	proxyConfig := getBlockByType("proxy", config)
-	proxy := proxyStructure(proxyConfig)
+	proxy := s.proxyStructure(proxyConfig)
 
 	if len(proxy.Parameter) != 0 || len(proxy.Block) != 0 {
 		sidecarService.Block = append(sidecarService.Block, proxy)
@@ -496,16 +493,16 @@ func sidecarServiceStructure(config model.ConfigBlock) model.TemplateBlock {
 	return sidecarService
 }
 
-func proxyStructure(config model.ConfigBlock) model.TemplateBlock {
-	proxy := blockBuilder.Proxy(config)
+func (s *StructureBuilder) proxyStructure(config model.ConfigBlock) model.TemplateBlock {
+	proxy := s.blockBuilder.Proxy(config)
 
 	// expose, upstreams.
 	configBlock := make(
 		map[string]func(model.ConfigBlock) model.TemplateBlock,
 	)
 
-	configBlock["expose"] = blockBuilder.Expose
-	configBlock["upstreams"] = blockBuilder.Upstreams
+	configBlock["expose"] = s.blockBuilder.Expose
+	configBlock["upstreams"] = s.blockBuilder.Upstreams
 
 	proxy.Block = append(
 		proxy.Block,
@@ -515,15 +512,15 @@ func proxyStructure(config model.ConfigBlock) model.TemplateBlock {
 	return proxy
 }
 
-func sidecarTaskStructure(config model.ConfigBlock) model.TemplateBlock {
-	sidecarTask := blockBuilder.SidecarTask(config)
+func (s *StructureBuilder) sidecarTaskStructure(config model.ConfigBlock) model.TemplateBlock {
+	sidecarTask := s.blockBuilder.SidecarTask(config)
 
 	// logs.
 	configBlock := make(
 		map[string]func(model.ConfigBlock) model.TemplateBlock,
 	)
 
-	configBlock["logs"] = blockBuilder.Logs
+	configBlock["logs"] = s.blockBuilder.Logs
 
 	sidecarTask.Block = append(
 		sidecarTask.Block,
@@ -532,7 +529,7 @@ func sidecarTaskStructure(config model.ConfigBlock) model.TemplateBlock {
 
 	// resources.
 	resourcesConfig := getBlockByType("resources", config)
-	resources := resourcesStructure(resourcesConfig)
+	resources := s.resourcesStructure(resourcesConfig)
 
 	if len(resources.Parameter) != 0 || len(resources.Block) != 0 {
 		sidecarTask.Block = append(sidecarTask.Block, resources)
@@ -541,13 +538,13 @@ func sidecarTaskStructure(config model.ConfigBlock) model.TemplateBlock {
 	return sidecarTask
 }
 
-func resourcesStructure(config model.ConfigBlock) model.TemplateBlock {
-	resources := blockBuilder.Resources(config)
+func (s *StructureBuilder) resourcesStructure(config model.ConfigBlock) model.TemplateBlock {
+	resources := s.blockBuilder.Resources(config)
 
 	// device.
 	for _, block := range config.Block {
 		if block.Type == "device" {
-			device := deviceStructure(block)
+			device := s.deviceStructure(block)
 
 			if len(device.Parameter) != 0 || len(device.Block) != 0 {
 				resources.Block = append(resources.Block, device)
@@ -559,20 +556,20 @@ func resourcesStructure(config model.ConfigBlock) model.TemplateBlock {
 		map[string]func(model.ConfigBlock) model.TemplateBlock,
 	)
 
-	configBlock["numa"] = blockBuilder.Numa
+	configBlock["numa"] = s.blockBuilder.Numa
 	resources.Block = append(resources.Block, getConfigBlock(config, configBlock)...)
 	return resources
 }
 
-func deviceStructure(config model.ConfigBlock) model.TemplateBlock {
-	device := blockBuilder.Device(config)
+func (s *StructureBuilder) deviceStructure(config model.ConfigBlock) model.TemplateBlock {
+	device := s.blockBuilder.Device(config)
 
 	configBlock := make(
 		map[string]func(model.ConfigBlock) model.TemplateBlock,
 	)
 
-	configBlock["affinity"] = blockBuilder.Affinity
-	configBlock["constraint"] = blockBuilder.Constraint
+	configBlock["affinity"] = s.blockBuilder.Affinity
+	configBlock["constraint"] = s.blockBuilder.Constraint
 	device.Block = append(device.Block, getConfigBlock(config, configBlock)...)
 	return device
 }
@@ -7,88 +7,407 @@
 package deployment
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"prism/internal/model"
+	"prism/internal/service/archive"
+	"prism/internal/service/registry"
+	"prism/internal/service/resolver"
 	"regexp"
-
-	"gopkg.in/yaml.v3"
+	"strings"
 )
 
-// Returns the configuration structure.
+// Returns the configuration structure of the jobs of the pack
+// and its dependencies with the transformers applied to each job.
 func (s *Deployment) CreateConfigStructure(
 	parameter model.ConfigParameter,
-) ([]model.TemplateBlock, error) {
-	var configList []model.TemplateBlock
+) ([]model.RenderedJob, error) {
+	var configList []model.RenderedJob
+
+	// Pack and the parent packs it extends.
+	packLayers, err := s.createLayers(parameter)
+	if err != nil {
+		return configList, err
+	}
+
+	parameter = packLayers.parameter
+	packConfig := &packLayers.pack
+	templateData := packLayers.templateData
 
-	// Pack.
-	packFileName := "pack.yaml"
-	packPath := filepath.Join(parameter.ProjectDirPath, packFileName)
+	// Job config of the root parent pack,
+	// the configs of the child packs are applied on top of it.
+	configStructure := packLayers.layers[0].Config
 
-	packFile, err := os.ReadFile(packPath)
+	var layerConfigs []model.TemplateBlock
+
+	for _, layer := range packLayers.layers[1:] {
+		layerConfigs = append(layerConfigs, layer.Config)
+	}
+
+	// Set changes.
+	config, err := s.SetChanges(
+		packLayers.filesDirPaths,
+		parameter,
+		packConfig,
+		configStructure,
+		packLayers.configFile,
+		layerConfigs,
+		packLayers.resolver,
+	)
 	if err != nil {
-		return configList, fmt.Errorf("error to read pack file, %s", err)
+		return configList, err
 	}
 
-	var packConfig = &model.Pack{}
+	job := model.RenderedJob{Config: config}
 
-	err = yaml.Unmarshal([]byte(packFile), packConfig)
+	job.Variables, err = fileVariables(&job.Config, packLayers.filesDirPaths)
 	if err != nil {
-		return configList, fmt.Errorf("failed to parsing pack file, %s", err)
+		return configList, err
+	}
+
+	job.VariablesPath = variablesPath(job.Config.Label)
+
+	// Variable and locals blocks of the packs in the inheritance chain.
+	var layerDeclarations [][]model.TemplateBlock
+
+	for _, layer := range packLayers.layers {
+		layerDeclarations = append(layerDeclarations, layer.Declarations)
 	}
 
-	// Job config.
-	configFileName := "config.yaml"
-	configPath := filepath.Join(parameter.ProjectDirPath, configFileName)
-	filesPath := filepath.Join(parameter.ProjectDirPath, "files")
+	job.Declarations = mergeDeclarations(layerDeclarations)
 
-	configStructure, err := s.BuildConfigStructure(configPath, "job")
+	job.HCLVariables, err = s.hclVariables(job.Declarations, parameter)
 	if err != nil {
 		return configList, err
 	}
 
-	// Set changes.
-	config, err := s.SetChanges(filesPath, parameter, packConfig, configStructure)
+	err = s.transform(&job, packLayers.transformers, parameter, *packConfig)
+	if err != nil {
+		return configList, err
+	}
+
+	err = s.setDeployMeta(
+		&job.Config,
+		parameter.DeployMeta,
+		parameter.Release,
+		*packConfig,
+		parameter.ProjectDirPath,
+	)
 	if err != nil {
 		return configList, err
 	}
 
 	// Create dependencies configuration structure.
+	// Library packs are only used for partials and are not deployed.
 	if len(packConfig.Dependencies) > 0 {
 		for _, dependencyJob := range packConfig.Dependencies {
+			if dependencyJob.Library {
+				continue
+			}
+
+			dependencyPath := packLayers.dependencyPaths[dependencyJob.Name]
+
 			configFileName := "config.yaml"
-			configPath := filepath.Join(dependencyJob.Path, configFileName)
-			filesPath := filepath.Join(dependencyJob.Path, "files")
+			configPath := filepath.Join(dependencyPath, configFileName)
+			filesPath := filepath.Join(dependencyPath, "files")
+
+			// Values and overrides from the command line are applied only to the main pack,
+			// the dependency receives the values specified under its name.
+			dependencyParameter := parameter
+			dependencyParameter.Files = layerFiles(
+				dependencyJob.Files,
+				packLayers.filesDirPaths,
+			)
+			dependencyParameter.ValueFiles = nil
+			dependencyParameter.Values = nil
+			dependencyParameter.StringValues = nil
+			dependencyParameter.FileValues = nil
+			dependencyParameter.Overrides = nil
+			dependencyParameter.Patches = nil
+			dependencyParameter.HCLVars = nil
+			dependencyParameter.HCLVarFiles = nil
+
+			// Templating and transformers are enabled by the pack file of the dependency.
+			dependencyPack, err := readDependencyPack(dependencyPath)
+			if err != nil {
+				return configList, err
+			}
+
+			dependencyTemplateData, err := s.TemplateData(
+				[]string{dependencyPath},
+				dependencyPack,
+				dependencyParameter,
+				dependencyValues(templateData, dependencyJob.Name),
+			)
+
+			if err != nil {
+				return configList, err
+			}
+
+			dependencyConfigFile := model.ConfigFile{
+				Path:         configPath,
+				Include:      model.Include{PackDirPath: dependencyPath},
+				TemplateData: dependencyTemplateData,
+			}
+
+			configStructure, err := s.BuildConfigStructure(
+				dependencyConfigFile,
+				"job",
+				packLayers.resolver,
+			)
+
+			if err != nil {
+				return configList, err
+			}
+
+			config, err := s.SetChanges(
+				[]string{filesPath},
+				dependencyParameter,
+				packConfig,
+				configStructure,
+				dependencyConfigFile,
+				nil,
+				packLayers.resolver,
+			)
+			if err != nil {
+				return configList, err
+			}
+
+			dependencyJob := model.RenderedJob{Config: config}
+
+			dependencyJob.Variables, err = fileVariables(&dependencyJob.Config, []string{filesPath})
+			if err != nil {
+				return configList, err
+			}
+
+			dependencyJob.VariablesPath = variablesPath(dependencyJob.Config.Label)
+
+			dependencyJob.Declarations, err = s.BuildDeclarations(
+				dependencyConfigFile,
+				packLayers.resolver,
+			)
+			if err != nil {
+				return configList, err
+			}
 
-			configStructure, err := s.BuildConfigStructure(configPath, "job")
+			dependencyJob.HCLVariables, err = s.hclVariables(dependencyJob.Declarations, dependencyParameter)
 			if err != nil {
 				return configList, err
 			}
 
-			parameter.Files = dependencyJob.Files
+			err = s.transform(
+				&dependencyJob,
+				packTransformers(dependencyPack, dependencyPath),
+				dependencyParameter,
+				dependencyPack,
+			)
+
+			if err != nil {
+				return configList, err
+			}
 
-			config, err := s.SetChanges(filesPath, parameter, packConfig, configStructure)
+			err = s.setDeployMeta(
+				&dependencyJob.Config,
+				dependencyParameter.DeployMeta,
+				dependencyParameter.Release,
+				dependencyPack,
+				dependencyPath,
+			)
 			if err != nil {
 				return configList, err
 			}
 
-			configList = append(configList, config)
+			configList = append(configList, dependencyJob)
 		}
 	}
 
-	configList = append(configList, config)
+	configList = append(configList, job)
+
+	// The secrets are shared by the pack and the dependencies.
+	for index := range configList {
+		configList[index].Sensitive = packLayers.resolver.Sensitive()
+	}
+
 	return configList, nil
 }
 
+// Returns the pack file of the dependency,
+// if the dependency has no pack file, an empty pack is returned.
+func readDependencyPack(dependencyPath string) (model.Pack, error) {
+	_, err := os.Stat(filepath.Join(dependencyPath, "pack.yaml"))
+	if errors.Is(err, os.ErrNotExist) {
+		return model.Pack{}, nil
+	}
+
+	pack, err := readPack(dependencyPath)
+	if err != nil {
+		return pack, fmt.Errorf("failed to get dependency pack, %s", err)
+	}
+
+	return pack, nil
+}
+
+// Applies the transformers of the pack and the post-renderers
+// from the command line to the job.
+func (s *Deployment) transform(
+	job *model.RenderedJob,
+	transformers []model.Transformer,
+	parameter model.ConfigParameter,
+	pack model.Pack,
+) error {
+	job.Transformers = append(
+		append([]model.Transformer{}, transformers...),
+		parameter.PostRenderers...,
+	)
+
+	env := map[string]string{
+		"PRISM_RENDER_JOB":          job.Config.Label,
+		"PRISM_RENDER_RELEASE":      parameter.Release,
+		"PRISM_RENDER_NAMESPACE":    parameter.Namespace,
+		"PRISM_RENDER_PACK":         pack.Name,
+		"PRISM_RENDER_PACK_VERSION": pack.PackVersion,
+	}
+
+	err := s.transformer.Run(job, parameter.NomadConfig, parameter.Namespace, env)
+	if err != nil {
+		return fmt.Errorf("failed to transform job %s, %s", job.Config.Label, err)
+	}
+
+	return nil
+}
+
+// Returns the path to the local pack directory.
+// The pack can be specified as a directory, a pack archive
+// or an OCI reference, archives are extracted to the cache.
+// If verification is enabled, only signed archives are accepted.
+func (s *Deployment) PackPath(path string, verification model.Verification) (string, error) {
+	if registry.IsReference(path) {
+		archivePath, err := s.registry.Resolve(path)
+		if err != nil {
+			return "", err
+		}
+
+		return s.extractPack(archivePath, verification)
+	}
+
+	path = filepath.Join(path)
+
+	info, err := os.Stat(path)
+	if err == nil && !info.IsDir() && strings.HasSuffix(path, ".tgz") {
+		return s.extractPack(path, verification)
+	}
+
+	if verification.Enabled {
+		return "", fmt.Errorf(
+			"pack %s is not signed, only pack archives can be verified", path,
+		)
+	}
+
+	return path, nil
+}
+
+// Returns the path to the dependency pack directory.
+// If a repository is specified for the dependency,
+// the pack is downloaded from the repository.
+func (s *Deployment) DependencyPath(
+	dependency model.PackDependency,
+	verification model.Verification,
+) (string, error) {
+	if dependency.Repository == "" {
+		path, err := s.PackPath(dependency.Path, verification)
+		if err != nil {
+			return "", fmt.Errorf("failed to get dependency %s, %s", dependency.Name, err)
+		}
+
+		return path, nil
+	}
+
+	resolved, err := s.repository.Resolve(
+		dependency.Repository,
+		dependency.Name,
+		dependency.PackVersion,
+	)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to get dependency %s, %s", dependency.Name, err)
+	}
+
+	// Repository verification policy.
+	if resolved.Verification.Enabled {
+		verification.Enabled = true
+
+		if resolved.Verification.KeyringPath != "" {
+			verification.KeyringPath = resolved.Verification.KeyringPath
+		}
+	}
+
+	path, err := s.extractPack(resolved.ArchivePath, verification)
+	if err != nil {
+		return "", fmt.Errorf("failed to get dependency %s, %s", dependency.Name, err)
+	}
+
+	return path, nil
+}
+
+// Verifies the pack archive signature, if verification is enabled,
+// and extracts the archive to the cache.
+func (s *Deployment) extractPack(
+	archivePath string,
+	verification model.Verification,
+) (string, error) {
+	if verification.Enabled {
+		_, err := s.signature.Verify(archivePath, verification.KeyringPath)
+		if err != nil {
+			return "", fmt.Errorf("pack verification failed, %s", err)
+		}
+	}
+
+	digest, err := archive.Digest(archivePath)
+	if err != nil {
+		return "", err
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory, %s", err)
+	}
+
+	packDir := filepath.Join(
+		cacheDir,
+		"prism",
+		"packs",
+		strings.TrimPrefix(digest, "sha256:")[:12],
+	)
+
+	return s.archive.Extract(archivePath, packDir)
+}
+
+// Makes changes to the configuration. The configurations of the child packs
+// (layers) are applied first, then the files to update the configuration,
+// the overrides from the command line and the patches.
 func (s *Deployment) SetChanges(
-	filesDirPath string,
+	filesDirPaths []string,
 	parameter model.ConfigParameter,
 	packConfig *model.Pack,
 	config model.TemplateBlock,
+	configFile model.ConfigFile,
+	layers []model.TemplateBlock,
+	resolver *resolver.Resolver,
 ) (model.TemplateBlock, error) {
 	// Parsing files.
-	var files []model.TemplateBlock
+	files := append([]model.TemplateBlock{}, layers...)
+	base := configFile.Base
+
+	if len(parameter.Files) > 0 && base == nil {
+		content, err := s.ReadFile(configFile)
+		if err != nil {
+			return config, fmt.Errorf("parse error, %s", err)
+		}
+
+		base = content
+	}
 
 	for _, file := range parameter.Files {
 		file = filepath.Join(file)
@@ -98,7 +417,12 @@ func (s *Deployment) SetChanges(
 			return config, fmt.Errorf("could not verify file name, %s", err)
 		}
 
-		fileConfigStructure, err := s.BuildConfigStructure(fileFullPath, "job")
+		// Update files use the includes and anchors of the job config.
+		fileConfig := configFile
+		fileConfig.Path = fileFullPath
+		fileConfig.Base = base
+
+		fileConfigStructure, err := s.BuildConfigStructure(fileConfig, "job", resolver)
 		if err != nil {
 			return config, err
 		}
@@ -106,15 +430,40 @@ func (s *Deployment) SetChanges(
 		files = append(files, fileConfigStructure)
 	}
 
+	// Command line overrides are applied after the files.
+	for _, override := range parameter.Overrides {
+		err := checkOverride(append([]model.TemplateBlock{config}, files...), override)
+		if err != nil {
+			return config, err
+		}
+
+		files = append(files, s.buildStructure("job", override.Config))
+	}
+
+	// Files of the template blocks are rendered with the data
+	// of the configuration templates, if templating is enabled.
+	templateData := model.TemplateData{
+		Release: model.TemplateRelease{
+			Name:      parameter.Release,
+			Namespace: parameter.Namespace,
+		},
+		Namespace: parameter.Namespace,
+		Pack:      *packConfig,
+	}
+
+	if configFile.TemplateData != nil {
+		templateData = *configFile.TemplateData
+	}
+
 	// Set changes.
 	changes := model.Changes{
-		Release:      parameter.Release,
-		Namespace:    parameter.Namespace,
-		Files:        files,
-		FilesDirPath: filesDirPath,
-		Pack:         *packConfig,
-		EnvFilePath:  parameter.EnvFilePath,
-		EnvVars:      parameter.EnvVars,
+		Release:       parameter.Release,
+		Namespace:     parameter.Namespace,
+		Files:         files,
+		FilesDirPaths: filesDirPaths,
+		Pack:          *packConfig,
+		Naming:        parameter.Naming,
+		TemplateData:  templateData,
 	}
 
 	err := s.changes.SetChanges(&config, &changes)
@@ -122,49 +471,122 @@ func (s *Deployment) SetChanges(
 		return config, fmt.Errorf("failed to make changes, %s", err)
 	}
 
+	// Patches are applied to the merged configuration,
+	// before the environment variables are replaced.
+	for _, file := range parameter.Patches {
+		_, fileFullPath, err := s.CheckFileName(filepath.Join(file), parameter.ProjectDirPath)
+		if err != nil {
+			return config, fmt.Errorf("could not verify file name, %s", err)
+		}
+
+		content, err := os.ReadFile(fileFullPath)
+		if err != nil {
+			return config, fmt.Errorf("failed to read patch file, %s", err)
+		}
+
+		err = s.patch.Apply(&config, content)
+		if err != nil {
+			return config, fmt.Errorf("failed to apply patch %s, %s", fileFullPath, err)
+		}
+	}
+
+	err = s.changes.ReplaceEnvVars(&config, resolver)
+	if err != nil {
+		return config, fmt.Errorf("failed to make changes, %s", err)
+	}
+
 	return config, nil
 }
 
 // Parsing the configuration file and creating a structured job configuration.
-func (s *Deployment) BuildConfigStructure(path, blockType string) (model.TemplateBlock, error) {
+// If template data is specified, the file is rendered as a template.
+// The $include, $if and $for_each directives are evaluated
+// before building the structure.
+func (s *Deployment) BuildConfigStructure(
+	file model.ConfigFile,
+	blockType string,
+	resolver *resolver.Resolver,
+) (model.TemplateBlock, error) {
 	var config model.TemplateBlock
+	path := file.Path
 
-	content, err := s.ParseFile(path)
+	content, err := s.ParseFile(file)
 	if err != nil {
 		return config, fmt.Errorf("parse error, %s", err)
 	}
 
-	parsedConfig := s.parser.ParseConfig(
-		blockType,
-		content["job"].(map[string]interface{}),
-	)
+	jobConfig, ok := content["job"].(map[string]interface{})
+	if !ok {
+		return config, fmt.Errorf("parse error, job block not found in file %s", path)
+	}
+
+	err = s.parser.ResolveIncludes(jobConfig, file.Include)
+	if err != nil {
+		return config, fmt.Errorf("failed to include partials in file %s, %s", path, err)
+	}
+
+	err = s.parser.EvaluateDirectives(jobConfig, resolver.Resolve)
+	if err != nil {
+		return config, fmt.Errorf("failed to evaluate directives in file %s, %s", path, err)
+	}
+
+	return s.buildStructure(blockType, jobConfig), nil
+}
+
+// Creating a structured job configuration from the job block of the config file.
+func (s *Deployment) buildStructure(
+	blockType string,
+	jobConfig map[string]interface{},
+) model.TemplateBlock {
+	parsedConfig := s.parser.ParseConfig(blockType, jobConfig)
 
 	buildStructure := model.BuildStructure{
 		Config: parsedConfig,
 	}
 
-	config = s.builder.BuildConfigStructure(buildStructure)
-	return config, nil
+	return s.builder.BuildConfigStructure(buildStructure)
 }
 
 // Read and parse file.
 // Returns the file contents, hierarchically sorted into blocks.
-func (s *Deployment) ParseFile(fileFullPath string) (map[string]interface{}, error) {
+func (s *Deployment) ParseFile(file model.ConfigFile) (map[string]interface{}, error) {
 	var parsedContent map[string]interface{}
 
-	content, err := os.ReadFile(fileFullPath)
+	content, err := s.ReadFile(file)
 	if err != nil {
 		return parsedContent, err
 	}
 
-	parsedContent, err = s.parser.ParseYAML(content)
+	parsedContent, err = s.parser.ParseOverlayYAML(content, file.Base)
 	if err != nil {
-		return parsedContent, fmt.Errorf("failed to parsing file %s, %s", fileFullPath, err)
+		return parsedContent, fmt.Errorf("failed to parsing file %s, %s", file.Path, err)
 	}
 
 	return parsedContent, nil
 }
 
+// Reads the file, if template data is specified, renders the file as a template.
+func (s *Deployment) ReadFile(file model.ConfigFile) ([]byte, error) {
+	content, err := os.ReadFile(file.Path)
+	if err != nil {
+		return content, err
+	}
+
+	if file.TemplateData != nil {
+		content, err = s.parser.RenderTemplate(
+			filepath.Base(file.Path),
+			content,
+			*file.TemplateData,
+		)
+
+		if err != nil {
+			return content, fmt.Errorf("failed to render file %s, %s", file.Path, err)
+		}
+	}
+
+	return content, nil
+}
+
 // Check the full file path or file name.
 func (s *Deployment) CheckFileName(
 	file, projectDirPath string,
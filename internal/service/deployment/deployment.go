@@ -9,8 +9,14 @@ package deployment
 import (
 	"fmt"
 	"prism/internal/model"
+	"prism/internal/service/archive"
 	"prism/internal/service/builder"
 	"prism/internal/service/parser"
+	"prism/internal/service/patch"
+	"prism/internal/service/registry"
+	"prism/internal/service/repository"
+	"prism/internal/service/signature"
+	"prism/internal/service/transformer"
 	"slices"
 	"time"
 
@@ -18,20 +24,34 @@ import (
 )
 
 type Deployment struct {
-	parser  parser.Parser
-	builder builder.StructureBuilder
-	changes builder.Changes
+	parser      parser.Parser
+	builder     builder.StructureBuilder
+	changes     builder.Changes
+	repository  repository.Repository
+	registry    registry.Registry
+	archive     archive.Archive
+	signature   signature.Signature
+	patch       patch.Patch
+	transformer transformer.Transformer
 }
 
 func NewDeployment(
 	parser parser.Parser,
 	builder builder.StructureBuilder,
 	changes builder.Changes,
+	repository repository.Repository,
+	registry registry.Registry,
 ) *Deployment {
 	return &Deployment{
-		parser:  parser,
-		builder: builder,
-		changes: changes,
+		parser:      parser,
+		builder:     builder,
+		changes:     changes,
+		repository:  repository,
+		registry:    registry,
+		archive:     *archive.NewArchive(),
+		signature:   *signature.NewSignature(),
+		patch:       *patch.NewPatch(),
+		transformer: *transformer.NewTransformer(),
 	}
 }
 
@@ -86,7 +106,11 @@ func (s *Deployment) CheckNamespace(namespace model.CheckNamespace) error {
 
 // Job configuration deployment in the nomad cluster.
 func (s *Deployment) Deployment(d model.Deployment) (string, error) {
-	jobConfig, err := d.Client.Jobs().ParseHCL(d.Config, true)
+	jobConfig, err := d.Client.Jobs().ParseHCLOpts(&api.JobsParseRequest{
+		JobHCL:       d.Config,
+		Variables:    d.HCLVariables,
+		Canonicalize: true,
+	})
 	if err != nil {
 		return d.JobName, fmt.Errorf("failed to parse hcl: %s", err)
 	}
@@ -95,6 +119,12 @@ func (s *Deployment) Deployment(d model.Deployment) (string, error) {
 		Namespace: d.Namespace,
 	}
 
+	// The files are written before the job, the tasks read them on start.
+	err = writeFileVariables(d)
+	if err != nil {
+		return *jobConfig.ID, err
+	}
+
 	_, _, err = d.Client.Jobs().Register(jobConfig, writeOptions)
 	if err != nil {
 		return *jobConfig.ID, fmt.Errorf("job registration error, %s", err)
@@ -187,7 +217,7 @@ func (s *Deployment) Deployment(d model.Deployment) (string, error) {
 									deploymentStatus, allocationStatus,
 								)
 
-								return jobName, nil
+								return jobName, pruneFileVariables(d, *jobConfig.ID)
 							}
 						}
 					}
@@ -0,0 +1,404 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package deployment
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"prism/internal/service/resolver"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Returns the environment variables referenced in the configuration files,
+// the files to update the configuration and the templates of the pack,
+// the packs it extends and its dependencies, sorted by name. The variables
+// are resolved with the sources of the render, the secrets are not read.
+func (s *Deployment) EnvVariables(parameter model.ConfigParameter) ([]model.EnvVariable, error) {
+	layers, err := s.packChain(parameter.ProjectDirPath, parameter.Verification)
+	if err != nil {
+		return nil, err
+	}
+
+	var filesDirPaths []string
+
+	for index := len(layers) - 1; index >= 0; index-- {
+		filesDirPaths = append(filesDirPaths, filepath.Join(layers[index].DirPath, "files"))
+	}
+
+	parameter.Files = layerFiles(parameter.Files, filesDirPaths)
+
+	parameter, err = releaseParameter(layers, parameter, filesDirPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	envResolver, err := resolver.NewEnvResolver(
+		parameter.EnvVars,
+		parameter.EnvFilePaths,
+		parameter.AgeIdentities,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileReferences []envReference
+	var scanned []string
+
+	// Scans the configuration files and the template files of their template blocks.
+	// The files are scanned once, also if they are used by several packs.
+	scan := func(paths, filesDirPaths []string) error {
+		isScanned := func(path string) (bool, error) {
+			absolutePath, err := filepath.Abs(path)
+			if err != nil {
+				return false, fmt.Errorf("failed to get file path %s, %s", path, err)
+			}
+
+			if slices.Contains(scanned, absolutePath) {
+				return true, nil
+			}
+
+			scanned = append(scanned, absolutePath)
+			return false, nil
+		}
+
+		for _, path := range paths {
+			ok, err := isScanned(path)
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				continue
+			}
+
+			references, templateFiles, err := scanConfigReferences(path)
+			if err != nil {
+				return err
+			}
+
+			fileReferences = append(fileReferences, references...)
+
+			for _, templateFile := range templateFiles {
+				templatePaths, err := templateFilePaths(filesDirPaths, templateFile)
+				if err != nil {
+					return err
+				}
+
+				for _, templatePath := range templatePaths {
+					ok, err := isScanned(templatePath)
+					if err != nil {
+						return err
+					}
+
+					if ok {
+						continue
+					}
+
+					references, err := scanEnvReferences(templatePath)
+					if err != nil {
+						return err
+					}
+
+					fileReferences = append(fileReferences, references...)
+				}
+			}
+		}
+
+		return nil
+	}
+
+	// Configuration files of the packs and the files of the release
+	// and the --file flag, in the order in which they are applied.
+	var paths []string
+
+	for _, layer := range layers {
+		configPath := filepath.Join(layer.DirPath, "config.yaml")
+
+		if _, err := os.Stat(configPath); err == nil {
+			paths = append(paths, configPath)
+		}
+	}
+
+	paths = append(paths, parameter.Files...)
+
+	err = scan(paths, filesDirPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Library packs are only used for partials, their configuration is not rendered.
+	for _, dependency := range inheritDependencies(layers) {
+		if dependency.Library {
+			continue
+		}
+
+		dependencyPath, err := s.DependencyPath(dependency, parameter.Verification)
+		if err != nil {
+			return nil, err
+		}
+
+		err = scan(
+			append(
+				[]string{filepath.Join(dependencyPath, "config.yaml")},
+				layerFiles(dependency.Files, filesDirPaths)...,
+			),
+			[]string{filepath.Join(dependencyPath, "files")},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var names []string
+	variables := make(map[string]*model.EnvVariable)
+	references := make(map[string][]resolver.Reference)
+
+	for _, item := range fileReferences {
+		variable, ok := variables[item.reference.Name]
+		if !ok {
+			variable = &model.EnvVariable{Name: item.reference.Name}
+			variables[item.reference.Name] = variable
+			names = append(names, item.reference.Name)
+		}
+
+		if item.reference.HasDefault && !slices.Contains(variable.Defaults, item.reference.Default) {
+			variable.Defaults = append(variable.Defaults, item.reference.Default)
+		}
+
+		if variable.Required == "" {
+			variable.Required = item.reference.Required
+		}
+
+		if !slices.Contains(variable.Usages, item.usage) {
+			variable.Usages = append(variable.Usages, item.usage)
+		}
+
+		references[item.reference.Name] = append(references[item.reference.Name], item.reference)
+	}
+
+	slices.Sort(names)
+
+	var result []model.EnvVariable
+
+	for _, name := range names {
+		variable := variables[name]
+		variable.Resolved = true
+
+		// The variable is resolved if each reference has a value.
+		for _, reference := range references[name] {
+			value, source, missing, err := envResolver.ReferenceValue(reference)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s, %s", name, err)
+			}
+
+			if len(missing) > 0 {
+				variable.Resolved = false
+				continue
+			}
+
+			if variable.Source == "" {
+				variable.Value = value
+				variable.Source = source
+			}
+		}
+
+		if !variable.Resolved {
+			variable.Value = ""
+			variable.Source = ""
+		}
+
+		result = append(result, *variable)
+	}
+
+	return result, nil
+}
+
+// Reference to the environment variable in the file.
+type envReference struct {
+	reference resolver.Reference
+	usage     model.EnvVariableUsage
+}
+
+// Returns the references to the environment variables in the values
+// and the keys of the configuration file and the template files of its
+// template blocks. The values are parsed, so the escapes of the quoted
+// strings are decoded. A file that is not valid YAML on its own (a template
+// or a file with the aliases of the base configuration) is scanned by lines.
+func scanConfigReferences(path string) ([]envReference, []string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file %s, %s", path, err)
+	}
+
+	var documents []*yaml.Node
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+
+	for {
+		var document yaml.Node
+
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			references, err := scanEnvReferences(path)
+			return references, nil, err
+		}
+
+		documents = append(documents, &document)
+	}
+
+	var result []envReference
+	var templateFiles []string
+
+	var walk func(node *yaml.Node) error
+
+	walk = func(node *yaml.Node) error {
+		switch node.Kind {
+		case yaml.ScalarNode:
+			references, err := resolver.References(node.Value)
+			if err != nil {
+				return fmt.Errorf("%s:%d, %s", path, node.Line, err)
+			}
+
+			for _, reference := range references {
+				result = append(result, envReference{
+					reference: reference,
+					usage:     model.EnvVariableUsage{Path: path, Line: node.Line},
+				})
+			}
+		case yaml.MappingNode:
+			for index := 0; index+1 < len(node.Content); index += 2 {
+				if node.Content[index].Value == "template" {
+					templateFiles = append(templateFiles, templateFileNames(node.Content[index+1])...)
+				}
+			}
+		}
+
+		// The values of the aliases are scanned with their anchors.
+		for _, child := range node.Content {
+			err := walk(child)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, document := range documents {
+		err := walk(document)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return result, templateFiles, nil
+}
+
+// Returns the files of the template blocks: the list of the blocks or one block.
+func templateFileNames(node *yaml.Node) []string {
+	blocks := []*yaml.Node{node}
+
+	if node.Kind == yaml.SequenceNode {
+		blocks = node.Content
+	}
+
+	var result []string
+
+	for _, block := range blocks {
+		if block.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for index := 0; index+1 < len(block.Content); index += 2 {
+			key, value := block.Content[index], block.Content[index+1]
+
+			if key.Value == "file" && value.Kind == yaml.ScalarNode && value.Value != "" {
+				result = append(result, value.Value)
+			}
+		}
+	}
+
+	return result
+}
+
+// Returns the paths to the template files matching the file name or the pattern.
+// A name without a directory is found in the files directories, the files
+// of the pack take precedence over the files of the parent packs.
+func templateFilePaths(filesDirPaths []string, pattern string) ([]string, error) {
+	if strings.ContainsAny(pattern, `\/`) {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find template files %s, %s", pattern, err)
+		}
+
+		return matches, nil
+	}
+
+	var result []string
+	var names []string
+
+	for _, dirPath := range filesDirPaths {
+		matches, err := filepath.Glob(filepath.Join(dirPath, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find template files %s, %s", pattern, err)
+		}
+
+		for _, match := range matches {
+			if slices.Contains(names, filepath.Base(match)) {
+				continue
+			}
+
+			names = append(names, filepath.Base(match))
+			result = append(result, match)
+		}
+	}
+
+	return result, nil
+}
+
+// Returns the references to the environment variables in the lines
+// of the template file. Binary files are skipped.
+func scanEnvReferences(path string) ([]envReference, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s, %s", path, err)
+	}
+
+	if bytes.IndexByte(content, 0) != -1 {
+		return nil, nil
+	}
+
+	var result []envReference
+
+	for index, line := range strings.Split(string(content), "\n") {
+		references, err := resolver.References(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d, %s", path, index+1, err)
+		}
+
+		for _, reference := range references {
+			result = append(result, envReference{
+				reference: reference,
+				usage:     model.EnvVariableUsage{Path: path, Line: index + 1},
+			})
+		}
+	}
+
+	return result, nil
+}
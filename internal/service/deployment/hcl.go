@@ -0,0 +1,472 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package deployment
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"prism/internal/service/resolver"
+	"prism/pkg"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Parameters of the variable block that are always HCL expressions.
+var hclExpressionParameters = []string{"type", "condition"}
+
+// Start of the attribute of the variables file.
+var hclAttributeFormat = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_-]*)\s*=(?:[^=]|$)`)
+
+// Attribute of the variables file and the text of its expression.
+type hclAttribute struct {
+	name       string
+	expression string
+}
+
+// Returns the HCL2 variable and locals blocks declared in the variables
+// and locals sections of the configuration file. The environment variables
+// are replaced before the maps and lists are converted to HCL expressions.
+func (s *Deployment) BuildDeclarations(
+	file model.ConfigFile,
+	resolver *resolver.Resolver,
+) ([]model.TemplateBlock, error) {
+	content, err := s.ParseFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("parse error, %s", err)
+	}
+
+	var declarations []model.TemplateBlock
+
+	for _, section := range []string{"variables", "locals"} {
+		if value, ok := content[section]; ok {
+			content[section], err = resolveValue(value, resolver)
+			if err != nil {
+				return nil, fmt.Errorf("%s in file %s, %s", section, file.Path, err)
+			}
+		}
+	}
+
+	if value, ok := content["variables"]; ok && value != nil {
+		variables, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("variables in file %s must be a map of the variables", file.Path)
+		}
+
+		for _, name := range sortedKeys(variables) {
+			block, err := variableBlock(name, variables[name])
+			if err != nil {
+				return nil, fmt.Errorf("variable %s in file %s, %s", name, file.Path, err)
+			}
+
+			declarations = append(declarations, block)
+		}
+	}
+
+	if value, ok := content["locals"]; ok && value != nil {
+		locals, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("locals in file %s must be a map of the values", file.Path)
+		}
+
+		block := model.TemplateBlock{Type: "locals"}
+
+		for _, name := range sortedKeys(locals) {
+			block.Parameter = append(block.Parameter, map[string]interface{}{
+				name: hclParameterValue(locals[name]),
+			})
+		}
+
+		declarations = append(declarations, block)
+	}
+
+	return declarations, nil
+}
+
+// Returns the variable block with the parameters of the variable,
+// the validation can be a map or a list of maps.
+func variableBlock(name string, value interface{}) (model.TemplateBlock, error) {
+	block := model.TemplateBlock{Type: "variable", Label: name}
+
+	if value == nil {
+		return block, nil
+	}
+
+	parameters, ok := value.(map[string]interface{})
+	if !ok {
+		return block, fmt.Errorf("the variable must be a map of the parameters")
+	}
+
+	for _, key := range sortedKeys(parameters) {
+		if key != "validation" {
+			block.Parameter = append(block.Parameter, map[string]interface{}{
+				key: variableParameterValue(key, parameters[key]),
+			})
+
+			continue
+		}
+
+		validations := []interface{}{parameters[key]}
+
+		if list, ok := parameters[key].([]interface{}); ok {
+			validations = list
+		}
+
+		for _, item := range validations {
+			validation, ok := item.(map[string]interface{})
+			if !ok {
+				return block, fmt.Errorf("the validation must be a map of the parameters")
+			}
+
+			validationBlock := model.TemplateBlock{Type: "validation"}
+
+			for _, validationKey := range sortedKeys(validation) {
+				validationBlock.Parameter = append(validationBlock.Parameter, map[string]interface{}{
+					validationKey: variableParameterValue(validationKey, validation[validationKey]),
+				})
+			}
+
+			block.Block = append(block.Block, validationBlock)
+		}
+	}
+
+	return block, nil
+}
+
+// Returns the value of the parameter of the variable block,
+// the type and the condition are always HCL expressions.
+func variableParameterValue(name string, value interface{}) interface{} {
+	if text, ok := value.(string); ok && slices.Contains(hclExpressionParameters, name) {
+		return pkg.HCLExpression(text)
+	}
+
+	return hclParameterValue(value)
+}
+
+// Returns the value of the parameter for the output. The maps, the lists
+// with maps or lists and null are written as HCL expressions.
+func hclParameterValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}, nil:
+		return pkg.HCLExpression(pkg.HCLValue(v))
+	case []interface{}:
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}, nil:
+				return pkg.HCLExpression(pkg.HCLValue(v))
+			}
+		}
+	}
+
+	return value
+}
+
+func sortedKeys(value map[string]interface{}) []string {
+	var keys []string
+
+	for key := range value {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+// Merges the declarations of the packs in the inheritance chain, from the root
+// parent pack to the pack itself. A variable replaces the variable with the same
+// name of the parent packs, the locals are merged by name.
+func mergeDeclarations(layers [][]model.TemplateBlock) []model.TemplateBlock {
+	var result []model.TemplateBlock
+	locals := model.TemplateBlock{Type: "locals"}
+
+	for _, declarations := range layers {
+		for _, block := range declarations {
+			if block.Type == "locals" {
+				for _, parameter := range block.Parameter {
+					for name := range parameter {
+						pkg.RemoveParameter(&locals, name)
+					}
+
+					locals.Parameter = append(locals.Parameter, parameter)
+				}
+
+				continue
+			}
+
+			index := slices.IndexFunc(result, func(item model.TemplateBlock) bool {
+				return item.Label == block.Label
+			})
+
+			if index == -1 {
+				result = append(result, block)
+			} else {
+				result[index] = block
+			}
+		}
+	}
+
+	if len(locals.Parameter) > 0 {
+		result = append(result, locals)
+	}
+
+	return result
+}
+
+// Replaces the environment variables in the strings of the value.
+func resolveValue(value interface{}, resolver *resolver.Resolver) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return resolver.Resolve(v)
+	case pkg.HCLExpression:
+		text, err := resolver.Resolve(string(v))
+		return pkg.HCLExpression(text), err
+	case []interface{}:
+		for index, item := range v {
+			result, err := resolveValue(item, resolver)
+			if err != nil {
+				return nil, err
+			}
+
+			v[index] = result
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			result, err := resolveValue(item, resolver)
+			if err != nil {
+				return nil, err
+			}
+
+			v[key] = result
+		}
+	}
+
+	return value, nil
+}
+
+// Returns the values of the HCL2 variables declared in the job in the format
+// of a variables file. The variables files are applied in order, the variables
+// from the command line override them. The values of the other variables
+// are skipped, Nomad does not accept the values of undeclared variables.
+func (s *Deployment) hclVariables(
+	declarations []model.TemplateBlock,
+	parameter model.ConfigParameter,
+) (string, error) {
+	var names []string
+	types := make(map[string]string)
+
+	for _, block := range declarations {
+		if block.Type != "variable" {
+			continue
+		}
+
+		names = append(names, block.Label)
+
+		for _, item := range block.Parameter {
+			if value, ok := item["type"].(pkg.HCLExpression); ok {
+				types[block.Label] = string(value)
+			}
+		}
+	}
+
+	values := make(map[string]string)
+
+	for _, file := range parameter.HCLVarFiles {
+		_, fileFullPath, err := s.CheckFileName(filepath.Join(file), parameter.ProjectDirPath)
+		if err != nil {
+			return "", fmt.Errorf("could not verify file name, %s", err)
+		}
+
+		content, err := os.ReadFile(fileFullPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read variables file, %s", err)
+		}
+
+		attributes, err := parseVarFile(string(content))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse variables file %s, %s", fileFullPath, err)
+		}
+
+		for _, attribute := range attributes {
+			values[attribute.name] = attribute.expression
+		}
+	}
+
+	// The value is a string, if the variable has no type or the string type,
+	// otherwise the value is an HCL expression, as with the -var flag of Nomad.
+	for _, item := range parameter.HCLVars {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return "", fmt.Errorf("invalid variable %s, the format is name=value", item)
+		}
+
+		name = strings.TrimSpace(name)
+
+		if variableType := strings.TrimSpace(types[name]); variableType == "" || variableType == "string" {
+			value = pkg.HCLString(value)
+		}
+
+		values[name] = value
+	}
+
+	var content strings.Builder
+
+	for _, name := range names {
+		if value, ok := values[name]; ok {
+			fmt.Fprintf(&content, "%s = %s\n", name, value)
+		}
+	}
+
+	return content.String(), nil
+}
+
+// Returns the attributes of the variables file. The expression of the attribute
+// ends at the end of the line, unless the brackets or the heredoc are not closed.
+// The comments outside the heredocs are removed from the expressions.
+func parseVarFile(content string) ([]hclAttribute, error) {
+	var attributes []hclAttribute
+	var scanner hclScanner
+
+	for index, line := range strings.Split(content, "\n") {
+		if !scanner.closed() {
+			text := line
+
+			if scanner.heredoc == "" {
+				text = scanner.strip(line)
+			} else {
+				scanner.strip(line)
+			}
+
+			attribute := &attributes[len(attributes)-1]
+			attribute.expression += "\n" + text
+
+			continue
+		}
+
+		text := scanner.strip(line)
+
+		match := hclAttributeFormat.FindStringSubmatchIndex(text)
+		if match == nil {
+			if strings.TrimSpace(text) != "" {
+				return nil, fmt.Errorf("line %d, expected an attribute name = value", index+1)
+			}
+
+			continue
+		}
+
+		attributes = append(attributes, hclAttribute{
+			name:       text[match[2]:match[3]],
+			expression: text[strings.Index(text, "=")+1:],
+		})
+	}
+
+	if !scanner.closed() || scanner.comment {
+		return nil, fmt.Errorf("unexpected end of file")
+	}
+
+	for index := range attributes {
+		attributes[index].expression = strings.TrimSpace(attributes[index].expression)
+
+		if attributes[index].expression == "" {
+			return nil, fmt.Errorf("variable %s has no value", attributes[index].name)
+		}
+	}
+
+	return attributes, nil
+}
+
+// State of the scanning of the HCL expressions over the lines.
+type hclScanner struct {
+	depth   int
+	comment bool
+	heredoc string
+}
+
+// Checks whether the expression is complete at the end of the line.
+func (s *hclScanner) closed() bool {
+	return s.depth <= 0 && s.heredoc == ""
+}
+
+// Updates the state with the brackets, strings, comments and heredocs
+// of the line and returns the line without the comments.
+func (s *hclScanner) strip(line string) string {
+	var text strings.Builder
+
+	s.each(line, func(char byte) {
+		text.WriteByte(char)
+	})
+
+	return text.String()
+}
+
+// Scans the line and calls the function for each character outside the comments.
+func (s *hclScanner) each(line string, visit func(char byte)) {
+	if s.heredoc != "" {
+		if strings.TrimSpace(line) == s.heredoc {
+			s.heredoc = ""
+		}
+
+		return
+	}
+
+	quoted := false
+
+	for index := 0; index < len(line); index++ {
+		char := line[index]
+		rest := line[index:]
+
+		switch {
+		case s.comment:
+			if strings.HasPrefix(rest, "*/") {
+				s.comment = false
+				index++
+			}
+
+			continue
+		case quoted:
+			if char == '\\' {
+				visit(char)
+				index++
+
+				if index < len(line) {
+					visit(line[index])
+				}
+
+				continue
+			}
+
+			if char == '"' {
+				quoted = false
+			}
+		case char == '"':
+			quoted = true
+		case char == '#' || strings.HasPrefix(rest, "//"):
+			return
+		case strings.HasPrefix(rest, "/*"):
+			s.comment = true
+			index++
+
+			continue
+		case strings.HasPrefix(rest, "<<"):
+			s.heredoc = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(rest, "<<"), "-"))
+
+			for index := range rest {
+				visit(rest[index])
+			}
+
+			return
+		case char == '(' || char == '[' || char == '{':
+			s.depth++
+		case char == ')' || char == ']' || char == '}':
+			s.depth--
+		}
+
+		visit(char)
+	}
+}
@@ -0,0 +1,383 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"prism/internal/service/registry"
+	"prism/internal/service/repository"
+	"prism/internal/service/resolver"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Pack with the packs it extends and the data for building its configuration.
+type packLayers struct {
+	// Layers from the root parent pack to the pack itself.
+	layers []model.ConfigLayer
+	// Parameters with the files of the release.
+	parameter model.ConfigParameter
+	// Pack with the dependencies inherited from the parent packs.
+	pack            model.Pack
+	dependencyPaths map[string]string
+	templateData    *model.TemplateData
+	// Configuration file parameters for the files to update the configuration.
+	configFile model.ConfigFile
+	// Directories with files of the packs, from the pack itself to the root parent pack.
+	filesDirPaths []string
+	// Transformers of the packs, from the root parent pack to the pack itself.
+	transformers []model.Transformer
+	// Sources of the environment variables of the render.
+	resolver *resolver.Resolver
+}
+
+// Returns the configuration of each pack in the inheritance chain,
+// from the root parent pack to the pack itself.
+func (s *Deployment) CreateConfigLayers(
+	parameter model.ConfigParameter,
+) ([]model.ConfigLayer, error) {
+	packLayers, err := s.createLayers(parameter)
+	if err != nil {
+		return nil, err
+	}
+
+	return packLayers.layers, nil
+}
+
+func (s *Deployment) createLayers(parameter model.ConfigParameter) (packLayers, error) {
+	var result packLayers
+
+	// Command line values that change the job configuration.
+	parameter, err := splitOverrides(parameter)
+	if err != nil {
+		return result, err
+	}
+
+	layers, err := s.packChain(parameter.ProjectDirPath, parameter.Verification)
+	if err != nil {
+		return result, err
+	}
+
+	var filesDirPaths []string
+
+	for index := len(layers) - 1; index >= 0; index-- {
+		filesDirPaths = append(filesDirPaths, filepath.Join(layers[index].DirPath, "files"))
+	}
+
+	// Files of the release.
+	parameter.Files = layerFiles(parameter.Files, filesDirPaths)
+
+	parameter, err = releaseParameter(layers, parameter, filesDirPaths)
+	if err != nil {
+		return result, err
+	}
+
+	parameter.Naming, err = releaseNaming(layers, parameter.Naming)
+	if err != nil {
+		return result, err
+	}
+
+	parameter.DeployMeta.Fields, err = releaseDeployMeta(layers, parameter.DeployMeta.Fields)
+	if err != nil {
+		return result, err
+	}
+
+	// Environment variables and secrets are resolved with the same sources
+	// for the pack, the update files and the dependencies.
+	envResolver, err := resolver.NewEnvResolver(
+		parameter.EnvVars,
+		parameter.EnvFilePaths,
+		parameter.AgeIdentities,
+		resolver.NewVault(),
+		resolver.NewNomadVariables(parameter.NomadConfig, parameter.Namespace),
+	)
+	if err != nil {
+		return result, err
+	}
+
+	pack := layers[len(layers)-1].Pack
+	pack.Dependencies = inheritDependencies(layers)
+
+	// Dependencies are resolved before the job config,
+	// partials from dependency packs can be included in the job config.
+	dependencyPaths := make(map[string]string)
+
+	for _, dependencyJob := range pack.Dependencies {
+		dependencyPath, err := s.DependencyPath(
+			dependencyJob,
+			parameter.Verification,
+		)
+
+		if err != nil {
+			return result, err
+		}
+
+		dependencyPaths[dependencyJob.Name] = dependencyPath
+	}
+
+	// Templating is enabled if it is enabled in at least one pack,
+	// files are rendered only in the packs in which it is enabled.
+	var dirPaths []string
+	templatePack := pack
+
+	for _, layer := range layers {
+		dirPaths = append(dirPaths, layer.DirPath)
+
+		if layer.Pack.Templating {
+			templatePack.Templating = true
+		}
+	}
+
+	templateData, err := s.TemplateData(dirPaths, templatePack, parameter, nil)
+	if err != nil {
+		return result, err
+	}
+
+	var base []byte
+	var configLayers []model.ConfigLayer
+
+	for index, layer := range layers {
+		configFile := model.ConfigFile{
+			Path: filepath.Join(layer.DirPath, "config.yaml"),
+			Include: model.Include{
+				PackDirPath: layer.DirPath,
+				Packs:       dependencyPaths,
+			},
+		}
+
+		if layer.Pack.Templating {
+			configFile.TemplateData = templateData
+		}
+
+		// The configuration file of a child pack is optional.
+		if index > 0 {
+			_, err := os.Stat(configFile.Path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			configFile.Base = base
+		} else {
+			base, err = s.ReadFile(configFile)
+			if err != nil {
+				return result, fmt.Errorf("parse error, %s", err)
+			}
+		}
+
+		layer.Config, err = s.BuildConfigStructure(configFile, "job", envResolver)
+		if err != nil {
+			return result, err
+		}
+
+		layer.Declarations, err = s.BuildDeclarations(configFile, envResolver)
+		if err != nil {
+			return result, err
+		}
+
+		configLayers = append(configLayers, layer)
+	}
+
+	result = packLayers{
+		layers:          configLayers,
+		parameter:       parameter,
+		pack:            pack,
+		dependencyPaths: dependencyPaths,
+		templateData:    templateData,
+		configFile: model.ConfigFile{
+			Path: filepath.Join(parameter.ProjectDirPath, "config.yaml"),
+			Include: model.Include{
+				PackDirPath: parameter.ProjectDirPath,
+				Packs:       dependencyPaths,
+			},
+			TemplateData: templateData,
+			Base:         base,
+		},
+		filesDirPaths: filesDirPaths,
+		resolver:      envResolver,
+	}
+
+	for _, layer := range layers {
+		result.transformers = append(
+			result.transformers,
+			packTransformers(layer.Pack, layer.DirPath)...,
+		)
+	}
+
+	return result, nil
+}
+
+// Returns the packs of the inheritance chain,
+// from the root parent pack to the pack itself.
+func (s *Deployment) packChain(
+	packDirPath string,
+	verification model.Verification,
+) ([]model.ConfigLayer, error) {
+	var layers []model.ConfigLayer
+	var visited []string
+
+	for {
+		absolutePath, err := filepath.Abs(packDirPath)
+		if err != nil {
+			return layers, fmt.Errorf("failed to get pack path %s, %s", packDirPath, err)
+		}
+
+		for _, path := range visited {
+			if path == absolutePath {
+				return layers, fmt.Errorf(
+					"pack inheritance cycle detected: %s",
+					strings.Join(append(visited, absolutePath), " -> "),
+				)
+			}
+		}
+
+		visited = append(visited, absolutePath)
+
+		pack, err := readPack(packDirPath)
+		if err != nil {
+			return layers, err
+		}
+
+		layer := model.ConfigLayer{Pack: pack, DirPath: packDirPath}
+		layers = append([]model.ConfigLayer{layer}, layers...)
+
+		if pack.Extends == "" {
+			return layers, nil
+		}
+
+		packDirPath, err = s.ResolvePack(pack.Extends, packDirPath, verification)
+		if err != nil {
+			return layers, fmt.Errorf("failed to get parent pack of %s, %s", pack.Name, err)
+		}
+	}
+}
+
+// Returns the path to the local pack directory.
+// The pack can be specified as a directory or archive (relative to the
+// base directory), an OCI reference or a reference to the pack
+// in the repository <repository>/<name>[@version].
+func (s *Deployment) ResolvePack(
+	reference, baseDirPath string,
+	verification model.Verification,
+) (string, error) {
+	if registry.IsReference(reference) {
+		return s.PackPath(reference, verification)
+	}
+
+	path := reference
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDirPath, path)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return s.PackPath(path, verification)
+	}
+
+	repositoryName, name, version := repository.ParseReference(reference)
+	if repositoryName == "" || strings.HasPrefix(reference, ".") || filepath.IsAbs(reference) {
+		return "", fmt.Errorf("pack %s not found", reference)
+	}
+
+	dependency := model.PackDependency{
+		Name:        name,
+		PackVersion: version,
+		Repository:  repositoryName,
+	}
+
+	return s.DependencyPath(dependency, verification)
+}
+
+// Returns the paths to the files to update the configuration.
+// If only the file name is specified and the file is not in the pack,
+// it is searched in the files directories of the parent packs.
+func layerFiles(files, filesDirPaths []string) []string {
+	var result []string
+
+	for _, file := range files {
+		if strings.ContainsAny(file, `\/`) {
+			result = append(result, file)
+			continue
+		}
+
+		path := file
+
+		for _, dirPath := range filesDirPaths {
+			if _, err := os.Stat(filepath.Join(dirPath, file)); err == nil {
+				path = filepath.Join(dirPath, file)
+				break
+			}
+		}
+
+		result = append(result, path)
+	}
+
+	return result
+}
+
+// Returns the dependencies of the packs in the inheritance chain.
+// Dependencies of the child pack replace dependencies with the same name.
+func inheritDependencies(layers []model.ConfigLayer) []model.PackDependency {
+	var dependencies []model.PackDependency
+
+	for _, layer := range layers {
+		for _, dependency := range layer.Pack.Dependencies {
+			replaced := false
+
+			for index, item := range dependencies {
+				if item.Name == dependency.Name {
+					dependencies[index] = dependency
+					replaced = true
+				}
+			}
+
+			if !replaced {
+				dependencies = append(dependencies, dependency)
+			}
+		}
+	}
+
+	return dependencies
+}
+
+// Reads the pack file in the pack directory.
+func readPack(packDirPath string) (model.Pack, error) {
+	var pack model.Pack
+
+	packFile, err := os.ReadFile(filepath.Join(packDirPath, "pack.yaml"))
+	if err != nil {
+		return pack, fmt.Errorf("error to read pack file, %s", err)
+	}
+
+	err = yaml.Unmarshal(packFile, &pack)
+	if err != nil {
+		return pack, fmt.Errorf("failed to parsing pack file, %s", err)
+	}
+
+	return pack, nil
+}
+
+// Returns the transformers of the pack, the commands are run in the pack directory.
+func packTransformers(pack model.Pack, packDirPath string) []model.Transformer {
+	var transformers []model.Transformer
+
+	for _, transformer := range pack.Transformers {
+		transformer.DirPath = packDirPath
+
+		if transformer.Name == "" {
+			transformer.Name = transformer.Command
+		}
+
+		transformers = append(transformers, transformer)
+	}
+
+	return transformers
+}
@@ -0,0 +1,278 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package deployment
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"prism/internal/model"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields of the deployment meta.
+var deployMetaFields = []string{
+	"version",   // prism_version
+	"pack",      // prism_pack, prism_pack_version
+	"git",       // prism_git_commit, prism_git_dirty
+	"user",      // prism_deployed_by
+	"timestamp", // prism_deployed_at
+	"checksum",  // prism_checksum
+	"templates", // prism_template_<destination> in the task meta
+}
+
+// Fields of the deployment meta, if they are not specified.
+// The user, the timestamp and the checksum change the job meta
+// on each deployment or change of the job, which restarts the allocations.
+var defaultDeployMetaFields = []string{"version", "pack", "git", "templates"}
+
+// Characters that are replaced in the keys of the meta.
+var metaKeyFormat = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// Returns the fields of the deployment meta. The fields of the pack file
+// replace the fields of the parent packs, the fields from the command line
+// replace the fields of the packs. The "none" field disables the meta.
+func releaseDeployMeta(layers []model.ConfigLayer, fields []string) ([]string, error) {
+	result := defaultDeployMetaFields
+
+	for _, layer := range layers {
+		if layer.Pack.DeployMeta != nil {
+			result = layer.Pack.DeployMeta
+		}
+	}
+
+	if fields != nil {
+		result = fields
+	}
+
+	if slices.Contains(result, "none") {
+		return []string{}, nil
+	}
+
+	for _, field := range result {
+		if !slices.Contains(deployMetaFields, field) {
+			return result, fmt.Errorf(
+				"unknown deploy meta field %q (available: %s, none)",
+				field,
+				strings.Join(deployMetaFields, ", "),
+			)
+		}
+	}
+
+	return result, nil
+}
+
+// Adds the release and the information about the deployment to the job meta.
+// The checksum is calculated from the job before the meta is added.
+func (s *Deployment) setDeployMeta(
+	config *model.TemplateBlock,
+	deployMeta model.DeployMeta,
+	release string,
+	pack model.Pack,
+	packDirPath string,
+) error {
+	var keys, values []string
+
+	add := func(key, value string) {
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	// The checksum of the job without the meta of the deployment.
+	checksum, err := s.jobChecksum(*config)
+	if err != nil {
+		return err
+	}
+
+	// The release is always recorded, the fields do not disable it.
+	if release != "" {
+		add("prism_release", release)
+	}
+
+	for _, field := range deployMeta.Fields {
+		switch field {
+		case "version":
+			add("prism_version", deployMeta.PrismVersion)
+		case "pack":
+			add("prism_pack", pack.Name)
+			add("prism_pack_version", pack.PackVersion)
+		case "git":
+			commit, dirty, ok := gitState(packDirPath)
+			if ok {
+				add("prism_git_commit", commit)
+				add("prism_git_dirty", strconv.FormatBool(dirty))
+			}
+		case "user":
+			add("prism_deployed_by", deployUser())
+		case "timestamp":
+			add("prism_deployed_at", time.Now().UTC().Format(time.RFC3339))
+		case "checksum":
+			add("prism_checksum", checksum)
+		case "templates":
+			templateChecksums(config)
+		}
+	}
+
+	if deployMeta.ForceRedeploy {
+		id := make([]byte, 16)
+
+		_, err := rand.Read(id)
+		if err != nil {
+			return fmt.Errorf("failed to create redeploy id, %s", err)
+		}
+
+		add("prism_redeploy", hex.EncodeToString(id))
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	meta := metaBlock(config)
+
+	for index, key := range keys {
+		setMetaValue(meta, key, values[index])
+	}
+
+	return nil
+}
+
+// Returns the checksum of the canonical representation of the job.
+func (s *Deployment) jobChecksum(config model.TemplateBlock) (string, error) {
+	content, err := json.Marshal(s.patch.Canonical(config))
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate job checksum, %s", err)
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Adds the checksums of the template data to the meta of the tasks,
+// the key is created from the destination of the template.
+func templateChecksums(config *model.TemplateBlock) {
+	for groupIndex := range config.Block {
+		group := &config.Block[groupIndex]
+		if group.Type != "group" {
+			continue
+		}
+
+		for taskIndex := range group.Block {
+			task := &group.Block[taskIndex]
+			if task.Type != "task" {
+				continue
+			}
+
+			for _, block := range task.Block {
+				if block.Type != "template" {
+					continue
+				}
+
+				data, ok := parameterValue(block, "data")
+				if !ok {
+					continue
+				}
+
+				destination, _ := parameterValue(block, "destination")
+				key := metaKeyFormat.ReplaceAllString(strings.ToLower(destination), "_")
+				sum := sha256.Sum256([]byte(data))
+
+				setMetaValue(
+					metaBlock(task),
+					"prism_template_"+strings.Trim(key, "_"),
+					hex.EncodeToString(sum[:]),
+				)
+			}
+		}
+	}
+}
+
+// Returns the meta block of the block, the block is created if it does not exist.
+func metaBlock(block *model.TemplateBlock) *model.TemplateBlock {
+	for index := range block.Block {
+		if block.Block[index].Type == "meta" {
+			return &block.Block[index]
+		}
+	}
+
+	block.Block = append(block.Block, model.TemplateBlock{
+		Type:      "meta",
+		Parameter: make([]map[string]interface{}, 0),
+	})
+
+	return &block.Block[len(block.Block)-1]
+}
+
+// Sets the value of the meta key, the existing key is replaced.
+func setMetaValue(meta *model.TemplateBlock, key, value string) {
+	for _, parameter := range meta.Parameter {
+		if _, ok := parameter[key]; ok {
+			parameter[key] = value
+			return
+		}
+	}
+
+	meta.Parameter = append(meta.Parameter, map[string]interface{}{key: value})
+}
+
+// Returns the string value of the block parameter.
+func parameterValue(block model.TemplateBlock, key string) (string, bool) {
+	for _, parameter := range block.Parameter {
+		if value, ok := parameter[key]; ok {
+			return fmt.Sprint(value), true
+		}
+	}
+
+	return "", false
+}
+
+// Returns the last commit that changed the pack directory and whether
+// the directory has uncommitted changes. If the pack is not in a git
+// repository or git is not installed, false is returned.
+func gitState(dirPath string) (string, bool, bool) {
+	output, err := exec.Command("git", "-C", dirPath, "log", "-1", "--format=%H", "--", ".").Output()
+	if err != nil {
+		return "", false, false
+	}
+
+	commit := strings.TrimSpace(string(output))
+	if commit == "" {
+		return "", false, false
+	}
+
+	output, err = exec.Command("git", "-C", dirPath, "status", "--porcelain", "--", ".").Output()
+	if err != nil {
+		return "", false, false
+	}
+
+	return commit, strings.TrimSpace(string(output)) != "", true
+}
+
+// Returns the name of the user who deploys the job.
+func deployUser() string {
+	current, err := user.Current()
+	if err == nil && current.Username != "" {
+		return current.Username
+	}
+
+	for _, key := range []string{"USER", "USERNAME"} {
+		if name := os.Getenv(key); name != "" {
+			return name
+		}
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package deployment
+
+import (
+	"fmt"
+	"os"
+	"prism/internal/model"
+	"prism/internal/service/patch"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Value from the --set, --set-string or --set-file flag.
+type commandLineValue struct {
+	flag  string
+	value string
+}
+
+// Block or parameter of the override path, such as group[web].
+type overrideSegment struct {
+	name  string
+	label string
+}
+
+// Returns the command line values in the order in which they are applied.
+func commandLineValues(parameter model.ConfigParameter) []commandLineValue {
+	var values []commandLineValue
+
+	for _, item := range []struct {
+		flag   string
+		values []string
+	}{
+		{flag: "set", values: parameter.Values},
+		{flag: "set-string", values: parameter.StringValues},
+		{flag: "set-file", values: parameter.FileValues},
+	} {
+		for _, value := range item.values {
+			values = append(values, commandLineValue{flag: item.flag, value: value})
+		}
+	}
+
+	return values
+}
+
+// Returns the key and the value of the command line value in the format key=value.
+// The --set value is parsed as a YAML scalar or flow sequence,
+// the --set-string value is used as a string,
+// the --set-file value is the path to the file whose content is used.
+func parseCommandLineValue(value commandLineValue) (string, interface{}, error) {
+	key, rawValue, ok := strings.Cut(value.value, "=")
+	if !ok || key == "" {
+		return key, nil, fmt.Errorf(
+			"invalid value %q of flag --%s, expected key=value format",
+			value.value,
+			value.flag,
+		)
+	}
+
+	switch value.flag {
+	case "set-string":
+		return key, rawValue, nil
+	case "set-file":
+		content, err := os.ReadFile(rawValue)
+		if err != nil {
+			return key, nil, fmt.Errorf("failed to read file of value %s, %s", key, err)
+		}
+
+		return key, string(content), nil
+	}
+
+	var parsedValue interface{}
+
+	err := yaml.Unmarshal([]byte(rawValue), &parsedValue)
+	if err != nil {
+		parsedValue = rawValue
+	}
+
+	return key, parsedValue, nil
+}
+
+// Moves the command line values whose key starts with the job block,
+// such as job.group[web].count=3, to the configuration overrides.
+// Other values are left for the configuration templates.
+func splitOverrides(parameter model.ConfigParameter) (model.ConfigParameter, error) {
+	values := make(map[string][]string)
+
+	for _, value := range commandLineValues(parameter) {
+		key, _, _ := strings.Cut(value.value, "=")
+
+		if key != "job" && !strings.HasPrefix(key, "job.") && !strings.HasPrefix(key, "job[") {
+			values[value.flag] = append(values[value.flag], value.value)
+			continue
+		}
+
+		_, parsedValue, err := parseCommandLineValue(value)
+		if err != nil {
+			return parameter, err
+		}
+
+		config, err := overrideConfig(key, parsedValue)
+		if err != nil {
+			return parameter, err
+		}
+
+		parameter.Overrides = append(parameter.Overrides, model.ConfigOverride{
+			Path:   key,
+			Config: config,
+		})
+	}
+
+	parameter.Values = values["set"]
+	parameter.StringValues = values["set-string"]
+	parameter.FileValues = values["set-file"]
+
+	return parameter, nil
+}
+
+// Returns the job block of the config file with the value
+// of the parameter specified by the path.
+func overrideConfig(path string, value interface{}) (map[string]interface{}, error) {
+	segments, err := parseOverridePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if segments[0].label != "" {
+		return nil, fmt.Errorf("invalid path %q, the job block is specified without a label", path)
+	}
+
+	last := segments[len(segments)-1]
+
+	if len(segments) < 2 || last.label != "" {
+		return nil, fmt.Errorf("invalid path %q, the path must end with a parameter name", path)
+	}
+
+	config := make(map[string]interface{})
+	current := config
+
+	for _, segment := range segments[1 : len(segments)-1] {
+		block := make(map[string]interface{})
+
+		if segment.label != "" {
+			block[patch.LabelKey(segment.name)] = segment.label
+			current[segment.name] = []interface{}{block}
+		} else {
+			current[segment.name] = block
+		}
+
+		current = block
+	}
+
+	current[last.name] = value
+	return config, nil
+}
+
+// Parsing the path in the format job.group[web].task[app].config.image.
+func parseOverridePath(path string) ([]overrideSegment, error) {
+	var segments []overrideSegment
+	rest := path
+
+	for {
+		end := strings.IndexAny(rest, ".[]")
+		if end == -1 {
+			end = len(rest)
+		}
+
+		segment := overrideSegment{name: rest[:end]}
+		if segment.name == "" {
+			return nil, fmt.Errorf("invalid path %q, empty block or parameter name", path)
+		}
+
+		rest = rest[end:]
+
+		if strings.HasPrefix(rest, "[") {
+			closing := strings.Index(rest, "]")
+			if closing == -1 {
+				return nil, fmt.Errorf("invalid path %q, missing closing bracket", path)
+			}
+
+			segment.label = rest[1:closing]
+			if segment.label == "" {
+				return nil, fmt.Errorf("invalid path %q, empty label of block %s", path, segment.name)
+			}
+
+			rest = rest[closing+1:]
+		}
+
+		segments = append(segments, segment)
+
+		if rest == "" {
+			return segments, nil
+		}
+
+		if !strings.HasPrefix(rest, ".") {
+			return nil, fmt.Errorf("invalid path %q, unexpected %q", path, rest)
+		}
+
+		rest = rest[1:]
+	}
+}
+
+// Checks that the blocks with the labels specified in the override path
+// exist in the configuration or in the files to update it,
+// the override does not add new blocks.
+func checkOverride(configs []model.TemplateBlock, override model.ConfigOverride) error {
+	segments, err := parseOverridePath(override.Path)
+	if err != nil {
+		return err
+	}
+
+	var missing *overrideSegment
+
+	for index, config := range configs {
+		segment := missingOverrideBlock(config, segments[1:len(segments)-1])
+		if segment == nil {
+			return nil
+		}
+
+		if index == 0 {
+			missing = segment
+		}
+	}
+
+	return fmt.Errorf(
+		"invalid path %q, block %s[%s] not found in the job configuration",
+		override.Path,
+		missing.name,
+		missing.label,
+	)
+}
+
+// Returns the first block with a label from the path
+// that is not found in the configuration block.
+func missingOverrideBlock(
+	block model.TemplateBlock,
+	segments []overrideSegment,
+) *overrideSegment {
+	if len(segments) == 0 {
+		return nil
+	}
+
+	segment := segments[0]
+
+	for _, item := range block.Block {
+		if item.Type != segment.name {
+			continue
+		}
+
+		if segment.label == "" || patch.BlockLabel(item) == segment.label {
+			return missingOverrideBlock(item, segments[1:])
+		}
+	}
+
+	if segment.label != "" {
+		return &segment
+	}
+
+	// The block without a label is added by the override,
+	// but the blocks with labels nested in it do not exist.
+	for _, item := range segments[1:] {
+		if item.label != "" {
+			return &item
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package deployment
+
+import (
+	"fmt"
+	"prism/internal/model"
+	"prism/pkg"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Plans the job configuration in the cluster.
+// Returns the difference between the job in the cluster and the configuration.
+func (s *Deployment) Plan(d model.Deployment) (model.PlanResult, error) {
+	result := model.PlanResult{JobName: d.JobName}
+
+	jobConfig, err := d.Client.Jobs().ParseHCLOpts(&api.JobsParseRequest{
+		JobHCL:       d.Config,
+		Variables:    d.HCLVariables,
+		Canonicalize: true,
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to parse hcl: %s", err)
+	}
+
+	result.JobName = *jobConfig.ID
+
+	writeOptions := &api.WriteOptions{
+		Namespace: d.Namespace,
+	}
+
+	plan, _, err := d.Client.Jobs().Plan(jobConfig, true, writeOptions)
+	if err != nil {
+		return result, fmt.Errorf("job plan error, %s", err)
+	}
+
+	if plan.Diff == nil || plan.Diff.Type == "None" {
+		return result, nil
+	}
+
+	result.Changed = true
+	result.Diff = formatJobDiff(plan.Diff, d.Sensitive)
+
+	return result, nil
+}
+
+// Stops the job of the configuration in the cluster.
+// If purge is true, the job is removed from the cluster.
+func (s *Deployment) Destroy(d model.Deployment, purge bool) (string, error) {
+	jobConfig, err := d.Client.Jobs().ParseHCLOpts(&api.JobsParseRequest{
+		JobHCL:       d.Config,
+		Variables:    d.HCLVariables,
+		Canonicalize: true,
+	})
+	if err != nil {
+		return d.JobName, fmt.Errorf("failed to parse hcl: %s", err)
+	}
+
+	writeOptions := &api.WriteOptions{
+		Namespace: d.Namespace,
+	}
+
+	_, _, err = d.Client.Jobs().Deregister(*jobConfig.ID, purge, writeOptions)
+	if err != nil {
+		return *jobConfig.ID, fmt.Errorf("job deregistration error, %s", err)
+	}
+
+	// Files of the template blocks of the job.
+	err = deleteFileVariables(d, *jobConfig.ID, nil)
+	if err != nil {
+		return *jobConfig.ID, err
+	}
+
+	return *jobConfig.ID, nil
+}
+
+// Returns the job difference in a readable format:
+// "+" added, "-" deleted, "~" edited. The values of the fields
+// with the secrets are masked.
+func formatJobDiff(diff *api.JobDiff, secrets []string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s Job: %q\n", diffMarker(diff.Type), diff.ID)
+	formatFields(&b, diff.Fields, 1, secrets)
+	formatObjects(&b, diff.Objects, 1, secrets)
+
+	for _, group := range diff.TaskGroups {
+		if group.Type == "None" {
+			continue
+		}
+
+		fmt.Fprintf(&b, "%s%s Task Group: %q\n", indent(1), diffMarker(group.Type), group.Name)
+		formatFields(&b, group.Fields, 2, secrets)
+		formatObjects(&b, group.Objects, 2, secrets)
+
+		for _, task := range group.Tasks {
+			if task.Type == "None" {
+				continue
+			}
+
+			fmt.Fprintf(&b, "%s%s Task: %q\n", indent(2), diffMarker(task.Type), task.Name)
+			formatFields(&b, task.Fields, 3, secrets)
+			formatObjects(&b, task.Objects, 3, secrets)
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func formatFields(b *strings.Builder, fields []*api.FieldDiff, level int, secrets []string) {
+	for _, field := range fields {
+		oldValue, newValue := fieldValues(field, secrets)
+
+		switch field.Type {
+		case "Added":
+			fmt.Fprintf(b, "%s+ %s: %q\n", indent(level), field.Name, newValue)
+		case "Deleted":
+			fmt.Fprintf(b, "%s- %s: %q\n", indent(level), field.Name, oldValue)
+		case "Edited":
+			fmt.Fprintf(
+				b, "%s~ %s: %q => %q\n", indent(level), field.Name, oldValue, newValue,
+			)
+		}
+	}
+}
+
+// Returns the old and the new value of the field. If one of them contains
+// a secret, both are masked: the old value from the cluster can contain
+// the previous value of the secret.
+func fieldValues(field *api.FieldDiff, secrets []string) (string, string) {
+	for _, secret := range secrets {
+		if secret != "" && (strings.Contains(field.Old, secret) || strings.Contains(field.New, secret)) {
+			return pkg.SensitiveMask, pkg.SensitiveMask
+		}
+	}
+
+	return field.Old, field.New
+}
+
+func formatObjects(b *strings.Builder, objects []*api.ObjectDiff, level int, secrets []string) {
+	for _, object := range objects {
+		if object.Type == "None" {
+			continue
+		}
+
+		fmt.Fprintf(b, "%s%s %s {\n", indent(level), diffMarker(object.Type), object.Name)
+		formatFields(b, object.Fields, level+1, secrets)
+		formatObjects(b, object.Objects, level+1, secrets)
+		fmt.Fprintf(b, "%s}\n", indent(level))
+	}
+}
+
+func diffMarker(diffType string) string {
+	switch diffType {
+	case "Added":
+		return "+"
+	case "Deleted":
+		return "-"
+	case "Edited":
+		return "~"
+	}
+
+	return " "
+}
+
+func indent(level int) string {
+	return strings.Repeat("  ", level)
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package deployment
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Template of the job name of the release, if it is not specified.
+const defaultJobNameTemplate = "{{ .Job }}-{{ .Release }}"
+
+// Returns the release declared in the pack file.
+// Returns an error if the pack declares releases and the release is not one of them.
+func (s *Deployment) Release(
+	path, release string,
+	verification model.Verification,
+) (model.PackRelease, error) {
+	layers, err := s.packChain(path, verification)
+	if err != nil {
+		return model.PackRelease{}, err
+	}
+
+	packRelease, _, err := findRelease(layers, release)
+	return packRelease, err
+}
+
+// Returns the release declared in the pack, or in the nearest parent pack
+// that declares releases, and the index of this pack in the layers.
+func findRelease(
+	layers []model.ConfigLayer,
+	release string,
+) (model.PackRelease, int, error) {
+	for index := len(layers) - 1; index >= 0; index-- {
+		pack := layers[index].Pack
+
+		if len(pack.Releases) == 0 {
+			continue
+		}
+
+		if release == "" {
+			return model.PackRelease{}, index, nil
+		}
+
+		var names []string
+
+		for _, item := range pack.Releases {
+			if item.Name == release {
+				return item, index, nil
+			}
+
+			names = append(names, item.Name)
+		}
+
+		return model.PackRelease{}, index, fmt.Errorf(
+			"unknown release \"%s\", releases declared in pack %s: %s",
+			release,
+			pack.Name,
+			strings.Join(names, ", "),
+		)
+	}
+
+	return model.PackRelease{Name: release}, -1, nil
+}
+
+// Adds the files to update the configuration and the files
+// with environment variables of the release to the parameters.
+// Files of the release are applied before the files specified in the flags:
+//  1. releases/<release>/*.yaml, or files/<release>.yaml
+//     if there is no release directory, of each pack from the root parent pack;
+//  2. files of the release declared in the pack file.
+func releaseParameter(
+	layers []model.ConfigLayer,
+	parameter model.ConfigParameter,
+	filesDirPaths []string,
+) (model.ConfigParameter, error) {
+	packRelease, index, err := findRelease(layers, parameter.Release)
+	if err != nil || parameter.Release == "" {
+		return parameter, err
+	}
+
+	var files []string
+
+	for _, layer := range layers {
+		releaseDirPath := filepath.Join(layer.DirPath, "releases", parameter.Release)
+
+		var releaseFiles []string
+
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(releaseDirPath, pattern))
+			if err != nil {
+				return parameter, fmt.Errorf("failed to read release directory, %s", err)
+			}
+
+			releaseFiles = append(releaseFiles, matches...)
+		}
+
+		if len(releaseFiles) > 0 {
+			slices.Sort(releaseFiles)
+			files = append(files, releaseFiles...)
+			continue
+		}
+
+		releaseFile := filepath.Join(layer.DirPath, "files", parameter.Release+".yaml")
+
+		if _, err := os.Stat(releaseFile); err == nil {
+			files = append(files, releaseFile)
+		}
+	}
+
+	var envFiles []string
+
+	if index != -1 {
+		packDirPath := layers[index].DirPath
+
+		files = append(files, layerFiles(
+			packFilePaths(packRelease.Files, packDirPath),
+			filesDirPaths,
+		)...)
+
+		envFiles = packFilePaths(packRelease.EnvFiles, packDirPath)
+	}
+
+	// Files specified in the flags are not applied twice.
+	var specifiedFiles []string
+
+	for _, file := range parameter.Files {
+		if path, err := filepath.Abs(file); err == nil {
+			specifiedFiles = append(specifiedFiles, path)
+		}
+	}
+
+	var releaseFiles []string
+
+	for _, file := range files {
+		path, err := filepath.Abs(file)
+		if err == nil && slices.Contains(specifiedFiles, path) {
+			continue
+		}
+
+		releaseFiles = append(releaseFiles, file)
+	}
+
+	parameter.Files = append(releaseFiles, parameter.Files...)
+	parameter.EnvFilePaths = append(envFiles, parameter.EnvFilePaths...)
+
+	return parameter, nil
+}
+
+// Returns the paths relative to the pack directory.
+// File names without a directory are returned as is.
+func packFilePaths(files []string, packDirPath string) []string {
+	var paths []string
+
+	for _, file := range files {
+		if strings.ContainsAny(file, `\/`) && !filepath.IsAbs(file) {
+			file = filepath.Join(packDirPath, file)
+		}
+
+		paths = append(paths, file)
+	}
+
+	return paths
+}
+
+// Returns the naming templates of the release. The templates of the packs
+// are applied from the root parent pack to the pack itself, then the templates
+// from the command line. By default, only the job name gets the release suffix.
+func releaseNaming(layers []model.ConfigLayer, naming model.Naming) (model.Naming, error) {
+	result := model.Naming{Job: defaultJobNameTemplate}
+
+	for _, layer := range append(layers, model.ConfigLayer{Pack: model.Pack{Naming: naming}}) {
+		if layer.Pack.Naming.Job != "" {
+			result.Job = layer.Pack.Naming.Job
+		}
+
+		if layer.Pack.Naming.Group != "" {
+			result.Group = layer.Pack.Naming.Group
+		}
+
+		if layer.Pack.Naming.Task != "" {
+			result.Task = layer.Pack.Naming.Task
+		}
+	}
+
+	data := model.NamingData{
+		Job:       "job",
+		Group:     "group",
+		Task:      "task",
+		Release:   "release",
+		Namespace: "namespace",
+		Pack:      "pack",
+	}
+
+	for _, item := range []struct {
+		block    string
+		template string
+	}{
+		{block: "job", template: result.Job},
+		{block: "group", template: result.Group},
+		{block: "task", template: result.Task},
+	} {
+		if item.template == "" {
+			continue
+		}
+
+		tmpl, err := template.New(item.block).Option("missingkey=error").Parse(item.template)
+		if err != nil {
+			return result, fmt.Errorf("invalid %s naming template, %s", item.block, err)
+		}
+
+		var buf bytes.Buffer
+
+		err = tmpl.Execute(&buf, data)
+		if err != nil {
+			return result, fmt.Errorf("invalid %s naming template, %s", item.block, err)
+		}
+
+		if strings.TrimSpace(buf.String()) == "" {
+			return result, fmt.Errorf("invalid %s naming template, the name is empty", item.block)
+		}
+	}
+
+	return result, nil
+}
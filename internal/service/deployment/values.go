@@ -0,0 +1,161 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Returns the data for the configuration templates of the pack.
+// Values are merged in order: values.yaml of the packs (from the parent pack
+// to the pack itself), parent values (for dependencies), --values files,
+// --set, --set-string and --set-file values. Returns nil if templating is not enabled in the pack.
+func (s *Deployment) TemplateData(
+	packDirPaths []string,
+	pack model.Pack,
+	parameter model.ConfigParameter,
+	parentValues map[string]interface{},
+) (*model.TemplateData, error) {
+	if !pack.Templating {
+		if len(parameter.ValueFiles) > 0 || len(parameter.Values) > 0 ||
+			len(parameter.StringValues) > 0 || len(parameter.FileValues) > 0 {
+			return nil, fmt.Errorf(
+				"values are specified, but templating is not enabled in pack %s",
+				pack.Name,
+			)
+		}
+
+		return nil, nil
+	}
+
+	values := make(map[string]interface{})
+
+	for _, packDirPath := range packDirPaths {
+		packValues, err := readValuesFile(filepath.Join(packDirPath, "values.yaml"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		mergeValues(values, packValues)
+	}
+
+	mergeValues(values, parentValues)
+
+	for _, file := range parameter.ValueFiles {
+		fileValues, err := readValuesFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		mergeValues(values, fileValues)
+	}
+
+	for _, value := range commandLineValues(parameter) {
+		key, parsedValue, err := parseCommandLineValue(value)
+		if err != nil {
+			return nil, err
+		}
+
+		err = setValue(values, key, parsedValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data := model.TemplateData{
+		Values: values,
+		Release: model.TemplateRelease{
+			Name:      parameter.Release,
+			Namespace: parameter.Namespace,
+		},
+		Namespace: parameter.Namespace,
+		Pack:      pack,
+	}
+
+	return &data, nil
+}
+
+// Returns the values of the dependency from the parent values.
+func dependencyValues(data *model.TemplateData, name string) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+
+	values, ok := data.Values[name].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	return values
+}
+
+func readValuesFile(path string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return values, fmt.Errorf("failed to read values file, %w", err)
+	}
+
+	err = yaml.Unmarshal(file, &values)
+	if err != nil {
+		return values, fmt.Errorf("failed to parsing values file %s, %s", path, err)
+	}
+
+	return values, nil
+}
+
+// Recursively merges the source values into the destination values.
+func mergeValues(destination, source map[string]interface{}) {
+	for key, value := range source {
+		sourceMap, sourceIsMap := value.(map[string]interface{})
+		destinationMap, destinationIsMap := destination[key].(map[string]interface{})
+
+		if sourceIsMap && destinationIsMap {
+			mergeValues(destinationMap, sourceMap)
+			continue
+		}
+
+		if sourceIsMap {
+			copyMap := make(map[string]interface{})
+			mergeValues(copyMap, sourceMap)
+			value = copyMap
+		}
+
+		destination[key] = value
+	}
+}
+
+// Sets the value by the key in the format key.subkey.
+func setValue(values map[string]interface{}, key string, value interface{}) error {
+	keys := strings.Split(key, ".")
+	current := values
+
+	for _, k := range keys[:len(keys)-1] {
+		if k == "" {
+			return fmt.Errorf("invalid value key %q", key)
+		}
+
+		next, ok := current[k].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[k] = next
+		}
+
+		current = next
+	}
+
+	current[keys[len(keys)-1]] = value
+	return nil
+}
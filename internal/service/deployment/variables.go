@@ -0,0 +1,310 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package deployment
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"prism/pkg"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Path of the Nomad Variables with the files of the jobs.
+const fileVariablesPrefix = "prism/files"
+
+// Size of the data of each variable, the size of a variable in Nomad
+// is limited to 64 KiB. The binary files are stored in base64,
+// the raw chunk of 36 KiB is encoded to 48 KiB.
+const (
+	variableChunkSize       = 48 * 1024
+	variableBinaryChunkSize = 36 * 1024
+)
+
+// Characters that are not allowed in the paths of the Nomad Variables.
+var variablePathFormat = regexp.MustCompile(`[^a-zA-Z0-9_~-]+`)
+
+// Returns the path of the Nomad Variables with the files of the job.
+func variablesPath(job string) string {
+	return fileVariablesPrefix + "/" + variablePathSegment(job)
+}
+
+func variablePathSegment(value string) string {
+	return variablePathFormat.ReplaceAllString(value, "_")
+}
+
+// Replaces the file_ref parameter of the template blocks of the tasks
+// with the template that reads the file from the Nomad Variables.
+// The file is found in the files directories as the file parameter.
+// Returns the variables with the chunks of the files. The path of the variables,
+// to which the ACL policy of the tasks gives access, is added to the job meta.
+func fileVariables(
+	config *model.TemplateBlock,
+	filesDirPaths []string,
+) ([]model.FileVariable, error) {
+	var variables []model.FileVariable
+
+	basePath := variablesPath(config.Label)
+
+	for groupIndex := range config.Block {
+		group := &config.Block[groupIndex]
+		if group.Type != "group" {
+			continue
+		}
+
+		for taskIndex := range group.Block {
+			task := &group.Block[taskIndex]
+			if task.Type != "task" {
+				continue
+			}
+
+			var names []string
+
+			for index := range task.Block {
+				template := &task.Block[index]
+				if template.Type != "template" {
+					continue
+				}
+
+				fileRef, ok := parameterString(*template, "file_ref")
+				if !ok {
+					continue
+				}
+
+				location := fmt.Sprintf(
+					"job[%s].group[%s].task[%s].template",
+					config.Label,
+					group.Label,
+					task.Label,
+				)
+
+				if _, ok := parameterString(*template, "data"); ok {
+					return nil, fmt.Errorf("%s, file_ref cannot be used with file or data", location)
+				}
+
+				name := variablePathSegment(filepath.Base(fileRef))
+				if slices.Contains(names, name) {
+					return nil, fmt.Errorf("%s, file %s is referenced twice in the task", location, name)
+				}
+
+				names = append(names, name)
+
+				content, err := os.ReadFile(fileRefPath(filesDirPaths, fileRef))
+				if err != nil {
+					return nil, fmt.Errorf("%s, failed to read file, %s", location, err)
+				}
+
+				// The checksum of the file is a part of the path, each version of the file
+				// is written to new variables and the running allocations read the version
+				// of their job until the new version is deployed.
+				path := strings.Join([]string{
+					basePath,
+					variablePathSegment(group.Label),
+					variablePathSegment(task.Label),
+					name,
+					fmt.Sprintf("%x", sha256.Sum256(content))[:12],
+				}, "/")
+
+				if len(path)+len("/000") > 128 {
+					return nil, fmt.Errorf("%s, variable path %s is longer than 128 characters", location, path)
+				}
+
+				fileVariables, data := fileTemplate(*template, path, content)
+
+				variables = append(variables, fileVariables...)
+
+				pkg.RemoveParameter(template, "file_ref")
+				template.Parameter = append(template.Parameter, map[string]interface{}{"data": data})
+			}
+		}
+	}
+
+	if len(variables) > 0 {
+		setMetaValue(metaBlock(config), "prism_files_path", basePath+"/*")
+	}
+
+	return variables, nil
+}
+
+// Returns the variables with the chunks of the file and the data of the
+// template that reads the chunks. The text files are stored as is, the binary
+// files in base64. The data is written in a heredoc with the indentation
+// and the final newline, the trim markers of the first and the last actions
+// remove them from the rendered file.
+func fileTemplate(
+	template model.TemplateBlock,
+	path string,
+	content []byte,
+) ([]model.FileVariable, string) {
+	left, right := "{{", "}}"
+
+	if value, ok := parameterString(template, "left_delimiter"); ok && value != "" {
+		left = value
+	}
+
+	if value, ok := parameterString(template, "right_delimiter"); ok && value != "" {
+		right = value
+	}
+
+	binary := !utf8.Valid(content) || slices.Contains(content, 0)
+	chunks := fileChunks(content, binary)
+
+	var variables []model.FileVariable
+	var data strings.Builder
+
+	for index, chunk := range chunks {
+		value := string(chunk)
+		read := ".data.Value"
+
+		if binary {
+			value = base64.StdEncoding.EncodeToString(chunk)
+			read = ".data.Value | base64Decode"
+		}
+
+		chunkPath := fmt.Sprintf("%s/%d", path, index)
+
+		variables = append(variables, model.FileVariable{
+			Path:  chunkPath,
+			Items: map[string]string{"data": value},
+		})
+
+		with, end := left+" with", "end "+right
+
+		if index == 0 {
+			with = left + "- with"
+		}
+
+		if index == len(chunks)-1 {
+			end = "end -" + right
+		}
+
+		fmt.Fprintf(&data, "%s nomadVar %q %s%s %s %s%s %s", with, chunkPath, right, left, read, right, left, end)
+	}
+
+	return variables, data.String()
+}
+
+// Splits the content into the chunks of the variables,
+// the text is split on the boundaries of the characters.
+func fileChunks(content []byte, binary bool) [][]byte {
+	size := variableChunkSize
+
+	if binary {
+		size = variableBinaryChunkSize
+	}
+
+	var chunks [][]byte
+
+	for len(content) > size {
+		end := size
+
+		for !binary && end > 0 && !utf8.RuneStart(content[end]) {
+			end--
+		}
+
+		chunks = append(chunks, content[:end])
+		content = content[end:]
+	}
+
+	return append(chunks, content)
+}
+
+// Returns the path to the file, a file name without a directory
+// is searched in the files directories.
+func fileRefPath(filesDirPaths []string, file string) string {
+	if strings.ContainsAny(file, `\/`) {
+		return file
+	}
+
+	for _, dirPath := range filesDirPaths {
+		path := filepath.Join(dirPath, file)
+
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	if len(filesDirPaths) == 0 {
+		return file
+	}
+
+	return filepath.Join(filesDirPaths[0], file)
+}
+
+// Returns the string value of the parameter of the block.
+func parameterString(block model.TemplateBlock, name string) (string, bool) {
+	for _, item := range block.Parameter {
+		if value, ok := item[name]; ok {
+			text, ok := value.(string)
+			return text, ok
+		}
+	}
+
+	return "", false
+}
+
+// Writes the variables with the files of the job. The variables of the previous
+// versions of the files are kept for the running allocations, the canaries
+// and the rollback, they are removed when the deployment is successful.
+func writeFileVariables(d model.Deployment) error {
+	writeOptions := &api.WriteOptions{Namespace: d.Namespace}
+
+	for _, variable := range d.Variables {
+		_, _, err := d.Client.Variables().Create(&api.Variable{
+			Namespace: d.Namespace,
+			Path:      variable.Path,
+			Items:     variable.Items,
+		}, writeOptions)
+		if err != nil {
+			return fmt.Errorf("failed to write variable %s, %s", variable.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// Removes the variables of the files that are no longer used by the job.
+func pruneFileVariables(d model.Deployment, job string) error {
+	var paths []string
+
+	for _, variable := range d.Variables {
+		paths = append(paths, variable.Path)
+	}
+
+	return deleteFileVariables(d, job, paths)
+}
+
+// Removes the variables with the files of the job, except the variables with the paths.
+func deleteFileVariables(d model.Deployment, job string, keep []string) error {
+	prefix := variablesPath(job) + "/"
+
+	list, _, err := d.Client.Variables().PrefixList(prefix, &api.QueryOptions{Namespace: d.Namespace})
+	if err != nil {
+		return fmt.Errorf("failed to list variables %s, %s", prefix, err)
+	}
+
+	for _, variable := range list {
+		if slices.Contains(keep, variable.Path) {
+			continue
+		}
+
+		_, err := d.Client.Variables().Delete(variable.Path, &api.WriteOptions{Namespace: d.Namespace})
+		if err != nil {
+			return fmt.Errorf("failed to delete variable %s, %s", variable.Path, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Maximum length of the values in the differences.
+const differenceValueLength = 80
+
+// Returns the differences between the source job and the job rendered
+// from the pack. Both jobs are canonicalized, the fields set by the cluster
+// and the meta of the deployment are not compared.
+func (s *Importer) Compare(source, rendered *api.Job) ([]string, error) {
+	sourceValue, err := comparableJob(source)
+	if err != nil {
+		return nil, err
+	}
+
+	renderedValue, err := comparableJob(rendered)
+	if err != nil {
+		return nil, err
+	}
+
+	var differences []string
+
+	compareValues("job", sourceValue, renderedValue, &differences)
+
+	return differences, nil
+}
+
+// Returns the canonical job as a map without the fields set by the cluster.
+func comparableJob(job *api.Job) (interface{}, error) {
+	content, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare jobs, %s", err)
+	}
+
+	// Copy of the job, the job itself is not changed.
+	var copied api.Job
+
+	err = json.Unmarshal(content, &copied)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare jobs, %s", err)
+	}
+
+	copied.Status = nil
+	copied.StatusDescription = nil
+	copied.Stable = nil
+	copied.Version = nil
+	copied.SubmitTime = nil
+	copied.CreateIndex = nil
+	copied.ModifyIndex = nil
+	copied.JobModifyIndex = nil
+	copied.Stop = nil
+	copied.ParentID = nil
+	copied.Dispatched = false
+	copied.Payload = nil
+	copied.NomadTokenID = nil
+	copied.VersionTag = nil
+
+	copied.Canonicalize()
+
+	removeDeployMeta(copied.Meta)
+
+	// Version of the deployment added to the meta of each job.
+	delete(copied.Meta, "run_uuid")
+
+	for _, group := range copied.TaskGroups {
+		removeDeployMeta(group.Meta)
+
+		for _, task := range group.Tasks {
+			removeDeployMeta(task.Meta)
+			task.Identity = nil
+		}
+	}
+
+	content, err = json.Marshal(copied)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare jobs, %s", err)
+	}
+
+	var value interface{}
+
+	err = json.Unmarshal(content, &value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare jobs, %s", err)
+	}
+
+	return value, nil
+}
+
+func removeDeployMeta(meta map[string]string) {
+	maps.DeleteFunc(meta, func(key, value string) bool {
+		return strings.HasPrefix(key, deployMetaPrefix)
+	})
+}
+
+// Adds the differences of the values with the path of the field.
+func compareValues(path string, source, rendered interface{}, differences *[]string) {
+	if isEmpty(source) && isEmpty(rendered) {
+		return
+	}
+
+	switch sourceValue := source.(type) {
+	case map[string]interface{}:
+		renderedValue, ok := rendered.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := slices.Collect(maps.Keys(sourceValue))
+
+		for key := range renderedValue {
+			if _, ok := sourceValue[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			compareValues(path+"."+key, sourceValue[key], renderedValue[key], differences)
+		}
+
+		return
+	case []interface{}:
+		renderedValue, ok := rendered.([]interface{})
+		if !ok {
+			break
+		}
+
+		for index := 0; index < max(len(sourceValue), len(renderedValue)); index++ {
+			var sourceItem, renderedItem interface{}
+
+			if index < len(sourceValue) {
+				sourceItem = sourceValue[index]
+			}
+
+			if index < len(renderedValue) {
+				renderedItem = renderedValue[index]
+			}
+
+			compareValues(fmt.Sprintf("%s[%d]", path, index), sourceItem, renderedItem, differences)
+		}
+
+		return
+	}
+
+	if !reflect.DeepEqual(source, rendered) {
+		*differences = append(
+			*differences,
+			fmt.Sprintf("%s: %s, rendered %s", path, differenceValue(source), differenceValue(rendered)),
+		)
+	}
+}
+
+// Checks whether the value is not set, an empty list or map.
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+
+	return false
+}
+
+// Returns the value for the difference, the long values are shortened.
+func differenceValue(value interface{}) string {
+	if value == nil {
+		return "not set"
+	}
+
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	text := string(content)
+
+	if len(text) > differenceValueLength {
+		text = text[:differenceValueLength] + "..."
+	}
+
+	return text
+}
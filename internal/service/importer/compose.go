@@ -0,0 +1,1236 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"prism/internal/service/resolver"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"gopkg.in/yaml.v3"
+)
+
+// Interval and timeout of the health check if they are not specified,
+// the defaults of Docker.
+const healthcheckDefault = 30 * time.Second
+
+// CPU in MHz of one CPU of the compose file.
+const cpuMHz = 1000
+
+// Keys of the compose file that are converted or ignored without a warning.
+var composeKeys = []string{"name", "version", "services", "volumes", "networks"}
+
+// Creates the pack from the docker-compose file. Each service is converted
+// to the docker task, the services started before a single dependent service
+// are added to its group as the prestart tasks. The variables of the compose
+// file are replaced with the environment variables with the PRISM_ prefix.
+func (s *Importer) CreateComposePack(path string, parameter model.ImportParameter) (model.ImportResult, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return model.ImportResult{}, fmt.Errorf("failed to read compose file %s, %s", path, err)
+	}
+
+	var compose map[string]interface{}
+
+	err = yaml.Unmarshal(content, &compose)
+	if err != nil {
+		return model.ImportResult{}, fmt.Errorf("failed to parse compose file %s, %s", path, err)
+	}
+
+	if len(mapping(compose["services"])) == 0 {
+		return model.ImportResult{}, fmt.Errorf("compose file %s does not contain services", path)
+	}
+
+	name, _ := compose["name"].(string)
+
+	if name == "" {
+		dirPath, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			return model.ImportResult{}, fmt.Errorf("failed to read compose file %s, %s", path, err)
+		}
+
+		name = filepath.Base(dirPath)
+	}
+
+	composer := &composeConverter{dirPath: filepath.Dir(path)}
+	job := composer.job(compose, name)
+
+	result, err := createPack(job, parameter, &converter{interpolated: true})
+	result.Warnings = append(composer.warnings, result.Warnings...)
+
+	return result, err
+}
+
+// Converts the docker-compose file into the Nomad job.
+type composeConverter struct {
+	// Directory of the compose file, the env files are read relative to it.
+	dirPath  string
+	warnings []string
+}
+
+// Service of the compose file converted into the task
+// and the parts of the group of the task.
+type composeService struct {
+	task     *api.Task
+	count    *int
+	hostname string
+	ports    []api.Port
+	reserved []bool
+	services []*api.Service
+	volumes  map[string]*api.VolumeRequest
+	// Services the service depends on with the conditions.
+	dependencies map[string]string
+}
+
+// Checks whether the service is started in a single allocation.
+func (s *composeService) single() bool {
+	return s.count == nil || *s.count <= 1
+}
+
+func (c *composeConverter) job(compose map[string]interface{}, name string) *api.Job {
+	for _, key := range slices.Sorted(maps.Keys(compose)) {
+		if !slices.Contains(composeKeys, key) && !strings.HasPrefix(key, "x-") {
+			c.warn("%s is not supported", key)
+		}
+	}
+
+	for _, network := range slices.Sorted(maps.Keys(mapping(compose["networks"]))) {
+		if network != "default" {
+			c.warn("networks.%s is not supported, the tasks of a group share the bridge network", network)
+		}
+	}
+
+	volumes := mapping(compose["volumes"])
+
+	for _, volume := range slices.Sorted(maps.Keys(volumes)) {
+		c.warn("volumes.%s, the volume is mounted as the host volume, it must be configured on the Nomad clients", volume)
+
+		for _, key := range slices.Sorted(maps.Keys(mapping(volumes[volume]))) {
+			c.warn("volumes.%s.%s is not supported", volume, key)
+		}
+	}
+
+	services := mapping(compose["services"])
+	converted := make(map[string]*composeService)
+	dependents := make(map[string][]string)
+
+	for _, service := range slices.Sorted(maps.Keys(services)) {
+		converted[service] = c.service(service, mapping(services[service]))
+
+		for dependency := range converted[service].dependencies {
+			dependents[dependency] = append(dependents[dependency], service)
+		}
+	}
+
+	// The dependencies started before a single dependent service in its group.
+	prestart := make(map[string][]string)
+	merged := make(map[string]bool)
+
+	for _, service := range slices.Sorted(maps.Keys(converted)) {
+		dependencies := converted[service].dependencies
+
+		for _, dependency := range slices.Sorted(maps.Keys(dependencies)) {
+			location := fmt.Sprintf("services.%s.depends_on.%s", service, dependency)
+
+			task, ok := converted[dependency]
+			if !ok {
+				c.warn("%s, the service is not defined", location)
+				continue
+			}
+
+			if len(dependents[dependency]) != 1 || len(task.dependencies) != 0 ||
+				!task.single() || !converted[service].single() {
+				c.warn("%s, the group %s is started independently of the group %s", location, dependency, service)
+				continue
+			}
+
+			condition := dependencies[dependency]
+
+			task.task.Lifecycle = &api.TaskLifecycle{
+				Hook:    "prestart",
+				Sidecar: condition != "service_completed_successfully",
+			}
+
+			if condition == "service_healthy" {
+				c.warn("%s, the task %s is started without waiting for the health check", location, service)
+			}
+
+			prestart[service] = append(prestart[service], dependency)
+			merged[dependency] = true
+		}
+	}
+
+	job := &api.Job{Name: pointerOf(name), Type: pointerOf("service")}
+
+	for _, service := range slices.Sorted(maps.Keys(converted)) {
+		if merged[service] {
+			continue
+		}
+
+		main := converted[service]
+		group := &api.TaskGroup{Name: pointerOf(service), Count: main.count}
+
+		var network *api.NetworkResource
+
+		if main.hostname != "" {
+			network = &api.NetworkResource{Mode: "bridge", Hostname: main.hostname}
+		}
+
+		for _, dependency := range append(prestart[service], service) {
+			task := converted[dependency]
+
+			if dependency != service && task.hostname != "" {
+				c.warn("services.%s.hostname is not supported for the prestart task", dependency)
+			}
+
+			for index, port := range task.ports {
+				if network == nil {
+					network = &api.NetworkResource{Mode: "bridge"}
+				}
+
+				if task.reserved[index] {
+					network.ReservedPorts = append(network.ReservedPorts, port)
+				} else {
+					network.DynamicPorts = append(network.DynamicPorts, port)
+				}
+			}
+
+			for _, volume := range slices.Sorted(maps.Keys(task.volumes)) {
+				if group.Volumes == nil {
+					group.Volumes = make(map[string]*api.VolumeRequest)
+				}
+
+				group.Volumes[volume] = task.volumes[volume]
+			}
+
+			group.Services = append(group.Services, task.services...)
+			group.Tasks = append(group.Tasks, task.task)
+		}
+
+		if network != nil {
+			group.Networks = []*api.NetworkResource{network}
+		}
+
+		job.TaskGroups = append(job.TaskGroups, group)
+	}
+
+	return job
+}
+
+// Converts the service of the compose file into the docker task.
+func (c *composeConverter) service(name string, config map[string]interface{}) *composeService {
+	service := &composeService{
+		task: &api.Task{
+			Name:   name,
+			Driver: "docker",
+			Config: make(map[string]interface{}),
+		},
+		dependencies: make(map[string]string),
+	}
+
+	task := service.task
+	var healthcheck *api.ServiceCheck
+	var resources composeResources
+
+	for _, key := range slices.Sorted(maps.Keys(config)) {
+		location := fmt.Sprintf("services.%s.%s", name, key)
+		value := config[key]
+
+		switch key {
+		case "image":
+			task.Config["image"] = c.text(location, value)
+		case "build":
+			if _, ok := config["image"]; !ok {
+				c.warn("%s is not supported, the image %s is used", location, name)
+				task.Config["image"] = name
+			} else {
+				c.warn("%s is not supported", location)
+			}
+		case "command":
+			command := c.words(location, value)
+
+			if len(command) != 0 {
+				task.Config["command"] = command[0]
+			}
+
+			if len(command) > 1 {
+				task.Config["args"] = command[1:]
+			}
+		case "entrypoint":
+			task.Config["entrypoint"] = c.words(location, value)
+		case "working_dir":
+			task.Config["work_dir"] = c.text(location, value)
+		case "labels":
+			labels := make(map[string]interface{})
+
+			for label, text := range c.pairs(location, value, "=") {
+				labels[label] = text
+			}
+
+			task.Config["labels"] = labels
+		case "extra_hosts":
+			var hosts []interface{}
+
+			pairs := c.pairs(location, value, ":")
+
+			for _, host := range slices.Sorted(maps.Keys(pairs)) {
+				hosts = append(hosts, host+":"+pairs[host])
+			}
+
+			task.Config["extra_hosts"] = hosts
+		case "privileged", "tty", "init":
+			task.Config[key] = c.scalar(location, value)
+		case "stdin_open":
+			task.Config["interactive"] = c.scalar(location, value)
+		case "cap_add", "cap_drop":
+			task.Config[key] = c.list(location, value)
+		case "dns":
+			task.Config["dns_servers"] = c.list(location, value)
+		case "hostname":
+			service.hostname = c.text(location, value)
+		case "user":
+			task.User = c.text(location, value)
+		case "stop_signal":
+			task.KillSignal = c.text(location, value)
+		case "stop_grace_period":
+			if duration, ok := c.duration(location, value); ok {
+				task.KillTimeout = &duration
+			}
+		case "environment":
+			c.environment(task, location, value)
+		case "env_file":
+			c.envFiles(task, location, value)
+		case "ports":
+			for index, port := range list(value) {
+				c.port(service, name, fmt.Sprintf("%s[%d]", location, index), port)
+			}
+		case "volumes":
+			for index, volume := range list(value) {
+				c.volume(service, fmt.Sprintf("%s[%d]", location, index), volume)
+			}
+		case "healthcheck":
+			healthcheck = c.healthcheck(name, location, mapping(value))
+		case "depends_on":
+			if dependencies, ok := value.(map[string]interface{}); ok {
+				for dependency, condition := range dependencies {
+					service.dependencies[dependency], _ = mapping(condition)["condition"].(string)
+				}
+			} else {
+				for _, dependency := range list(value) {
+					service.dependencies[fmt.Sprint(dependency)] = ""
+				}
+			}
+		case "scale":
+			if count, ok := c.integer(location, value); ok {
+				service.count = &count
+			}
+		case "deploy":
+			c.deploy(service, &resources, location, mapping(value))
+		case "restart":
+			c.restart(task, location, value)
+		case "cpus":
+			resources.cpus = value
+		case "mem_limit":
+			resources.memoryLimit = value
+		case "mem_reservation":
+			resources.memory = value
+		default:
+			if !strings.HasPrefix(key, "x-") {
+				c.warn("%s is not supported", location)
+			}
+		}
+	}
+
+	if _, ok := task.Config["image"]; !ok {
+		c.warn("services.%s.image is not specified", name)
+	}
+
+	task.Resources = c.resources(name, resources)
+
+	if healthcheck != nil && len(service.services) == 0 {
+		service.services = append(service.services, &api.Service{Name: serviceName(name)})
+	}
+
+	if healthcheck != nil {
+		service.services[0].Checks = append(service.services[0].Checks, *healthcheck)
+	}
+
+	return service
+}
+
+// Adds the port of the service to the group network and the service of the port.
+// The published ports are the static ports, the other ports are dynamic.
+func (c *composeConverter) port(service *composeService, name, location string, value interface{}) {
+	var published, target, hostIP, label string
+
+	if config, ok := value.(map[string]interface{}); ok {
+		target = c.text(location, config["target"])
+		published = c.text(location, config["published"])
+		hostIP = c.text(location, config["host_ip"])
+		label = c.text(location, config["name"])
+	} else {
+		text := c.text(location, value)
+		text, _, _ = strings.Cut(text, "/")
+
+		index := strings.LastIndex(text, ":")
+		target = text[index+1:]
+
+		if index >= 0 {
+			text = text[:index]
+			index = strings.LastIndex(text, ":")
+			published = text[index+1:]
+
+			if index >= 0 {
+				hostIP = text[:index]
+			}
+		}
+	}
+
+	if hostIP != "" {
+		c.warn("%s, the host IP %s is not supported", location, hostIP)
+	}
+
+	targets := portRange(target)
+	publishedPorts := portRange(published)
+
+	if len(targets) == 0 {
+		c.warn("%s is not supported, the port %s is not a number", location, target)
+		return
+	}
+
+	if published != "" && len(publishedPorts) != len(targets) {
+		c.warn("%s, the published port %s is not a number, the port is dynamic", location, published)
+		publishedPorts = nil
+	}
+
+	for index, port := range targets {
+		portLabel := label
+
+		if portLabel == "" || len(targets) > 1 {
+			portLabel = fmt.Sprintf("%s_%d", name, port)
+		}
+
+		portLabel = labelName(portLabel)
+
+		if slices.ContainsFunc(service.ports, func(port api.Port) bool { return port.Label == portLabel }) {
+			continue
+		}
+
+		if publishedPorts != nil {
+			service.ports = append(service.ports, api.Port{Label: portLabel, Value: publishedPorts[index], To: port})
+		} else {
+			service.ports = append(service.ports, api.Port{Label: portLabel, To: port})
+		}
+
+		service.reserved = append(service.reserved, publishedPorts != nil)
+
+		portService := serviceName(name)
+
+		if len(service.services) != 0 {
+			portService = fmt.Sprintf("%s-%d", portService, port)
+		}
+
+		service.services = append(service.services, &api.Service{Name: portService, PortLabel: portLabel})
+	}
+}
+
+// Adds the volume of the service. The bind mounts are the volumes of the docker
+// driver, the named volumes are the host volumes of the group.
+func (c *composeConverter) volume(service *composeService, location string, value interface{}) {
+	var source, target, volumeType string
+	var readOnly bool
+
+	if config, ok := value.(map[string]interface{}); ok {
+		volumeType = c.text(location, config["type"])
+		source = c.text(location, config["source"])
+		target = c.text(location, config["target"])
+		readOnly, _ = config["read_only"].(bool)
+
+		for _, key := range []string{"bind", "volume", "tmpfs", "consistency"} {
+			if _, ok := config[key]; ok {
+				c.warn("%s.%s is not supported", location, key)
+			}
+		}
+	} else {
+		parts := strings.Split(c.text(location, value), ":")
+
+		switch len(parts) {
+		case 1:
+			target = parts[0]
+		default:
+			source = parts[0]
+			target = parts[1]
+
+			if len(parts) > 2 {
+				readOnly = slices.Contains(strings.Split(parts[2], ","), "ro")
+			}
+		}
+	}
+
+	if volumeType == "" {
+		volumeType = "volume"
+
+		if strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~") {
+			volumeType = "bind"
+		}
+	}
+
+	switch {
+	case volumeType != "bind" && volumeType != "volume":
+		c.warn("%s, the volume type %s is not supported", location, volumeType)
+	case source == "":
+		c.warn("%s, the anonymous volume %s is not supported", location, target)
+	case volumeType == "bind":
+		if !strings.HasPrefix(source, "/") {
+			c.warn("%s, the path %s is relative to the task directory", location, source)
+		}
+
+		volume := source + ":" + target
+
+		if readOnly {
+			volume += ":ro"
+		}
+
+		volumes, _ := service.task.Config["volumes"].([]interface{})
+		service.task.Config["volumes"] = append(volumes, volume)
+	default:
+		if service.volumes == nil {
+			service.volumes = make(map[string]*api.VolumeRequest)
+		}
+
+		service.volumes[source] = &api.VolumeRequest{Name: source, Type: "host", Source: source}
+
+		mount := &api.VolumeMount{Volume: pointerOf(source), Destination: pointerOf(target)}
+
+		if readOnly {
+			mount.ReadOnly = pointerOf(true)
+		}
+
+		service.task.VolumeMounts = append(service.task.VolumeMounts, mount)
+	}
+}
+
+// Returns the script check of the health check, nil if the check is disabled.
+func (c *composeConverter) healthcheck(name, location string, config map[string]interface{}) *api.ServiceCheck {
+	if disable, _ := config["disable"].(bool); disable {
+		return nil
+	}
+
+	check := &api.ServiceCheck{
+		Name:     fmt.Sprintf("%s-healthcheck", serviceName(name)),
+		Type:     "script",
+		TaskName: name,
+		Interval: healthcheckDefault,
+		Timeout:  healthcheckDefault,
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(config)) {
+		keyLocation := fmt.Sprintf("%s.%s", location, key)
+		value := config[key]
+
+		switch key {
+		case "test":
+			var command []string
+
+			if text, ok := value.(string); ok {
+				command = []string{"CMD-SHELL", c.interpolate(keyLocation, text)}
+			} else {
+				command = c.strings(keyLocation, value)
+			}
+
+			if len(command) == 0 || command[0] == "NONE" {
+				return nil
+			}
+
+			if command[0] == "CMD-SHELL" {
+				command = []string{"/bin/sh", "-c", strings.Join(command[1:], " ")}
+			} else if command[0] == "CMD" {
+				command = command[1:]
+			}
+
+			if len(command) == 0 {
+				return nil
+			}
+
+			check.Command = command[0]
+			check.Args = command[1:]
+		case "interval":
+			if duration, ok := c.duration(keyLocation, value); ok {
+				check.Interval = duration
+			}
+		case "timeout":
+			if duration, ok := c.duration(keyLocation, value); ok {
+				check.Timeout = duration
+			}
+		case "retries":
+			if retries, ok := c.integer(keyLocation, value); ok {
+				check.FailuresBeforeCritical = retries
+			}
+		case "disable":
+		default:
+			c.warn("%s is not supported", keyLocation)
+		}
+	}
+
+	if check.Command == "" {
+		c.warn("%s.test is not specified", location)
+		return nil
+	}
+
+	return check
+}
+
+// CPU and memory of the service as they are specified in the compose file.
+type composeResources struct {
+	cpus        interface{}
+	cpusLimit   interface{}
+	memory      interface{}
+	memoryLimit interface{}
+}
+
+// Returns the resources of the task. The memory reservation is the memory
+// of the task, the memory limit is the maximum memory.
+func (c *composeConverter) resources(name string, config composeResources) *api.Resources {
+	var resources api.Resources
+
+	location := fmt.Sprintf("services.%s.deploy.resources", name)
+
+	cpus := config.cpus
+	if cpus == nil {
+		cpus = config.cpusLimit
+	}
+
+	if cpus != nil {
+		cpu, err := strconv.ParseFloat(c.text(location, cpus), 64)
+		if err != nil {
+			c.warn("%s, the CPU %v is not a number", location, cpus)
+		} else {
+			resources.CPU = pointerOf(int(math.Round(cpu * cpuMHz)))
+		}
+	}
+
+	if config.memory != nil {
+		if memory, ok := c.memory(location, config.memory); ok {
+			resources.MemoryMB = &memory
+		}
+	}
+
+	if config.memoryLimit != nil {
+		if memory, ok := c.memory(location, config.memoryLimit); ok {
+			if resources.MemoryMB == nil {
+				resources.MemoryMB = &memory
+			} else {
+				resources.MemoryMaxMB = &memory
+			}
+		}
+	}
+
+	if resources.CPU == nil && resources.MemoryMB == nil {
+		return nil
+	}
+
+	return &resources
+}
+
+// Converts the deploy section: the replicas, the resources and the restart policy.
+func (c *composeConverter) deploy(
+	service *composeService,
+	resources *composeResources,
+	location string,
+	config map[string]interface{},
+) {
+	for _, key := range slices.Sorted(maps.Keys(config)) {
+		keyLocation := fmt.Sprintf("%s.%s", location, key)
+		value := config[key]
+
+		switch key {
+		case "replicas":
+			if count, ok := c.integer(keyLocation, value); ok {
+				service.count = &count
+			}
+		case "mode":
+			if value != "replicated" {
+				c.warn("%s, the mode %v is not supported", keyLocation, value)
+			}
+		case "resources":
+			for _, resource := range slices.Sorted(maps.Keys(mapping(value))) {
+				limits := mapping(mapping(value)[resource])
+
+				for _, limit := range slices.Sorted(maps.Keys(limits)) {
+					switch {
+					case resource == "limits" && limit == "cpus":
+						resources.cpusLimit = limits[limit]
+					case resource == "limits" && limit == "memory":
+						resources.memoryLimit = limits[limit]
+					case resource == "reservations" && limit == "cpus":
+						resources.cpus = limits[limit]
+					case resource == "reservations" && limit == "memory":
+						resources.memory = limits[limit]
+					default:
+						c.warn("%s.%s.%s is not supported", keyLocation, resource, limit)
+					}
+				}
+			}
+		case "restart_policy":
+			c.restartPolicy(service.task, keyLocation, mapping(value))
+		default:
+			c.warn("%s is not supported", keyLocation)
+		}
+	}
+}
+
+// Converts the restart option: "no" does not restart the task,
+// on-failure[:<attempts>] limits the attempts. The restart policy
+// of the deploy section takes precedence.
+func (c *composeConverter) restart(task *api.Task, location string, value interface{}) {
+	if task.RestartPolicy != nil {
+		return
+	}
+
+	policy := c.text(location, value)
+
+	switch {
+	case policy == "no":
+		task.RestartPolicy = &api.RestartPolicy{Attempts: pointerOf(0), Mode: pointerOf("fail")}
+	case strings.HasPrefix(policy, "on-failure"):
+		task.RestartPolicy = &api.RestartPolicy{Mode: pointerOf("fail")}
+
+		if _, text, ok := strings.Cut(policy, ":"); ok {
+			if attempts, ok := c.integer(location, text); ok {
+				task.RestartPolicy.Attempts = &attempts
+			}
+		}
+	case policy != "always" && policy != "unless-stopped":
+		c.warn("%s, the restart policy %s is not supported", location, policy)
+	}
+}
+
+func (c *composeConverter) restartPolicy(task *api.Task, location string, config map[string]interface{}) {
+	task.RestartPolicy = &api.RestartPolicy{Mode: pointerOf("fail")}
+
+	for _, key := range slices.Sorted(maps.Keys(config)) {
+		keyLocation := fmt.Sprintf("%s.%s", location, key)
+		value := config[key]
+
+		switch key {
+		case "condition":
+			if value == "none" {
+				task.RestartPolicy.Attempts = pointerOf(0)
+			}
+		case "max_attempts":
+			if attempts, ok := c.integer(keyLocation, value); ok {
+				task.RestartPolicy.Attempts = &attempts
+			}
+		case "delay":
+			if duration, ok := c.duration(keyLocation, value); ok {
+				task.RestartPolicy.Delay = &duration
+			}
+		case "window":
+			if duration, ok := c.duration(keyLocation, value); ok {
+				task.RestartPolicy.Interval = &duration
+			}
+		default:
+			c.warn("%s is not supported", keyLocation)
+		}
+	}
+}
+
+// Adds the environment variables in the form of a map or a list of KEY=VALUE.
+// The variables without a value are taken from the environment variables.
+func (c *composeConverter) environment(task *api.Task, location string, value interface{}) {
+	if task.Env == nil {
+		task.Env = make(map[string]string)
+	}
+
+	if variables, ok := value.(map[string]interface{}); ok {
+		for name, text := range variables {
+			if text == nil {
+				task.Env[name] = variableExpression(name, "")
+			} else {
+				task.Env[name] = c.text(location, text)
+			}
+		}
+
+		return
+	}
+
+	for _, item := range c.strings(location, value) {
+		name, text, ok := strings.Cut(item, "=")
+
+		if ok {
+			task.Env[name] = text
+		} else {
+			task.Env[name] = variableExpression(name, "")
+		}
+	}
+}
+
+// Adds the environment variables of the env files, the files are read
+// relative to the compose file.
+func (c *composeConverter) envFiles(task *api.Task, location string, value interface{}) {
+	if task.Env == nil {
+		task.Env = make(map[string]string)
+	}
+
+	for _, item := range list(value) {
+		required := true
+		path := item
+
+		if config, ok := item.(map[string]interface{}); ok {
+			path = config["path"]
+
+			if value, ok := config["required"].(bool); ok {
+				required = value
+			}
+		}
+
+		filePath := fmt.Sprint(path)
+
+		if !filepath.IsAbs(filePath) {
+			filePath = filepath.Join(c.dirPath, filePath)
+		}
+
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			if required {
+				c.warn("%s, failed to read env file %s, %s", location, filePath, err)
+			}
+
+			continue
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			name, text, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+			name = strings.TrimSpace(name)
+
+			switch {
+			case !ok:
+				task.Env[name] = variableExpression(name, "")
+			case len(text) > 1 && text[0] == '\'' && text[len(text)-1] == '\'':
+				task.Env[name] = resolver.Escape(text[1 : len(text)-1])
+			case len(text) > 1 && text[0] == '"' && text[len(text)-1] == '"':
+				unquoted, err := strconv.Unquote(text)
+				if err != nil {
+					unquoted = text[1 : len(text)-1]
+				}
+
+				task.Env[name] = c.interpolate(location, unquoted)
+			default:
+				task.Env[name] = c.interpolate(location, text)
+			}
+		}
+	}
+}
+
+// Returns the text of the value with the variables replaced.
+func (c *composeConverter) text(location string, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return c.interpolate(location, v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Returns the value, the variables of the strings are replaced.
+func (c *composeConverter) scalar(location string, value interface{}) interface{} {
+	if text, ok := value.(string); ok {
+		return c.interpolate(location, text)
+	}
+
+	return value
+}
+
+// Returns the texts of the list or of the single value.
+func (c *composeConverter) strings(location string, value interface{}) []string {
+	var texts []string
+
+	for _, item := range list(value) {
+		texts = append(texts, c.text(location, item))
+	}
+
+	return texts
+}
+
+// Returns the texts of the list for the configuration of the driver.
+func (c *composeConverter) list(location string, value interface{}) []interface{} {
+	var texts []interface{}
+
+	for _, text := range c.strings(location, value) {
+		texts = append(texts, text)
+	}
+
+	return texts
+}
+
+// Returns the words of the command, a string is split as a shell command.
+func (c *composeConverter) words(location string, value interface{}) []interface{} {
+	if text, ok := value.(string); ok {
+		var words []interface{}
+
+		for _, word := range shellWords(text) {
+			words = append(words, c.interpolate(location, word))
+		}
+
+		return words
+	}
+
+	return c.list(location, value)
+}
+
+// Returns the map of the values in the form of a map or a list of <key><separator><value>.
+func (c *composeConverter) pairs(location string, value interface{}, separator string) map[string]string {
+	pairs := make(map[string]string)
+
+	if config, ok := value.(map[string]interface{}); ok {
+		for key, text := range config {
+			pairs[key] = c.text(location, text)
+		}
+
+		return pairs
+	}
+
+	for _, item := range c.strings(location, value) {
+		key, text, _ := strings.Cut(item, separator)
+		pairs[key] = text
+	}
+
+	return pairs
+}
+
+func (c *composeConverter) integer(location string, value interface{}) (int, bool) {
+	if number, ok := value.(int); ok {
+		return number, true
+	}
+
+	number, err := strconv.Atoi(fmt.Sprint(value))
+	if err != nil {
+		c.warn("%s is not supported, the value %v is not a number", location, value)
+		return 0, false
+	}
+
+	return number, true
+}
+
+// Returns the duration in the format of the compose file, for example 1m30s.
+func (c *composeConverter) duration(location string, value interface{}) (time.Duration, bool) {
+	duration, err := time.ParseDuration(fmt.Sprint(value))
+	if err != nil {
+		c.warn("%s is not supported, the value %v is not a duration", location, value)
+		return 0, false
+	}
+
+	return duration, true
+}
+
+// Returns the memory in MB of the number of bytes or the size with the unit, for example 512m.
+func (c *composeConverter) memory(location string, value interface{}) (int, bool) {
+	text := strings.TrimSuffix(strings.ToLower(fmt.Sprint(value)), "b")
+	unit := 1.0
+
+	switch {
+	case strings.HasSuffix(text, "k"):
+		unit = 1 << 10
+	case strings.HasSuffix(text, "m"):
+		unit = 1 << 20
+	case strings.HasSuffix(text, "g"):
+		unit = 1 << 30
+	}
+
+	size, err := strconv.ParseFloat(strings.TrimRight(text, "kmg"), 64)
+	if err != nil {
+		c.warn("%s, the memory %v is not a size", location, value)
+		return 0, false
+	}
+
+	return int(math.Ceil(size * unit / (1 << 20))), true
+}
+
+// Returns the text with the variables of the compose file replaced with
+// the expressions of the environment variables, the rest of the text is escaped.
+func (c *composeConverter) interpolate(location, text string) string {
+	var result, literal strings.Builder
+
+	flush := func() {
+		result.WriteString(resolver.Escape(literal.String()))
+		literal.Reset()
+	}
+
+	for index := 0; index < len(text); index++ {
+		if text[index] != '$' || index == len(text)-1 {
+			literal.WriteByte(text[index])
+			continue
+		}
+
+		next := text[index+1]
+
+		switch {
+		case next == '$':
+			literal.WriteByte('$')
+			index++
+		case next == '{':
+			end := closingBrace(text, index+1)
+			if end < 0 {
+				literal.WriteByte('$')
+				continue
+			}
+
+			flush()
+			result.WriteString(c.variable(location, text[index+2:end]))
+			index = end
+		case isVariableChar(next) && (next < '0' || next > '9'):
+			end := index + 1
+
+			for end < len(text) && isVariableChar(text[end]) {
+				end++
+			}
+
+			flush()
+			result.WriteString(variableExpression(text[index+1:end], ""))
+			index = end - 1
+		default:
+			literal.WriteByte('$')
+		}
+	}
+
+	flush()
+	return result.String()
+}
+
+// Returns the expression of the variable ${<name>[:-default|:?message]} of the compose file.
+func (c *composeConverter) variable(location, content string) string {
+	end := 0
+
+	for end < len(content) && isVariableChar(content[end]) {
+		end++
+	}
+
+	name := content[:end]
+	modifier := strings.TrimPrefix(content[end:], ":")
+
+	if name == "" {
+		c.warn("%s, the variable ${%s} is not supported", location, content)
+		return resolver.Escape("${" + content + "}")
+	}
+
+	if modifier == "" {
+		return variableExpression(name, "")
+	}
+
+	argument := modifier[1:]
+
+	switch modifier[0] {
+	case '-':
+		if strings.Contains(argument, "$") {
+			return variableExpression(name, "default="+c.interpolate(location, argument))
+		}
+
+		return variableExpression(name, "default="+quote(argument))
+	case '?':
+		if argument == "" {
+			argument = fmt.Sprintf("required variable %s is missing a value", name)
+		}
+
+		return variableExpression(name, "required="+quote(argument))
+	default:
+		c.warn("%s, the modifier of the variable ${%s} is not supported", location, content)
+		return variableExpression(name, "")
+	}
+}
+
+func (c *composeConverter) warn(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// Returns the expression of the environment variable with the PRISM_ prefix.
+func variableExpression(name, modifier string) string {
+	if modifier == "" {
+		return fmt.Sprintf("${PRISM_%s}", name)
+	}
+
+	return fmt.Sprintf("${PRISM_%s|%s}", name, modifier)
+}
+
+// Returns the argument of the modifier, the argument with the special
+// characters is quoted, the quote and backslash are escaped.
+func quote(text string) string {
+	if !strings.ContainsAny(text, "|}\"'\\$") {
+		return text
+	}
+
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	text = strings.ReplaceAll(text, `'`, `\'`)
+
+	return "'" + text + "'"
+}
+
+// Returns the index of the brace that closes the brace at the index, -1 if it is not closed.
+func closingBrace(text string, start int) int {
+	depth := 0
+
+	for index := start; index < len(text); index++ {
+		switch text[index] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+
+			if depth == 0 {
+				return index
+			}
+		}
+	}
+
+	return -1
+}
+
+func isVariableChar(char byte) bool {
+	return char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') ||
+		(char >= '0' && char <= '9')
+}
+
+// Splits the command into the words, the quotes and backslashes are handled as in a shell.
+func shellWords(text string) []string {
+	var words []string
+	var word strings.Builder
+	var quote byte
+	inWord := false
+
+	for index := 0; index < len(text); index++ {
+		char := text[index]
+
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			} else if char == '\\' && quote == '"' && index+1 < len(text) {
+				index++
+				word.WriteByte(text[index])
+			} else {
+				word.WriteByte(char)
+			}
+		case char == '\'' || char == '"':
+			quote = char
+			inWord = true
+		case char == '\\' && index+1 < len(text):
+			index++
+			word.WriteByte(text[index])
+			inWord = true
+		case char == ' ' || char == '\t' || char == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(char)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words
+}
+
+// Returns the ports of the port or the range of ports, for example 8000-8010.
+func portRange(text string) []int {
+	start, end, isRange := strings.Cut(text, "-")
+
+	first, err := strconv.Atoi(start)
+	if err != nil {
+		return nil
+	}
+
+	if !isRange {
+		return []int{first}
+	}
+
+	last, err := strconv.Atoi(end)
+	if err != nil || last < first {
+		return nil
+	}
+
+	var ports []int
+
+	for port := first; port <= last; port++ {
+		ports = append(ports, port)
+	}
+
+	return ports
+}
+
+// Returns the name of the service with the dashes instead of the other characters.
+func serviceName(name string) string {
+	return strings.Map(func(char rune) rune {
+		if (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') || char == '-' {
+			return char
+		}
+
+		if char >= 'A' && char <= 'Z' {
+			return char + 'a' - 'A'
+		}
+
+		return '-'
+	}, name)
+}
+
+// Returns the label of the port with the underscores instead of the other characters.
+func labelName(name string) string {
+	return strings.Map(func(char rune) rune {
+		if char < 128 && isVariableChar(byte(char)) {
+			return char
+		}
+
+		return '_'
+	}, name)
+}
+
+// Returns the map of the value, nil if the value is not a map.
+func mapping(value interface{}) map[string]interface{} {
+	config, _ := value.(map[string]interface{})
+	return config
+}
+
+// Returns the list of the value, a single value is a list of one item.
+func list(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+func pointerOf[T any](value T) *T {
+	return &value
+}
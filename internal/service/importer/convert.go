@@ -0,0 +1,577 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package importer
+
+import (
+	"fmt"
+	"path"
+	"prism/internal/service/resolver"
+	"prism/pkg"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"gopkg.in/yaml.v3"
+)
+
+// Blocks of which only the first one is rendered by the block builder.
+var singleBlocks = []string{"constraint", "affinity", "artifact", "identity", "upstreams"}
+
+// Blocks that are not supported by the configuration of the pack.
+var unsupportedBlocks = []string{"ui", "disconnect", "action", "schedule"}
+
+// Prefix of the meta keys of the deployment added by Prism.
+const deployMetaPrefix = "prism_"
+
+// Mapping of the configuration, the keys are written in the order of adding.
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newObject() *object {
+	return &object{values: make(map[string]interface{})}
+}
+
+func (o *object) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+
+	o.values[key] = value
+}
+
+func (o *object) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+
+	for _, key := range o.keys {
+		var value yaml.Node
+
+		err := value.Encode(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+
+		setStyle(&value)
+
+		node.Content = append(
+			node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+			&value,
+		)
+	}
+
+	return node, nil
+}
+
+// Sets the style of the configuration of a new project: the strings
+// are quoted, the lists of the values are written in one line.
+func setStyle(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!str" {
+			node.Style = yaml.DoubleQuotedStyle
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return
+			}
+		}
+
+		node.Style = yaml.FlowStyle
+
+		for _, item := range node.Content {
+			setStyle(item)
+		}
+	}
+}
+
+// Raw HCL expression, written with the !hcl tag.
+type expression string
+
+func (e expression) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!hcl",
+		Value: string(e),
+		Style: yaml.SingleQuotedStyle,
+	}, nil
+}
+
+// File of the template block moved out of the configuration.
+type templateFile struct {
+	name    string
+	content string
+}
+
+// Converts the Nomad job into the configuration of the pack.
+// The blocks and parameters are read from the hcl tags of the API structures.
+type converter struct {
+	files    []templateFile
+	warnings []string
+
+	// The strings contain the expressions of the environment variables,
+	// which are kept, the text of the strings is already escaped.
+	interpolated bool
+
+	// Names of the current group and task, used for the names of the files.
+	group string
+	task  string
+}
+
+func (c *converter) job(job *api.Job) *object {
+	name := jobName(job)
+
+	config := newObject()
+	config.set("name", name)
+
+	if job.ID != nil && *job.ID != name {
+		c.warn("job[%s], the job ID %s is replaced with the job name", name, *job.ID)
+	}
+
+	c.fields(config, reflect.ValueOf(job).Elem(), fmt.Sprintf("job[%s]", name), "job")
+
+	return config
+}
+
+// Adds the parameters and the blocks of the structure to the configuration.
+func (c *converter) fields(config *object, value reflect.Value, location, blockType string) {
+	valueType := value.Type()
+
+	for index := 0; index < valueType.NumField(); index++ {
+		field := valueType.Field(index)
+
+		tag, ok := field.Tag.Lookup("hcl")
+		if !ok {
+			continue
+		}
+
+		name, kind, _ := strings.Cut(tag, ",")
+		fieldValue := value.Field(index)
+
+		switch kind {
+		case "label":
+			if name == "" {
+				name = "name"
+
+				if field.Name == "Value" {
+					name = "value"
+				}
+			}
+
+			if item, ok := c.attribute(fieldValue); ok {
+				config.set(name, item)
+			}
+		case "optional":
+			// The name of the job is set first, the ID is the name of the job.
+			if blockType == "job" && (name == "id" || name == "name") {
+				continue
+			}
+
+			// The data of the template is moved to the files directory.
+			if blockType == "template" && name == "data" {
+				continue
+			}
+
+			if item, ok := c.attribute(fieldValue); ok {
+				config.set(name, item)
+			}
+		case "block":
+			c.block(config, fieldValue, location, name)
+		}
+	}
+}
+
+// Adds the block of the field to the configuration.
+func (c *converter) block(config *object, value reflect.Value, location, name string) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+
+		value = value.Elem()
+	}
+
+	if slices.Contains(unsupportedBlocks, name) && !value.IsZero() {
+		c.warn("%s, the %s block is not supported and is omitted", location, name)
+		return
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		block := c.structBlock(value, location, name)
+
+		// The sidecar service without parameters is enabled by the connect block.
+		if name == "sidecar_service" && len(block.keys) == 0 {
+			config.set("open_sidecar_service", true)
+			return
+		}
+
+		if len(block.keys) != 0 {
+			config.set(name, block)
+		}
+	case reflect.Slice:
+		var items []interface{}
+
+		for index := 0; index < value.Len(); index++ {
+			item := value.Index(index)
+
+			if item.Kind() == reflect.Pointer {
+				if item.IsNil() {
+					continue
+				}
+
+				item = item.Elem()
+			}
+
+			items = append(items, c.structBlock(item, location, name))
+		}
+
+		if len(items) == 0 {
+			return
+		}
+
+		if len(items) > 1 && slices.Contains(singleBlocks, name) {
+			c.warn("%s, only the first of %d %s blocks is rendered", location, len(items), name)
+		}
+
+		// The reserved ports are the ports with the static parameter.
+		if name == "reserved_ports" {
+			name = "port"
+		}
+
+		if current, ok := config.values[name].([]interface{}); ok {
+			items = append(current, items...)
+		}
+
+		// The network blocks are merged by the structure builder.
+		if name == "network" && len(items) == 1 {
+			config.set(name, items[0])
+			return
+		}
+
+		config.set(name, items)
+	case reflect.Map:
+		if value.Type().Elem().Kind() == reflect.Pointer {
+			c.mapBlocks(config, value, location, name)
+			return
+		}
+
+		block := newObject()
+		keys := value.MapKeys()
+
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(a.String(), b.String())
+		})
+
+		for _, key := range keys {
+			if name == "meta" && strings.HasPrefix(key.String(), deployMetaPrefix) {
+				continue
+			}
+
+			// The values of the driver configuration keep their types.
+			typed := value.Type().Elem().Kind() == reflect.Interface
+
+			block.set(key.String(), c.value(plainValue(value.MapIndex(key)), typed))
+		}
+
+		if len(block.keys) != 0 {
+			config.set(name, block)
+		}
+	}
+}
+
+// Adds the blocks of the map by the label, such as the volumes of the group.
+func (c *converter) mapBlocks(config *object, value reflect.Value, location, name string) {
+	var items []interface{}
+
+	keys := value.MapKeys()
+
+	slices.SortFunc(keys, func(a, b reflect.Value) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	for _, key := range keys {
+		item := value.MapIndex(key)
+		if item.IsNil() {
+			continue
+		}
+
+		block := c.structBlock(item.Elem(), location, name)
+
+		if _, ok := block.values["name"]; !ok {
+			block.set("name", key.String())
+		}
+
+		items = append(items, block)
+	}
+
+	if len(items) != 0 {
+		config.set(name, items)
+	}
+}
+
+// Returns the configuration of the block of the structure.
+func (c *converter) structBlock(value reflect.Value, location, name string) *object {
+	block := newObject()
+
+	location = location + "." + name
+
+	if label := labelValue(value); label != "" {
+		location = fmt.Sprintf("%s[%s]", location, label)
+
+		switch name {
+		case "group":
+			c.group = label
+		case "task":
+			c.task = label
+		}
+	}
+
+	c.fields(block, value, location, name)
+
+	if template, ok := value.Interface().(api.Template); ok {
+		c.templateFile(block, &template, location)
+	}
+
+	return block
+}
+
+// Moves the data of the template block to the file in the files directory.
+// The file is named after the destination of the template.
+func (c *converter) templateFile(block *object, template *api.Template, location string) {
+	if template.EmbeddedTmpl == nil || *template.EmbeddedTmpl == "" {
+		return
+	}
+
+	name := "template"
+
+	if template.DestPath != nil {
+		if base := path.Base(*template.DestPath); base != "." && base != "/" {
+			name = base
+		}
+	}
+
+	if c.fileExists(name) {
+		name = fmt.Sprintf("%s-%s-%s", c.group, c.task, name)
+	}
+
+	for index := 2; c.fileExists(name); index++ {
+		name = fmt.Sprintf("%s-%s-%d-%s", c.group, c.task, index, path.Base(name))
+	}
+
+	// The data is written as a heredoc, which ends with a newline.
+	content, ok := strings.CutSuffix(*template.EmbeddedTmpl, "\n")
+	if !ok {
+		c.warn("%s, a newline is added to the end of the data", location)
+	}
+
+	c.files = append(c.files, templateFile{name: name, content: resolver.Escape(content)})
+	block.set("file", name)
+}
+
+func (c *converter) fileExists(name string) bool {
+	return slices.ContainsFunc(c.files, func(file templateFile) bool {
+		return file.name == name
+	})
+}
+
+// Returns the value of the parameter of the field, false if it is not set.
+func (c *converter) attribute(value reflect.Value) (interface{}, bool) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil, false
+		}
+
+		value = value.Elem()
+	} else if value.IsZero() {
+		return nil, false
+	}
+
+	if value.Kind() == reflect.Slice && value.Len() == 0 {
+		return nil, false
+	}
+
+	if value.Type() == reflect.TypeOf(time.Duration(0)) {
+		return durationString(time.Duration(value.Int())), true
+	}
+
+	return c.value(plainValue(value), false), true
+}
+
+// Returns the value of the configuration. The strings that cannot be written
+// as is, the maps and the nested lists are written as HCL expressions.
+// If the value keeps its type, the strings that are converted to numbers
+// or booleans by the configuration are also written as HCL expressions.
+// The expressions of the environment variables are escaped.
+func (c *converter) value(value interface{}, typed bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		if !c.plainString(v, typed) {
+			return c.expression(v)
+		}
+
+		if c.interpolated {
+			return v
+		}
+
+		return resolver.Escape(v)
+	case []interface{}:
+		for _, item := range v {
+			switch item := item.(type) {
+			case string:
+				if !c.plainString(item, typed) {
+					return c.expression(v)
+				}
+			case []interface{}, map[string]interface{}, nil:
+				return c.expression(v)
+			}
+		}
+
+		result := make([]interface{}, 0, len(v))
+
+		for _, item := range v {
+			result = append(result, c.value(item, typed))
+		}
+
+		return result
+	case map[string]interface{}:
+		return c.expression(v)
+	default:
+		return v
+	}
+}
+
+// Checks whether the string is written as is. The interpolated strings
+// with the text ${ are written as HCL expressions, in which it is escaped.
+func (c *converter) plainString(value string, typed bool) bool {
+	if c.interpolated && strings.Contains(strings.ReplaceAll(value, "${PRISM_", ""), "${") {
+		return false
+	}
+
+	return plainString(value, typed)
+}
+
+// Returns the value as an HCL expression.
+func (c *converter) expression(value interface{}) expression {
+	text := pkg.HCLValue(value)
+
+	// The HCL string escapes the expressions of the environment variables.
+	if c.interpolated {
+		return expression(strings.ReplaceAll(text, "$${PRISM_", "${PRISM_"))
+	}
+
+	return expression(resolver.Escape(text))
+}
+
+func (c *converter) warn(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// Checks whether the string is written to the job as is.
+func plainString(value string, typed bool) bool {
+	if typed && resolver.IsTypedValue(value) {
+		return false
+	}
+
+	return !strings.ContainsAny(value, "\"\\\n") && !strings.Contains(value, "%{")
+}
+
+// Returns the value of the field as a string, a number, a boolean,
+// a list or a map, the numbers without a fraction are integers.
+func plainValue(value reflect.Value) interface{} {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+
+		return plainValue(value.Elem())
+	case reflect.String:
+		return value.String()
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		number := value.Float()
+
+		if number == float64(int(number)) {
+			return int(number)
+		}
+
+		return number
+	case reflect.Slice, reflect.Array:
+		result := make([]interface{}, 0, value.Len())
+
+		for index := 0; index < value.Len(); index++ {
+			result = append(result, plainValue(value.Index(index)))
+		}
+
+		return result
+	case reflect.Map:
+		result := make(map[string]interface{}, value.Len())
+
+		for _, key := range value.MapKeys() {
+			result[fmt.Sprint(key.Interface())] = plainValue(value.MapIndex(key))
+		}
+
+		return result
+	}
+
+	return fmt.Sprint(value.Interface())
+}
+
+// Returns the label of the block of the structure.
+func labelValue(value reflect.Value) string {
+	for index := 0; index < value.NumField(); index++ {
+		_, kind, _ := strings.Cut(value.Type().Field(index).Tag.Get("hcl"), ",")
+		if kind != "label" {
+			continue
+		}
+
+		if label, ok := plainValue(value.Field(index)).(string); ok {
+			return label
+		}
+	}
+
+	return ""
+}
+
+// Returns the duration in the shortest form, such as 30s or 5m.
+func durationString(duration time.Duration) string {
+	switch {
+	case duration == 0:
+		return "0s"
+	case duration%time.Hour == 0:
+		return fmt.Sprintf("%dh", duration/time.Hour)
+	case duration%time.Minute == 0:
+		return fmt.Sprintf("%dm", duration/time.Minute)
+	case duration%time.Second == 0:
+		return fmt.Sprintf("%ds", duration/time.Second)
+	}
+
+	return duration.String()
+}
+
+// Returns the name of the job, the ID if the name is not set.
+func jobName(job *api.Job) string {
+	if job.Name != nil && *job.Name != "" {
+		return *job.Name
+	}
+
+	if job.ID != nil {
+		return *job.ID
+	}
+
+	return ""
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+	"gopkg.in/yaml.v3"
+)
+
+type Importer struct{}
+
+func NewImporter() *Importer {
+	return &Importer{}
+}
+
+// Reads the Nomad job from the JSON or HCL file. The JSON file can contain
+// the job or the request to register the job with the Job key. The HCL file
+// is parsed by the Nomad cluster, so the client is required.
+func (s *Importer) ReadJob(path string, client *api.Client) (*api.Job, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job file %s, %s", path, err)
+	}
+
+	if filepath.Ext(path) == ".json" || bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		var request struct {
+			Job *api.Job
+		}
+
+		err = json.Unmarshal(content, &request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse job file %s, %s", path, err)
+		}
+
+		job := request.Job
+
+		if job == nil {
+			job = &api.Job{}
+
+			err = json.Unmarshal(content, job)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse job file %s, %s", path, err)
+			}
+		}
+
+		if jobName(job) == "" {
+			return nil, fmt.Errorf("job file %s does not contain the ID or the name of the job", path)
+		}
+
+		return job, nil
+	}
+
+	if client == nil {
+		return nil, fmt.Errorf("job file %s is parsed by the Nomad cluster, the cluster address is not specified", path)
+	}
+
+	job, err := client.Jobs().ParseHCLOpts(&api.JobsParseRequest{JobHCL: string(content)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse job file %s, %s", path, err)
+	}
+
+	return job, nil
+}
+
+// Returns the job registered in the Nomad cluster.
+func (s *Importer) ClusterJob(id, namespace string, client *api.Client) (*api.Job, error) {
+	job, _, err := client.Jobs().Info(id, &api.QueryOptions{Namespace: namespace})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job %s, %s", id, err)
+	}
+
+	return job, nil
+}
+
+// Creates the pack with the configuration of the job. The data of the template
+// blocks is moved to the files directory of the pack.
+func (s *Importer) CreatePack(job *api.Job, parameter model.ImportParameter) (model.ImportResult, error) {
+	return createPack(job, parameter, &converter{})
+}
+
+// Creates the pack with the configuration of the job converted by the converter.
+func createPack(
+	job *api.Job,
+	parameter model.ImportParameter,
+	converter *converter,
+) (model.ImportResult, error) {
+	config := newObject()
+	config.set("job", converter.job(job))
+
+	pack := model.Pack{
+		Name:          parameter.Name,
+		Description:   fmt.Sprintf("Imported from %s", parameter.Source),
+		Type:          "service",
+		DeployVersion: "0.0.1",
+		PackVersion:   "0.0.1",
+	}
+
+	if pack.Name == "" {
+		pack.Name = jobName(job)
+	}
+
+	if job.Type != nil && *job.Type != "" {
+		pack.Type = *job.Type
+	}
+
+	result := model.ImportResult{Warnings: converter.warnings}
+
+	for _, file := range converter.files {
+		result.Files = append(result.Files, filepath.Join("files", file.name))
+	}
+
+	content, err := configContent(config)
+	if err != nil {
+		return result, err
+	}
+
+	result.PackDirPath, err = writePack(parameter.DirPath, pack, content, converter.files)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Returns the configuration file of the pack.
+func configContent(config *object) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+
+	err := encoder.Encode(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create configuration file, %s", err)
+	}
+
+	err = encoder.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create configuration file, %s", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Writes the pack file, the configuration file and the files of the pack
+// to the pack directory. The directory must not exist.
+func writePack(dirPath string, pack model.Pack, config []byte, files []templateFile) (string, error) {
+	packDirPath := filepath.Join(dirPath, pack.Name)
+
+	if _, err := os.Stat(packDirPath); err == nil {
+		return "", fmt.Errorf("pack directory %s already exists", packDirPath)
+	}
+
+	err := os.MkdirAll(filepath.Join(packDirPath, "files"), 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create pack directory, %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(packDirPath, "pack.yaml"), packContent(pack), 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create pack file, %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(packDirPath, "config.yaml"), config, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create configuration file, %s", err)
+	}
+
+	for _, file := range files {
+		err = os.WriteFile(filepath.Join(packDirPath, "files", file.name), []byte(file.content), 0644)
+		if err != nil {
+			return "", fmt.Errorf("failed to create file %s, %s", file.name, err)
+		}
+	}
+
+	return packDirPath, nil
+}
+
+// Returns the pack file with the comments of the pack file of a new project.
+func packContent(pack model.Pack) []byte {
+	var content strings.Builder
+
+	fmt.Fprintf(&content, "# The name of the Prism Pack.\nname: %q\n\n", pack.Name)
+	fmt.Fprintf(&content, "# Description of the Prism Pack.\ndescription: %q\n\n", pack.Description)
+	fmt.Fprintf(&content, "# Specifies the Nomad scheduler to use.\ntype: %q\n\n", pack.Type)
+	fmt.Fprintf(&content, "# The version of the application it contains.\ndeploy_version: %q\n\n", pack.DeployVersion)
+	fmt.Fprintf(&content, "# The version of the Prism Pack.\npack_version: %q\n", pack.PackVersion)
+
+	return []byte(content.String())
+}
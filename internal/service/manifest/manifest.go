@@ -0,0 +1,333 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"prism/internal/service/registry"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Statuses of the manifest releases in the report.
+const (
+	StatusDeployed  = "deployed"
+	StatusRendered  = "rendered"
+	StatusChanged   = "changed"
+	StatusUnchanged = "unchanged"
+	StatusDestroyed = "destroyed"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+type Manifest struct{}
+
+func NewManifest() *Manifest {
+	return &Manifest{}
+}
+
+// Reads and validates the manifest file.
+// Local paths in the manifest are specified relative to the manifest file.
+func (s *Manifest) Read(path string) (model.Manifest, error) {
+	var manifest model.Manifest
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read manifest file, %s", err)
+	}
+
+	err = yaml.Unmarshal(file, &manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to parsing manifest file, %s", err)
+	}
+
+	dirPath := filepath.Dir(path)
+
+	for index, release := range manifest.Releases {
+		release.Pack = packPath(release.Pack, dirPath)
+		release.Files = filePaths(release.Files, dirPath, true)
+		release.EnvFiles = filePaths(release.EnvFiles, dirPath, false)
+		release.Values = filePaths(release.Values, dirPath, false)
+		release.Patches = filePaths(release.Patches, dirPath, true)
+		release.VarFiles = filePaths(release.VarFiles, dirPath, true)
+
+		manifest.Releases[index] = release
+	}
+
+	for name, cluster := range manifest.Clusters {
+		cluster.Address = os.ExpandEnv(cluster.Address)
+		cluster.Token = os.ExpandEnv(cluster.Token)
+		cluster.CACert = filePaths([]string{os.ExpandEnv(cluster.CACert)}, dirPath, false)[0]
+		cluster.ClientCert = filePaths([]string{os.ExpandEnv(cluster.ClientCert)}, dirPath, false)[0]
+		cluster.ClientKey = filePaths([]string{os.ExpandEnv(cluster.ClientKey)}, dirPath, false)[0]
+
+		manifest.Clusters[name] = cluster
+	}
+
+	err = validate(manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("invalid manifest %s, %s", path, err)
+	}
+
+	return manifest, nil
+}
+
+// Returns the releases matching all selectors in the form label=value.
+func (s *Manifest) Select(
+	manifest model.Manifest,
+	selectors []string,
+) ([]model.ManifestRelease, error) {
+	labels := make(map[string]string)
+
+	for _, selector := range selectors {
+		key, value, ok := strings.Cut(selector, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf(
+				"invalid selector %q, expected label=value format", selector,
+			)
+		}
+
+		labels[key] = value
+	}
+
+	var releases []model.ManifestRelease
+
+	for _, release := range manifest.Releases {
+		matched := true
+
+		for key, value := range labels {
+			if release.Labels[key] != value {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			releases = append(releases, release)
+		}
+	}
+
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("no releases match the selector")
+	}
+
+	return releases, nil
+}
+
+// Runs the function for each release, no more than the concurrency at a time.
+// A release is run after the releases it needs, or before them if reverse
+// is true (for destroy). If a needed release fails, the release is skipped.
+// Needed releases that are not in the list are considered completed.
+// Returns the results in the order of the releases.
+func (s *Manifest) Run(
+	releases []model.ManifestRelease,
+	concurrency int,
+	reverse bool,
+	run func(release model.ManifestRelease) model.ReleaseResult,
+) []model.ReleaseResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]model.ReleaseResult)
+		done    = make(map[string]chan struct{})
+		limit   = make(chan struct{}, concurrency)
+	)
+
+	for _, release := range releases {
+		done[release.Name] = make(chan struct{})
+	}
+
+	for _, release := range releases {
+		wg.Add(1)
+
+		go func(release model.ManifestRelease) {
+			defer wg.Done()
+			defer close(done[release.Name])
+
+			var result model.ReleaseResult
+
+			for _, name := range waitFor(release, releases, reverse) {
+				<-done[name]
+
+				mutex.Lock()
+				status := results[name].Status
+				mutex.Unlock()
+
+				if status == StatusFailed || status == StatusSkipped {
+					result = model.ReleaseResult{
+						Name:   release.Name,
+						Status: StatusSkipped,
+						Error:  fmt.Errorf("release %s was not completed", name),
+					}
+
+					break
+				}
+			}
+
+			if result.Status == "" {
+				limit <- struct{}{}
+				startTime := time.Now()
+
+				result = run(release)
+				result.Name = release.Name
+				result.Duration = time.Since(startTime).Round(time.Second)
+
+				<-limit
+			}
+
+			mutex.Lock()
+			results[release.Name] = result
+			mutex.Unlock()
+		}(release)
+	}
+
+	wg.Wait()
+
+	var list []model.ReleaseResult
+
+	for _, release := range releases {
+		list = append(list, results[release.Name])
+	}
+
+	return list
+}
+
+// Returns the names of the releases to wait for before running the release.
+func waitFor(
+	release model.ManifestRelease,
+	releases []model.ManifestRelease,
+	reverse bool,
+) []string {
+	var names []string
+
+	for _, item := range releases {
+		if !reverse && slices.Contains(release.Needs, item.Name) {
+			names = append(names, item.Name)
+		}
+
+		if reverse && slices.Contains(item.Needs, release.Name) {
+			names = append(names, item.Name)
+		}
+	}
+
+	return names
+}
+
+// Checks the release names, clusters and needed releases.
+func validate(manifest model.Manifest) error {
+	nameFormat := regexp.MustCompile(`^[\w.-]+$`)
+	needs := make(map[string][]string)
+
+	for _, release := range manifest.Releases {
+		if !nameFormat.MatchString(release.Name) {
+			return fmt.Errorf("invalid release name %q", release.Name)
+		}
+
+		if _, ok := needs[release.Name]; ok {
+			return fmt.Errorf("release %s is specified more than once", release.Name)
+		}
+
+		if release.Pack == "" {
+			return fmt.Errorf("pack is not specified for release %s", release.Name)
+		}
+
+		if release.Cluster != "" {
+			if _, ok := manifest.Clusters[release.Cluster]; !ok {
+				return fmt.Errorf(
+					"unknown cluster %s in release %s", release.Cluster, release.Name,
+				)
+			}
+		}
+
+		needs[release.Name] = release.Needs
+	}
+
+	for name, items := range needs {
+		for _, item := range items {
+			if _, ok := needs[item]; !ok {
+				return fmt.Errorf("unknown release %s needed by release %s", item, name)
+			}
+		}
+	}
+
+	// Cycles in the needed releases.
+	var visit func(name string, path []string) error
+
+	visit = func(name string, path []string) error {
+		if slices.Contains(path, name) {
+			return fmt.Errorf(
+				"release dependency cycle detected: %s",
+				strings.Join(append(path, name), " -> "),
+			)
+		}
+
+		for _, item := range needs[name] {
+			err := visit(item, append(slices.Clone(path), name))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, release := range manifest.Releases {
+		err := visit(release.Name, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the pack path relative to the manifest directory.
+// OCI references and pack references in repositories are returned as is.
+func packPath(pack, dirPath string) string {
+	if pack == "" || registry.IsReference(pack) || filepath.IsAbs(pack) {
+		return pack
+	}
+
+	path := filepath.Join(dirPath, pack)
+
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+
+	return pack
+}
+
+// Returns the file paths relative to the manifest directory.
+// If names is true, file names without a directory are returned as is,
+// they are searched in the files directory of the pack.
+func filePaths(files []string, dirPath string, names bool) []string {
+	var paths []string
+
+	for _, file := range files {
+		if file != "" && !filepath.IsAbs(file) {
+			if !names || strings.ContainsAny(file, `\/`) {
+				file = filepath.Join(dirPath, file)
+			}
+		}
+
+		paths = append(paths, file)
+	}
+
+	return paths
+}
@@ -13,11 +13,19 @@ import (
 	"path/filepath"
 	"prism/internal/model"
 	"prism/internal/templates"
+	"prism/pkg"
+	"slices"
+	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/Masterminds/sprig"
 )
 
+// Line break of the heredoc content. It is replaced after the nested blocks
+// are indented, so that the indentation is not added to the content.
+const heredocNewline = "\uE000"
+
 type Output struct{}
 
 func NewOutput() *Output {
@@ -25,7 +33,11 @@ func NewOutput() *Output {
 }
 
 // Returns the formated job configuration of the nomad.
-func (s *Output) OutputConfig(config model.TemplateBlock) (string, error) {
+// The HCL2 variable and locals blocks are written before the job.
+func (s *Output) OutputConfig(
+	config model.TemplateBlock,
+	declarations ...model.TemplateBlock,
+) (string, error) {
 	var buf bytes.Buffer
 
 	configTemplate, err := createTemplate()
@@ -36,22 +48,30 @@ func (s *Output) OutputConfig(config model.TemplateBlock) (string, error) {
 	}
 
 	// Write data to buffer.
-	err = configTemplate.ExecuteTemplate(&buf, "block", config)
-	if err != nil {
-		return "", fmt.Errorf(
-			"error write template to buffer, %s", err,
-		)
+	for index, block := range append(append([]model.TemplateBlock{}, declarations...), config) {
+		if index > 0 {
+			buf.WriteString("\n\n")
+		}
+
+		err = configTemplate.ExecuteTemplate(&buf, "block", block)
+		if err != nil {
+			return "", fmt.Errorf(
+				"error write template to buffer, %s", err,
+			)
+		}
 	}
 
-	return buf.String(), nil
+	return strings.ReplaceAll(buf.String(), heredocNewline, "\n"), nil
 }
 
 // Creates a nomad configuration file in .nomad.hcl format.
+// The comment is written before the job.
 func (s *Output) CreateConfigFile(
-	name, path string,
+	name, path, comment string,
 	config model.TemplateBlock,
+	declarations ...model.TemplateBlock,
 ) error {
-	configTemplate, err := createTemplate()
+	content, err := s.OutputConfig(config, declarations...)
 	if err != nil {
 		return fmt.Errorf("error create nomad configuration file, %s", err)
 	}
@@ -59,17 +79,10 @@ func (s *Output) CreateConfigFile(
 	// Create new .nomad.hcl file.
 	fileName := fmt.Sprintf("%s.nomad.hcl", name)
 	filePath := filepath.Join(path, fileName)
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("error create nomad configuration file, %s", err)
-	}
-
-	defer file.Close()
 
-	// Write data into nomad configuration template file.
-	err = configTemplate.ExecuteTemplate(file, "block", config)
+	err = os.WriteFile(filePath, []byte(comment+content), 0644)
 	if err != nil {
-		return fmt.Errorf("error execute nomad configuration template, %v", err)
+		return fmt.Errorf("error create nomad configuration file, %s", err)
 	}
 
 	return nil
@@ -125,38 +138,48 @@ func getValue(block string, value map[string]interface{}) string {
 
 	for k, v := range value {
 		switch v := v.(type) {
+		case pkg.HCLExpression:
+			parameter = fmt.Sprintf("%s = %s", k, v)
 		case string:
 			if block == "template" {
 				if k == "data" {
 					parameter = fmt.Sprintf("%s = <<EOH\n%v\nEOH", k, v)
 				} else {
-					parameter = fmt.Sprintf(`%s = "%v"`, k, v)
+					parameter = fmt.Sprintf("%s = %s", k, pkg.HCLString(v))
 				}
+			} else if strings.Contains(v, "\n") {
+				parameter = fmt.Sprintf("%s = %s", k, heredoc(v))
 			} else {
-				parameter = fmt.Sprintf(`%s = "%v"`, k, v)
+				parameter = fmt.Sprintf("%s = %s", k, pkg.HCLString(v))
 			}
-		case int:
-			parameter = fmt.Sprintf("%s = %v", k, v)
-		case bool:
+		case int, bool:
 			parameter = fmt.Sprintf("%s = %v", k, v)
+		case float64:
+			parameter = fmt.Sprintf("%s = %s", k, strconv.FormatFloat(v, 'f', -1, 64))
 		case []interface{}:
 			listValue := make([]string, 0)
 
 			for index, item := range v {
+				var element string
+
 				switch item := item.(type) {
+				case pkg.HCLExpression:
+					element = string(item)
 				case string:
-					if index+1 == len(v) {
-						listValue = append(listValue, fmt.Sprintf(`"%s"`, item))
-					} else {
-						listValue = append(listValue, fmt.Sprintf(`"%s",`, item))
-					}
-				case int:
-					if index+1 == len(v) {
-						listValue = append(listValue, fmt.Sprintf("%v", item))
-					} else {
-						listValue = append(listValue, fmt.Sprintf("%v,", item))
-					}
+					element = pkg.HCLString(item)
+				case int, bool:
+					element = fmt.Sprintf("%v", item)
+				case float64:
+					element = strconv.FormatFloat(item, 'f', -1, 64)
+				default:
+					continue
 				}
+
+				if index+1 != len(v) {
+					element += ","
+				}
+
+				listValue = append(listValue, element)
 			}
 
 			parameter = fmt.Sprintf("%s = %v", k, listValue)
@@ -165,3 +188,28 @@ func getValue(block string, value map[string]interface{}) string {
 
 	return parameter
 }
+
+// Returns the multiline string as a heredoc. The interpolation sequences
+// are escaped, the terminator does not match any line of the content.
+func heredoc(value string) string {
+	value = strings.ReplaceAll(value, "${", "$${")
+	value = strings.ReplaceAll(value, "%{", "%%{")
+
+	lines := strings.Split(strings.TrimSuffix(value, "\n"), "\n")
+	terminator := "EOH"
+
+	for index := 1; slices.ContainsFunc(lines, func(line string) bool {
+		return strings.TrimSpace(line) == terminator
+	}); index++ {
+		terminator = fmt.Sprintf("EOH%d", index)
+	}
+
+	return fmt.Sprintf(
+		"<<%s%s%s%s%s",
+		terminator,
+		heredocNewline,
+		strings.Join(lines, heredocNewline),
+		heredocNewline,
+		terminator,
+	)
+}
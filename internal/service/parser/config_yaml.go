@@ -7,12 +7,19 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"prism/internal/model"
+	"prism/pkg"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// YAML tag of the raw HCL expressions.
+const hclTag = "!hcl"
+
 type Parser struct{}
 
 func NewParser() *Parser {
@@ -21,9 +28,42 @@ func NewParser() *Parser {
 
 // Parsing the YAML configuration file.
 func (p *Parser) ParseYAML(file []byte) (map[string]interface{}, error) {
-	var config map[string]interface{}
+	var document yaml.Node
+
+	err := yaml.Unmarshal(file, &document)
+	if err != nil {
+		return nil, fmt.Errorf("parsing file error, %s", err)
+	}
+
+	config, err := decodeConfig(&document)
+	if err != nil {
+		return config, fmt.Errorf("parsing file error, %s", err)
+	}
+
+	if len(config) == 0 {
+		return config, fmt.Errorf("file is empty")
+	}
 
-	err := yaml.Unmarshal(file, &config)
+	return config, nil
+}
+
+// Parsing the YAML file that updates the base configuration.
+// Anchors defined in the base configuration can be used in the file.
+func (p *Parser) ParseOverlayYAML(file, base []byte) (map[string]interface{}, error) {
+	config, err := p.ParseYAML(file)
+	if err == nil || len(base) == 0 {
+		return config, err
+	}
+
+	// The file that cannot be parsed on its own can refer to the anchors
+	// of the base configuration. If it cannot be parsed with them either,
+	// the error of the file itself is returned.
+	document, overlayErr := overlayDocument(file, base)
+	if overlayErr != nil {
+		return config, err
+	}
+
+	config, err = decodeConfig(document)
 	if err != nil {
 		return config, fmt.Errorf("parsing file error, %s", err)
 	}
@@ -35,6 +75,193 @@ func (p *Parser) ParseYAML(file []byte) (map[string]interface{}, error) {
 	return config, nil
 }
 
+// Returns the document of the file parsed in one stream after the documents
+// of the base configuration. The anchors are kept between the documents
+// of a stream, so the aliases of the file refer to the nodes of the base.
+func overlayDocument(file, base []byte) (*yaml.Node, error) {
+	baseDocuments := 0
+	decoder := yaml.NewDecoder(bytes.NewReader(base))
+
+	for {
+		var document yaml.Node
+
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		baseDocuments++
+	}
+
+	decoder = yaml.NewDecoder(io.MultiReader(
+		bytes.NewReader(base),
+		strings.NewReader("\n---\n"),
+		bytes.NewReader(file),
+	))
+
+	for index := 0; ; index++ {
+		var document yaml.Node
+
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			return &document, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if index >= baseDocuments && !isEmptyDocument(&document) {
+			return &document, nil
+		}
+	}
+}
+
+// Checks whether the document has no content, such as the document
+// between the separators of the documents.
+func isEmptyDocument(document *yaml.Node) bool {
+	return len(document.Content) == 0 ||
+		(document.Content[0].Kind == yaml.ScalarNode && document.Content[0].Tag == "!!null")
+}
+
+// Decodes the YAML document into the configuration. The values
+// with the !hcl tag are decoded as the HCL expressions, the other
+// values are decoded as by the YAML decoder.
+func decodeConfig(document *yaml.Node) (map[string]interface{}, error) {
+	value, err := decodeNode(document)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	config, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the configuration must be a map")
+	}
+
+	return config, nil
+}
+
+func decodeNode(node *yaml.Node) (interface{}, error) {
+	if node.Tag == hclTag && node.Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("line %d, the %s tag can only be used with a string", node.Line, hclTag)
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+
+		return decodeNode(node.Content[0])
+	case yaml.AliasNode:
+		return decodeNode(node.Alias)
+	case yaml.MappingNode:
+		return decodeMapping(node)
+	case yaml.SequenceNode:
+		items := make([]interface{}, 0, len(node.Content))
+
+		for _, item := range node.Content {
+			value, err := decodeNode(item)
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, value)
+		}
+
+		return items, nil
+	}
+
+	if node.Tag == hclTag {
+		return pkg.HCLExpression(node.Value), nil
+	}
+
+	var value interface{}
+
+	err := node.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// Decodes the mapping, the keys of the mapping take precedence over the keys
+// of the merged mappings (<<), the first merged mapping over the next ones.
+func decodeMapping(node *yaml.Node) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	lines := make(map[string]int)
+
+	var merge *yaml.Node
+
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		key := node.Content[index]
+		if key.Kind == yaml.AliasNode {
+			key = key.Alias
+		}
+
+		if key.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d, the key of the map must be a string", key.Line)
+		}
+
+		if key.Value == "<<" && (key.Tag == "" || key.Tag == "!!merge") {
+			merge = node.Content[index+1]
+			continue
+		}
+
+		if line, ok := lines[key.Value]; ok {
+			return nil, fmt.Errorf(
+				"line %d, key %q is already defined at line %d", key.Line, key.Value, line,
+			)
+		}
+
+		value, err := decodeNode(node.Content[index+1])
+		if err != nil {
+			return nil, err
+		}
+
+		result[key.Value] = value
+		lines[key.Value] = key.Line
+	}
+
+	if merge == nil {
+		return result, nil
+	}
+
+	mappings := []*yaml.Node{merge}
+
+	if merge.Kind == yaml.SequenceNode {
+		mappings = merge.Content
+	}
+
+	for _, mapping := range mappings {
+		if mapping.Kind == yaml.AliasNode {
+			mapping = mapping.Alias
+		}
+
+		if mapping.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d, the merged value must be a map or a list of maps", merge.Line)
+		}
+
+		merged, err := decodeMapping(mapping)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range merged {
+			if _, ok := result[key]; !ok {
+				result[key] = value
+			}
+		}
+	}
+
+	return result, nil
+}
+
 // Parsing the configuration map.
 // Assembles a block structure.
 func (p *Parser) ParseConfig(
@@ -50,7 +277,7 @@ func (p *Parser) ParseConfig(
 		parameter[key] = value
 
 		switch v := value.(type) {
-		case string, int, float32, float64, bool:
+		case string, int, float32, float64, bool, pkg.HCLExpression:
 			block.Parameter = append(block.Parameter, parameter)
 		case []interface{}:
 			if checkBlock(value) {
@@ -0,0 +1,76 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package parser
+
+import (
+	"prism/pkg"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAMLExpressions(t *testing.T) {
+	config, err := NewParser().ParseYAML([]byte(`
+defaults: &defaults
+  image: !hcl local.image
+  tag: "latest"
+job:
+  <<: *defaults
+  tag: "7.2"
+  count: !hcl var.replicas
+  text: "!hcl var.replicas"
+  number: 3
+  list: [!hcl var.a, "!hcl var.b"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"image":  pkg.HCLExpression("local.image"),
+		"tag":    "7.2",
+		"count":  pkg.HCLExpression("var.replicas"),
+		"text":   "!hcl var.replicas",
+		"number": 3,
+		"list":   []interface{}{pkg.HCLExpression("var.a"), "!hcl var.b"},
+	}
+
+	if !reflect.DeepEqual(config["job"], expected) {
+		t.Errorf("got %#v, expected %#v", config["job"], expected)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{
+			name:    "expression of a map",
+			content: "job: !hcl\n  count: 1\n",
+			err:     "the !hcl tag can only be used with a string",
+		},
+		{
+			name:    "duplicate key",
+			content: "job:\n  count: 1\n  count: 2\n",
+			err:     `key "count" is already defined at line 2`,
+		},
+		{
+			name:    "merge of a string",
+			content: "job:\n  <<: text\n",
+			err:     "the merged value must be a map or a list of maps",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := NewParser().ParseYAML([]byte(test.content))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected the error %q, got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package parser
+
+import (
+	"fmt"
+	"prism/pkg"
+	"strconv"
+	"strings"
+)
+
+const (
+	ifDirective      = "$if"
+	forEachDirective = "$for_each"
+	eachValue        = "${each.value}"
+)
+
+// Evaluates the $if and $for_each directives in the configuration map.
+// Blocks with a false $if condition are removed,
+// blocks in lists with $for_each are repeated for each value,
+// ${each.value} is replaced with the current value.
+// Directive values can contain environment variables,
+// they are replaced using the resolve function.
+func (p *Parser) EvaluateDirectives(
+	config map[string]interface{},
+	resolve func(value string) (string, error),
+) error {
+	if _, ok := config[ifDirective]; ok {
+		return fmt.Errorf("%s directive cannot be specified in the job block", ifDirective)
+	}
+
+	if _, ok := config[forEachDirective]; ok {
+		return fmt.Errorf(
+			"%s directive cannot be specified in the job block", forEachDirective,
+		)
+	}
+
+	return evaluateBlock(config, resolve)
+}
+
+func evaluateBlock(
+	block map[string]interface{},
+	resolve func(value string) (string, error),
+) error {
+	for key, value := range block {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if _, ok := v[forEachDirective]; ok {
+				return fmt.Errorf(
+					"%s directive can only be specified in a list of blocks, block %s",
+					forEachDirective, key,
+				)
+			}
+
+			enabled, err := evaluateIf(v, resolve)
+			if err != nil {
+				return fmt.Errorf("failed to evaluate block %s, %s", key, err)
+			}
+
+			if !enabled {
+				delete(block, key)
+				continue
+			}
+
+			err = evaluateBlock(v, resolve)
+			if err != nil {
+				return err
+			}
+		case []interface{}:
+			if !checkBlock(v) {
+				continue
+			}
+
+			list, err := evaluateList(key, v, resolve)
+			if err != nil {
+				return err
+			}
+
+			if len(list) == 0 {
+				delete(block, key)
+				continue
+			}
+
+			block[key] = list
+		}
+	}
+
+	return nil
+}
+
+// Evaluates the directives of the blocks in the list.
+func evaluateList(
+	key string,
+	list []interface{},
+	resolve func(value string) (string, error),
+) ([]interface{}, error) {
+	var result []interface{}
+
+	for _, item := range list {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			result = append(result, item)
+			continue
+		}
+
+		blocks := []map[string]interface{}{block}
+
+		if forEach, ok := block[forEachDirective]; ok {
+			values, err := forEachValues(forEach, resolve)
+			if err != nil {
+				return result, fmt.Errorf("failed to evaluate block %s, %s", key, err)
+			}
+
+			blocks = nil
+
+			for _, value := range values {
+				repeatedBlock := replaceEachValue(block, value, true).(map[string]interface{})
+				delete(repeatedBlock, forEachDirective)
+				blocks = append(blocks, repeatedBlock)
+			}
+		}
+
+		for _, b := range blocks {
+			enabled, err := evaluateIf(b, resolve)
+			if err != nil {
+				return result, fmt.Errorf("failed to evaluate block %s, %s", key, err)
+			}
+
+			if !enabled {
+				continue
+			}
+
+			err = evaluateBlock(b, resolve)
+			if err != nil {
+				return result, err
+			}
+
+			result = append(result, b)
+		}
+	}
+
+	return result, nil
+}
+
+// Evaluates the $if condition of the block and removes the directive.
+// Returns true if the block has no condition.
+func evaluateIf(
+	block map[string]interface{},
+	resolve func(value string) (string, error),
+) (bool, error) {
+	condition, ok := block[ifDirective]
+	if !ok {
+		return true, nil
+	}
+
+	delete(block, ifDirective)
+
+	switch v := condition.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case int:
+		return v != 0, nil
+	case string:
+		value, err := resolve(v)
+		if err != nil {
+			return false, fmt.Errorf("%s directive, %s", ifDirective, err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "", "no", "off":
+			return false, nil
+		case "yes", "on":
+			return true, nil
+		}
+
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return false, fmt.Errorf(
+				"invalid %s value %q, expected a boolean", ifDirective, value,
+			)
+		}
+
+		return enabled, nil
+	}
+
+	return false, fmt.Errorf(
+		"invalid %s value %v, expected a boolean", ifDirective, condition,
+	)
+}
+
+// Returns the values of the $for_each directive.
+// The value can be a list or a comma-separated string.
+func forEachValues(
+	forEach interface{},
+	resolve func(value string) (string, error),
+) ([]string, error) {
+	var values []string
+
+	switch v := forEach.(type) {
+	case []interface{}:
+		for _, item := range v {
+			value := fmt.Sprint(item)
+
+			if s, ok := item.(string); ok {
+				resolved, err := resolve(s)
+				if err != nil {
+					return values, fmt.Errorf("%s directive, %s", forEachDirective, err)
+				}
+
+				value = resolved
+			}
+
+			values = append(values, value)
+		}
+	case string:
+		resolved, err := resolve(v)
+		if err != nil {
+			return values, fmt.Errorf("%s directive, %s", forEachDirective, err)
+		}
+
+		for _, item := range strings.Split(resolved, ",") {
+			item = strings.TrimSpace(item)
+
+			if item != "" {
+				values = append(values, item)
+			}
+		}
+	default:
+		return values, fmt.Errorf(
+			"invalid %s value %v, expected a list", forEachDirective, forEach,
+		)
+	}
+
+	return values, nil
+}
+
+// Returns a copy of the value with ${each.value} replaced.
+// In nested blocks with their own $for_each, only the directive value
+// is replaced, ${each.value} of such blocks refers to their own values.
+func replaceEachValue(value interface{}, each string, root bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+
+		if _, ok := v[forEachDirective]; ok && !root {
+			for key, item := range v {
+				result[key] = item
+			}
+
+			result[forEachDirective] = replaceEachValue(v[forEachDirective], each, false)
+			return result
+		}
+
+		for key, item := range v {
+			result[strings.ReplaceAll(key, eachValue, each)] = replaceEachValue(
+				item,
+				each,
+				false,
+			)
+		}
+
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+
+		for index, item := range v {
+			result[index] = replaceEachValue(item, each, false)
+		}
+
+		return result
+	case string:
+		return strings.ReplaceAll(v, eachValue, each)
+	case pkg.HCLExpression:
+		return pkg.HCLExpression(strings.ReplaceAll(string(v), eachValue, each))
+	}
+
+	return value
+}
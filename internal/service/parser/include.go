@@ -0,0 +1,252 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const includeDirective = "$include"
+
+// Resolves the $include directives in the configuration map.
+// The partial is specified relative to the pack directory,
+// or as <dependency>:<path> relative to the dependency pack directory.
+// Blocks from the partial are merged into the block with the directive,
+// parameters of the block take precedence over the partial.
+// In a list of blocks, a partial with a list is inserted into the list.
+func (p *Parser) ResolveIncludes(
+	config map[string]interface{},
+	include model.Include,
+) error {
+	return resolveIncludesBlock(config, include, nil)
+}
+
+func resolveIncludesBlock(
+	block map[string]interface{},
+	include model.Include,
+	stack []string,
+) error {
+	if _, ok := block[includeDirective]; ok {
+		partials, err := includeBlocks(block[includeDirective], include, stack)
+		if err != nil {
+			return err
+		}
+
+		delete(block, includeDirective)
+
+		merged := make(map[string]interface{})
+
+		for _, partial := range partials {
+			partialBlock, ok := partial.content.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("partial %s must contain a block", partial.path)
+			}
+
+			mergeBlocks(merged, partialBlock)
+		}
+
+		mergeBlocks(merged, block)
+
+		for key := range block {
+			delete(block, key)
+		}
+
+		for key, value := range merged {
+			block[key] = value
+		}
+	}
+
+	for key, value := range block {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			err := resolveIncludesBlock(v, include, stack)
+			if err != nil {
+				return err
+			}
+		case []interface{}:
+			list, err := resolveIncludesList(v, include, stack)
+			if err != nil {
+				return err
+			}
+
+			block[key] = list
+		}
+	}
+
+	return nil
+}
+
+func resolveIncludesList(
+	list []interface{},
+	include model.Include,
+	stack []string,
+) ([]interface{}, error) {
+	var result []interface{}
+
+	for _, item := range list {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			result = append(result, item)
+			continue
+		}
+
+		// A list item containing only the directive
+		// is replaced with the blocks from the partials.
+		if _, ok := block[includeDirective]; ok && len(block) == 1 {
+			partials, err := includeBlocks(block[includeDirective], include, stack)
+			if err != nil {
+				return result, err
+			}
+
+			for _, partial := range partials {
+				switch v := partial.content.(type) {
+				case []interface{}:
+					result = append(result, v...)
+				case map[string]interface{}:
+					result = append(result, v)
+				default:
+					return result, fmt.Errorf(
+						"partial %s must contain a block or a list of blocks",
+						partial.path,
+					)
+				}
+			}
+
+			continue
+		}
+
+		err := resolveIncludesBlock(block, include, stack)
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, block)
+	}
+
+	return result, nil
+}
+
+type partial struct {
+	path    string
+	content interface{}
+}
+
+// Reads the partials specified in the directive
+// and resolves the directives in them.
+func includeBlocks(
+	directive interface{},
+	include model.Include,
+	stack []string,
+) ([]partial, error) {
+	var references []string
+
+	switch v := directive.(type) {
+	case string:
+		references = append(references, v)
+	case []interface{}:
+		for _, item := range v {
+			reference, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf(
+					"invalid %s value %v, expected a path", includeDirective, item,
+				)
+			}
+
+			references = append(references, reference)
+		}
+	default:
+		return nil, fmt.Errorf(
+			"invalid %s value %v, expected a path", includeDirective, directive,
+		)
+	}
+
+	var partials []partial
+
+	for _, reference := range references {
+		path, partialInclude := includePath(reference, include)
+
+		absolutePath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get partial path %s, %s", path, err)
+		}
+
+		if slices.Contains(stack, absolutePath) {
+			return nil, fmt.Errorf(
+				"include cycle detected: %s",
+				strings.Join(append(stack, absolutePath), " -> "),
+			)
+		}
+
+		file, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read partial, %s", err)
+		}
+
+		var content interface{}
+
+		err = yaml.Unmarshal(file, &content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parsing partial %s, %s", path, err)
+		}
+
+		partialStack := append(slices.Clone(stack), absolutePath)
+
+		switch v := content.(type) {
+		case map[string]interface{}:
+			err = resolveIncludesBlock(v, partialInclude, partialStack)
+		case []interface{}:
+			content, err = resolveIncludesList(v, partialInclude, partialStack)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		partials = append(partials, partial{path: path, content: content})
+	}
+
+	return partials, nil
+}
+
+// Returns the path to the partial and the include paths
+// for the directives in the partial.
+func includePath(reference string, include model.Include) (string, model.Include) {
+	name, path, ok := strings.Cut(reference, ":")
+
+	if packDirPath, found := include.Packs[name]; ok && found {
+		partialInclude := model.Include{PackDirPath: packDirPath}
+		return filepath.Join(packDirPath, path), partialInclude
+	}
+
+	if filepath.IsAbs(reference) {
+		return reference, include
+	}
+
+	return filepath.Join(include.PackDirPath, reference), include
+}
+
+// Recursively merges the source block into the destination block.
+func mergeBlocks(destination, source map[string]interface{}) {
+	for key, value := range source {
+		sourceBlock, sourceIsBlock := value.(map[string]interface{})
+		destinationBlock, destinationIsBlock := destination[key].(map[string]interface{})
+
+		if sourceIsBlock && destinationIsBlock {
+			mergeBlocks(destinationBlock, sourceBlock)
+			continue
+		}
+
+		destination[key] = value
+	}
+}
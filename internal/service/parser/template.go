@@ -0,0 +1,113 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"prism/internal/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"gopkg.in/yaml.v3"
+)
+
+// Renders the configuration file as a Go template
+// with the values, release, namespace and pack objects.
+func (p *Parser) RenderTemplate(
+	name string,
+	file []byte,
+	data model.TemplateData,
+) ([]byte, error) {
+	return RenderTemplateDelims(name, file, data, "{{", "}}")
+}
+
+// Renders the file as a Go template with the delimiters,
+// the functions and objects are the same as in the configuration file.
+func RenderTemplateDelims(
+	name string,
+	file []byte,
+	data model.TemplateData,
+	left, right string,
+) ([]byte, error) {
+	var buf bytes.Buffer
+
+	tmpl := template.New(name).Delims(left, right).Funcs(sprig.TxtFuncMap()).Funcs(template.FuncMap{
+		"toYaml":   toYAML,
+		"required": required,
+	})
+
+	tmpl, err := tmpl.Parse(string(file))
+	if err != nil {
+		return nil, templateError(err, file)
+	}
+
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return nil, templateError(err, file)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Adds the line of the template in which the error occurred to the error.
+func templateError(err error, file []byte) error {
+	lineFormat := regexp.MustCompile(`^template: [^:]*:(\d+)`)
+
+	var execError template.ExecError
+	message := err.Error()
+
+	if errors.As(err, &execError) {
+		message = execError.Err.Error()
+	}
+
+	find := lineFormat.FindStringSubmatch(message)
+	if len(find) == 0 {
+		return fmt.Errorf("template error, %s", message)
+	}
+
+	lineNumber, _ := strconv.Atoi(find[1])
+	lines := strings.Split(string(file), "\n")
+
+	if lineNumber < 1 || lineNumber > len(lines) {
+		return fmt.Errorf("template error, %s", message)
+	}
+
+	return fmt.Errorf(
+		"template error, %s\n  %d | %s",
+		message,
+		lineNumber,
+		strings.TrimRight(lines[lineNumber-1], "\r"),
+	)
+}
+
+func toYAML(value interface{}) (string, error) {
+	content, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(content), "\n"), nil
+}
+
+// Returns an error with the message if the value is empty.
+func required(message string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, errors.New(message)
+	case string:
+		if v == "" {
+			return nil, errors.New(message)
+		}
+	}
+
+	return value, nil
+}
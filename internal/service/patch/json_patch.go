@@ -0,0 +1,371 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Applies the JSON Patch (RFC 6902) operations to the document.
+func applyJSONPatch(document interface{}, operations []interface{}) (interface{}, error) {
+	for index, item := range operations {
+		operation, ok := item.(map[string]interface{})
+		if !ok {
+			return document, fmt.Errorf("patch operation %d must be an object", index+1)
+		}
+
+		name, _ := operation["op"].(string)
+
+		var err error
+		document, err = applyOperation(document, operation)
+		if err != nil {
+			return document, fmt.Errorf("patch operation %d (%s) failed, %s", index+1, name, err)
+		}
+	}
+
+	return document, nil
+}
+
+func applyOperation(document interface{}, operation map[string]interface{}) (interface{}, error) {
+	path, ok := operation["path"].(string)
+	if !ok {
+		return document, fmt.Errorf("the path is not specified")
+	}
+
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return document, err
+	}
+
+	value, hasValue := operation["value"]
+	op, _ := operation["op"].(string)
+
+	switch op {
+	case "add", "replace", "test":
+		if !hasValue {
+			return document, fmt.Errorf("the value is not specified")
+		}
+	case "move", "copy":
+		from, ok := operation["from"].(string)
+		if !ok {
+			return document, fmt.Errorf("the from path is not specified")
+		}
+
+		fromTokens, err := parsePointer(from)
+		if err != nil {
+			return document, err
+		}
+
+		value, err = get(document, fromTokens)
+		if err != nil {
+			return document, err
+		}
+
+		if op == "move" {
+			if path != from && strings.HasPrefix(path+"/", from+"/") {
+				return document, fmt.Errorf("path %q cannot be moved into itself", from)
+			}
+
+			document, err = remove(document, fromTokens)
+			if err != nil {
+				return document, err
+			}
+		} else {
+			value = copyValue(value)
+		}
+
+		op = "add"
+	}
+
+	switch op {
+	case "add":
+		return add(document, tokens, value)
+	case "remove":
+		return remove(document, tokens)
+	case "replace":
+		return replace(document, tokens, value)
+	case "test":
+		current, err := get(document, tokens)
+		if err != nil {
+			return document, err
+		}
+
+		if !equal(current, value) {
+			return document, fmt.Errorf("value at path %q does not match", path)
+		}
+
+		return document, nil
+	}
+
+	return document, fmt.Errorf("unknown operation %q", op)
+}
+
+// Parsing the JSON Pointer (RFC 6901).
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid path %q, the path must start with /", path)
+	}
+
+	tokens := strings.Split(path[1:], "/")
+
+	for index, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[index] = strings.ReplaceAll(token, "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// Returns the value by the path.
+func get(document interface{}, tokens []string) (interface{}, error) {
+	current := document
+
+	for index, token := range tokens {
+		var err error
+
+		current, err = child(current, token)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s", pointer(tokens[:index+1]), err)
+		}
+	}
+
+	return current, nil
+}
+
+// Adds the value by the path, the value of an existing key is replaced,
+// the value is inserted into the list at the specified index or to the end ("-").
+func add(document interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return update(document, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch parent := parent.(type) {
+		case map[string]interface{}:
+			parent[token] = value
+			return parent, nil
+		case []interface{}:
+			if token == "-" {
+				return append(parent, value), nil
+			}
+
+			index, err := listIndex(token, len(parent)+1)
+			if err != nil {
+				return parent, err
+			}
+
+			parent = append(parent, nil)
+			copy(parent[index+1:], parent[index:])
+			parent[index] = value
+
+			return parent, nil
+		}
+
+		return parent, fmt.Errorf("cannot be added, the parent value is not an object or a list")
+	})
+}
+
+// Replaces the existing value by the path, the list item is replaced in place.
+func replace(document interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return update(document, tokens, func(parent interface{}, token string) (interface{}, error) {
+		_, err := child(parent, token)
+		if err != nil {
+			return parent, err
+		}
+
+		switch parent := parent.(type) {
+		case map[string]interface{}:
+			parent[token] = value
+		case []interface{}:
+			index, _ := listIndex(token, len(parent))
+			parent[index] = value
+		}
+
+		return parent, nil
+	})
+}
+
+// Removes the value by the path.
+func remove(document interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return document, fmt.Errorf("the job block cannot be removed")
+	}
+
+	return update(document, tokens, func(parent interface{}, token string) (interface{}, error) {
+		_, err := child(parent, token)
+		if err != nil {
+			return parent, err
+		}
+
+		switch parent := parent.(type) {
+		case map[string]interface{}:
+			delete(parent, token)
+			return parent, nil
+		case []interface{}:
+			index, _ := listIndex(token, len(parent))
+			return append(parent[:index:index], parent[index+1:]...), nil
+		}
+
+		return parent, nil
+	})
+}
+
+// Applies the change to the parent of the value by the path
+// and returns the changed document.
+func update(
+	document interface{},
+	tokens []string,
+	change func(parent interface{}, token string) (interface{}, error),
+) (interface{}, error) {
+	var apply func(current interface{}, index int) (interface{}, error)
+
+	apply = func(current interface{}, index int) (interface{}, error) {
+		if index == len(tokens)-1 {
+			result, err := change(current, tokens[index])
+			if err != nil {
+				return result, fmt.Errorf("%s %s", pointer(tokens), err)
+			}
+
+			return result, nil
+		}
+
+		next, err := child(current, tokens[index])
+		if err != nil {
+			return current, fmt.Errorf("%s %s", pointer(tokens[:index+1]), err)
+		}
+
+		next, err = apply(next, index+1)
+		if err != nil {
+			return current, err
+		}
+
+		switch current := current.(type) {
+		case map[string]interface{}:
+			current[tokens[index]] = next
+		case []interface{}:
+			position, _ := listIndex(tokens[index], len(current))
+			current[position] = next
+		}
+
+		return current, nil
+	}
+
+	return apply(document, 0)
+}
+
+// Returns the value of the object key or the list item.
+func child(value interface{}, token string) (interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		item, ok := value[token]
+		if !ok {
+			return nil, fmt.Errorf("not found%s", available(value))
+		}
+
+		return item, nil
+	case []interface{}:
+		index, err := listIndex(token, len(value))
+		if err != nil {
+			return nil, err
+		}
+
+		return value[index], nil
+	}
+
+	return nil, fmt.Errorf("not found, the parent value is not an object or a list")
+}
+
+// Returns the list of keys of the object for the error message.
+func available(value map[string]interface{}) string {
+	if len(value) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(value))
+
+	for key := range value {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return fmt.Sprintf(" (available: %s)", strings.Join(keys, ", "))
+}
+
+func listIndex(token string, length int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("is not a valid list index")
+	}
+
+	if index >= length {
+		return 0, fmt.Errorf("is out of range of the list")
+	}
+
+	return index, nil
+}
+
+func pointer(tokens []string) string {
+	var path strings.Builder
+
+	for _, token := range tokens {
+		token = strings.ReplaceAll(token, "~", "~0")
+		path.WriteString("/" + strings.ReplaceAll(token, "/", "~1"))
+	}
+
+	return fmt.Sprintf("path %q", path.String())
+}
+
+// Compares the values by their JSON representation.
+func equal(a, b interface{}) bool {
+	first, err := json.Marshal(normalizeValue(a))
+	if err != nil {
+		return false
+	}
+
+	second, err := json.Marshal(normalizeValue(b))
+	if err != nil {
+		return false
+	}
+
+	return string(first) == string(second)
+}
+
+// Applies the JSON Merge Patch (RFC 7386) to the document.
+func mergePatch(document, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	object, ok := document.(map[string]interface{})
+	if !ok {
+		object = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(object, key)
+			continue
+		}
+
+		object[key] = mergePatch(object[key], value)
+	}
+
+	return object
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package patch
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, value string) interface{} {
+	var result interface{}
+
+	err := json.Unmarshal([]byte(value), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		document   string
+		operations string
+		expected   string
+	}{
+		{
+			name:       "replace list item",
+			document:   `{"tags": ["a", "b"]}`,
+			operations: `[{"op": "replace", "path": "/tags/0", "value": "x"}]`,
+			expected:   `{"tags": ["x", "b"]}`,
+		},
+		{
+			name:       "replace last list item",
+			document:   `{"tags": ["a", "b"]}`,
+			operations: `[{"op": "replace", "path": "/tags/1", "value": "x"}]`,
+			expected:   `{"tags": ["a", "x"]}`,
+		},
+		{
+			name:       "replace object key",
+			document:   `{"meta": {"a": "1", "b": "2"}}`,
+			operations: `[{"op": "replace", "path": "/meta/a", "value": "x"}]`,
+			expected:   `{"meta": {"a": "x", "b": "2"}}`,
+		},
+		{
+			name:       "add list item",
+			document:   `{"tags": ["a", "b"]}`,
+			operations: `[{"op": "add", "path": "/tags/1", "value": "x"}, {"op": "add", "path": "/tags/-", "value": "y"}]`,
+			expected:   `{"tags": ["a", "x", "b", "y"]}`,
+		},
+		{
+			name:       "move list item",
+			document:   `{"tags": ["a", "b", "c"]}`,
+			operations: `[{"op": "move", "from": "/tags/0", "path": "/tags/2"}]`,
+			expected:   `{"tags": ["b", "c", "a"]}`,
+		},
+		{
+			name:       "move list item to object",
+			document:   `{"tags": ["a", "b"], "meta": {}}`,
+			operations: `[{"op": "move", "from": "/tags/1", "path": "/meta/tag"}]`,
+			expected:   `{"tags": ["a"], "meta": {"tag": "b"}}`,
+		},
+		{
+			name:       "move object key",
+			document:   `{"meta": {"a": "1"}, "env": {}}`,
+			operations: `[{"op": "move", "from": "/meta/a", "path": "/env/A"}]`,
+			expected:   `{"meta": {}, "env": {"A": "1"}}`,
+		},
+		{
+			name:       "copy list item",
+			document:   `{"tags": ["a", "b"]}`,
+			operations: `[{"op": "copy", "from": "/tags/1", "path": "/tags/0"}]`,
+			expected:   `{"tags": ["b", "a", "b"]}`,
+		},
+		{
+			name:       "copy object",
+			document:   `{"meta": {"a": "1"}}`,
+			operations: `[{"op": "copy", "from": "/meta", "path": "/env"}, {"op": "replace", "path": "/env/a", "value": "2"}]`,
+			expected:   `{"meta": {"a": "1"}, "env": {"a": "2"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		operations, _ := decodeJSON(t, test.operations).([]interface{})
+
+		result, err := applyJSONPatch(decodeJSON(t, test.document), operations)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if !equal(result, decodeJSON(t, test.expected)) {
+			got, _ := json.Marshal(result)
+			t.Errorf("%s: got %s, expected %s", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations string
+		err        string
+	}{
+		{
+			name:       "replace missing list item",
+			operations: `[{"op": "replace", "path": "/tags/2", "value": "x"}]`,
+			err:        "is out of range of the list",
+		},
+		{
+			name:       "replace end of list",
+			operations: `[{"op": "replace", "path": "/tags/-", "value": "x"}]`,
+			err:        "is not a valid list index",
+		},
+		{
+			name:       "replace missing key",
+			operations: `[{"op": "replace", "path": "/meta/b", "value": "x"}]`,
+			err:        "not found",
+		},
+		{
+			name:       "move into itself",
+			operations: `[{"op": "move", "from": "/meta", "path": "/meta/a/b"}]`,
+			err:        "cannot be moved into itself",
+		},
+		{
+			name:       "copy missing value",
+			operations: `[{"op": "copy", "from": "/meta/b", "path": "/meta/c"}]`,
+			err:        "not found",
+		},
+	}
+
+	for _, test := range tests {
+		operations, _ := decodeJSON(t, test.operations).([]interface{})
+		document := decodeJSON(t, `{"tags": ["a", "b"], "meta": {"a": {}}}`)
+
+		_, err := applyJSONPatch(document, operations)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected the error %q, got %v", test.name, test.err, err)
+		}
+	}
+}
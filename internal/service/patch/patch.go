@@ -0,0 +1,327 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package patch
+
+import (
+	"fmt"
+	"prism/internal/model"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Parameters by which the blocks without a label are identified,
+// for other blocks the label is specified by the "name" parameter.
+var labelKeys = map[string]string{
+	"listener":     "port",
+	"path":         "path",
+	"volume_mount": "volume",
+}
+
+type Patch struct{}
+
+func NewPatch() *Patch {
+	return &Patch{}
+}
+
+// Applies the patch to the job configuration. The patch is a JSON Patch
+// (RFC 6902) if it is a list of operations, otherwise a JSON Merge Patch
+// (RFC 7386). The patch can be written in JSON or YAML.
+func (p *Patch) Apply(config *model.TemplateBlock, content []byte) error {
+	var document interface{}
+
+	err := yaml.Unmarshal(content, &document)
+	if err != nil {
+		return fmt.Errorf("parsing patch error, %s", err)
+	}
+
+	var result interface{}
+	canonical := p.Canonical(*config)
+
+	switch patch := document.(type) {
+	case []interface{}:
+		result, err = applyJSONPatch(canonical, patch)
+		if err != nil {
+			return err
+		}
+	case map[string]interface{}:
+		result = mergePatch(canonical, patch)
+	default:
+		return fmt.Errorf(
+			"patch must be a list of JSON Patch operations or a merge patch object",
+		)
+	}
+
+	value, ok := result.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("patch result must be an object")
+	}
+
+	block, err := fromCanonical(*config, value)
+	if err != nil {
+		return err
+	}
+
+	*config = block
+	return nil
+}
+
+// Returns the canonical representation of the configuration block.
+// Parameters are object keys, nested blocks are objects under the key
+// "type" or "type[label]", several blocks with the same key are a list.
+func (p *Patch) Canonical(config model.TemplateBlock) map[string]interface{} {
+	result := make(map[string]interface{})
+
+	for _, parameter := range config.Parameter {
+		for key, value := range parameter {
+			result[key] = copyValue(value)
+		}
+	}
+
+	for _, block := range config.Block {
+		key := BlockKey(block)
+		value := p.Canonical(block)
+
+		switch existing := result[key].(type) {
+		case map[string]interface{}:
+			result[key] = []interface{}{existing, value}
+		case []interface{}:
+			if isBlockList(existing) {
+				result[key] = append(existing, value)
+			}
+		case nil:
+			result[key] = value
+		}
+	}
+
+	return result
+}
+
+// Returns the key of the block in the canonical representation.
+func BlockKey(block model.TemplateBlock) string {
+	label := BlockLabel(block)
+	if label == "" {
+		return block.Type
+	}
+
+	return fmt.Sprintf("%s[%s]", block.Type, label)
+}
+
+// Returns the label of the configuration block,
+// for blocks without a label, the value of the parameter that identifies it.
+func BlockLabel(block model.TemplateBlock) string {
+	if block.Label != "" {
+		return block.Label
+	}
+
+	key := LabelKey(block.Type)
+
+	for _, parameter := range block.Parameter {
+		if value, ok := parameter[key]; ok {
+			return fmt.Sprint(value)
+		}
+	}
+
+	return ""
+}
+
+// Returns the name of the parameter that identifies the block without a label.
+func LabelKey(blockType string) string {
+	if key, ok := labelKeys[blockType]; ok {
+		return key
+	}
+
+	return "name"
+}
+
+// Creates the configuration block from the canonical representation.
+// The order of parameters and blocks of the original block is kept,
+// new parameters and blocks are added in the order of their keys.
+func fromCanonical(
+	original model.TemplateBlock,
+	value map[string]interface{},
+) (model.TemplateBlock, error) {
+	block := model.TemplateBlock{
+		Type:      original.Type,
+		Label:     original.Label,
+		Parameter: make([]map[string]interface{}, 0),
+	}
+
+	var keys []string
+	originalBlocks := make(map[string][]model.TemplateBlock)
+
+	for _, parameter := range original.Parameter {
+		for key := range parameter {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, item := range original.Block {
+		key := BlockKey(item)
+
+		if _, ok := originalBlocks[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		originalBlocks[key] = append(originalBlocks[key], item)
+	}
+
+	var newKeys []string
+
+	for key := range value {
+		if !slices.Contains(keys, key) {
+			newKeys = append(newKeys, key)
+		}
+	}
+
+	slices.Sort(newKeys)
+	keys = append(keys, newKeys...)
+
+	for _, key := range keys {
+		item, ok := value[key]
+		if !ok || item == nil {
+			continue
+		}
+
+		var blocks []map[string]interface{}
+
+		switch v := item.(type) {
+		case map[string]interface{}:
+			blocks = append(blocks, v)
+		case []interface{}:
+			if !isBlockList(v) {
+				for _, element := range v {
+					if _, ok := element.(map[string]interface{}); ok {
+						return block, fmt.Errorf(
+							"invalid value of %s, list contains both blocks and values", key,
+						)
+					}
+				}
+
+				block.Parameter = append(block.Parameter, map[string]interface{}{
+					key: normalizeValue(v),
+				})
+
+				continue
+			}
+
+			for _, element := range v {
+				blocks = append(blocks, element.(map[string]interface{}))
+			}
+		default:
+			block.Parameter = append(block.Parameter, map[string]interface{}{
+				key: normalizeValue(v),
+			})
+
+			continue
+		}
+
+		for index, blockValue := range blocks {
+			originalBlock, err := newBlock(key, blockValue)
+			if err != nil {
+				return block, err
+			}
+
+			if index < len(originalBlocks[key]) {
+				originalBlock = originalBlocks[key][index]
+			}
+
+			child, err := fromCanonical(originalBlock, blockValue)
+			if err != nil {
+				return block, err
+			}
+
+			block.Block = append(block.Block, child)
+		}
+	}
+
+	return block, nil
+}
+
+// Returns a new block for the key in the form "type" or "type[label]".
+// If the label is the value of the parameter that identifies the block,
+// the block is created without a label.
+func newBlock(key string, value map[string]interface{}) (model.TemplateBlock, error) {
+	blockType, label, ok := strings.Cut(key, "[")
+	if !ok {
+		return model.TemplateBlock{Type: key}, nil
+	}
+
+	if !strings.HasSuffix(label, "]") || blockType == "" || label == "]" {
+		return model.TemplateBlock{}, fmt.Errorf(
+			"invalid block key %q, expected type or type[label]", key,
+		)
+	}
+
+	label = strings.TrimSuffix(label, "]")
+
+	if parameter, ok := value[LabelKey(blockType)]; ok && fmt.Sprint(parameter) == label {
+		label = ""
+	}
+
+	return model.TemplateBlock{Type: blockType, Label: label}, nil
+}
+
+// Checks if the list is a list of blocks.
+func isBlockList(value []interface{}) bool {
+	if len(value) == 0 {
+		return false
+	}
+
+	for _, item := range value {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns integer numbers as int, as in the parsed configuration file.
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if v == float64(int(v)) {
+			return int(v)
+		}
+	case []interface{}:
+		list := make([]interface{}, len(v))
+
+		for index, item := range v {
+			list[index] = normalizeValue(item)
+		}
+
+		return list
+	}
+
+	return value
+}
+
+// Returns a deep copy of the value.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+
+		for key, item := range v {
+			result[key] = copyValue(item)
+		}
+
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+
+		for index, item := range v {
+			result[index] = copyValue(item)
+		}
+
+		return result
+	}
+
+	return value
+}
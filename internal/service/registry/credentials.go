@@ -0,0 +1,147 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Registry credentials.
+type credentials struct {
+	Username string
+	Secret   string
+}
+
+// Docker client configuration, "config.json".
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+func (c credentials) basic() string {
+	return base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Secret))
+}
+
+// Returns the registry credentials from the docker config file
+// ($DOCKER_CONFIG/config.json or ~/.docker/config.json),
+// including the credential helpers and the credential store.
+// If no credentials are found, empty credentials are returned.
+func dockerCredentials(host string) (credentials, error) {
+	var config dockerConfig
+
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return credentials{}, nil
+		}
+
+		configDir = filepath.Join(homeDir, ".docker")
+	}
+
+	content, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if os.IsNotExist(err) {
+		return credentials{}, nil
+	}
+
+	if err != nil {
+		return credentials{}, fmt.Errorf("failed to read docker config, %s", err)
+	}
+
+	err = json.Unmarshal(content, &config)
+	if err != nil {
+		return credentials{}, fmt.Errorf("failed to parsing docker config, %s", err)
+	}
+
+	if helper, ok := config.CredHelpers[host]; ok {
+		return credentialHelper(helper, host)
+	}
+
+	for key, auth := range config.Auths {
+		if registryHost(key) != host {
+			continue
+		}
+
+		if auth.IdentityToken != "" {
+			return credentials{Username: "<token>", Secret: auth.IdentityToken}, nil
+		}
+
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return credentials{}, fmt.Errorf("invalid docker auth for %s, %s", host, err)
+			}
+
+			username, password, _ := strings.Cut(string(decoded), ":")
+			return credentials{Username: username, Secret: password}, nil
+		}
+
+		if auth.Username != "" {
+			return credentials{Username: auth.Username, Secret: auth.Password}, nil
+		}
+	}
+
+	if config.CredsStore != "" {
+		return credentialHelper(config.CredsStore, host)
+	}
+
+	return credentials{}, nil
+}
+
+// Gets the credentials using the "docker-credential-<helper>" program.
+func credentialHelper(helper, host string) (credentials, error) {
+	var output bytes.Buffer
+
+	command := exec.Command("docker-credential-"+helper, "get")
+	command.Stdin = strings.NewReader(host)
+	command.Stdout = &output
+
+	err := command.Run()
+	if err != nil {
+		// The helper exits with an error if there are no credentials for the host.
+		return credentials{}, nil
+	}
+
+	var result struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+
+	err = json.Unmarshal(output.Bytes(), &result)
+	if err != nil {
+		return credentials{}, fmt.Errorf("failed to parsing credentials of helper %s, %s", helper, err)
+	}
+
+	return credentials{Username: result.Username, Secret: result.Secret}, nil
+}
+
+// Returns the registry host from the docker config auth key,
+// which can be specified as URL.
+func registryHost(key string) string {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	host, _, _ := strings.Cut(key, "/")
+
+	if host == "index.docker.io" {
+		return "docker.io"
+	}
+
+	return host
+}
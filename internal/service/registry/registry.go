@@ -0,0 +1,681 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"prism/internal/service/archive"
+	"prism/internal/service/signature"
+	"strings"
+	"time"
+)
+
+const (
+	ReferencePrefix = "oci://"
+
+	ArtifactMediaType  = "application/vnd.prism.pack.v1"
+	ConfigMediaType    = "application/vnd.prism.pack.config.v1+json"
+	ContentMediaType   = "application/vnd.prism.pack.content.v1.tar+gzip"
+	SignatureMediaType = "application/vnd.prism.pack.signature.v1+yaml"
+	ManifestMediaType  = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// Pack artifact reference "oci://<host>/<repository>:<tag>"
+// or "oci://<host>/<repository>@<digest>".
+type Reference struct {
+	Host       string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        descriptor        `json:"config"`
+	Layers        []descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type Registry struct {
+	archive archive.Archive
+
+	// Use plain HTTP for all registries,
+	// by default it is used only for the loopback registries.
+	PlainHTTP bool
+
+	// HTTP client used to communicate with the registry.
+	Client *http.Client
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		archive: *archive.NewArchive(),
+		Client:  &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Pushes the pack archive to the OCI registry.
+// If the tag is not specified, the pack version is used.
+// Returns the manifest digest.
+func (s *Registry) Push(archivePath, reference string) (string, error) {
+	ref, err := ParseReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	pack, err := s.archive.ReadPack(archivePath)
+	if err != nil {
+		return "", err
+	}
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = pack.PackVersion
+	}
+
+	if ref.Tag == "" {
+		return "", fmt.Errorf("tag is required to push the pack")
+	}
+
+	content, err := os.ReadFile(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read pack archive, %s", err)
+	}
+
+	config, err := json.Marshal(pack)
+	if err != nil {
+		return "", fmt.Errorf("failed to create pack config, %s", err)
+	}
+
+	session := s.newSession(ref, "pull,push")
+
+	configDescriptor, err := session.pushBlob(ConfigMediaType, config)
+	if err != nil {
+		return "", err
+	}
+
+	contentDescriptor, err := session.pushBlob(ContentMediaType, content)
+	if err != nil {
+		return "", err
+	}
+
+	contentDescriptor.Annotations = map[string]string{
+		"org.opencontainers.image.title": filepath.Base(archivePath),
+	}
+
+	layers := []descriptor{contentDescriptor}
+
+	// Push the detached signature, if the pack is signed.
+	packSignature, err := os.ReadFile(archivePath + signature.FileExtension)
+	if err == nil {
+		signatureDescriptor, err := session.pushBlob(SignatureMediaType, packSignature)
+		if err != nil {
+			return "", err
+		}
+
+		layers = append(layers, signatureDescriptor)
+	}
+
+	packManifest := manifest{
+		SchemaVersion: 2,
+		MediaType:     ManifestMediaType,
+		ArtifactType:  ArtifactMediaType,
+		Config:        configDescriptor,
+		Layers:        layers,
+		Annotations: map[string]string{
+			"org.opencontainers.image.title":       pack.Name,
+			"org.opencontainers.image.version":     pack.PackVersion,
+			"org.opencontainers.image.description": pack.Description,
+			"org.opencontainers.image.created":     time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	manifestContent, err := json.Marshal(packManifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to create manifest, %s", err)
+	}
+
+	response, err := session.do(
+		http.MethodPut,
+		fmt.Sprintf("/v2/%s/manifests/%s", ref.Repository, ref.Tag),
+		map[string]string{"Content-Type": ManifestMediaType},
+		manifestContent,
+	)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to push manifest, %s", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to push manifest, %s", responseError(response))
+	}
+
+	return digest(manifestContent), nil
+}
+
+// Pulls the pack archive from the OCI registry
+// into the destination directory. Returns the path to the archive.
+func (s *Registry) Pull(reference, destination string) (string, error) {
+	ref, err := ParseReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	session := s.newSession(ref, "pull")
+
+	packManifest, err := session.manifest()
+	if err != nil {
+		return "", err
+	}
+
+	return session.pull(packManifest, destination)
+}
+
+// Pulls the pack archive and its signature of the manifest
+// into the destination directory. Returns the path to the archive.
+func (s *session) pull(packManifest manifest, destination string) (string, error) {
+	var content, packSignature *descriptor
+
+	for index, layer := range packManifest.Layers {
+		switch layer.MediaType {
+		case ContentMediaType:
+			content = &packManifest.Layers[index]
+		case SignatureMediaType:
+			packSignature = &packManifest.Layers[index]
+		}
+	}
+
+	if content == nil {
+		return "", fmt.Errorf(
+			"%s%s/%s is not a prism pack artifact", ReferencePrefix, s.ref.Host, s.ref.Repository,
+		)
+	}
+
+	blob, err := s.pullBlob(*content)
+	if err != nil {
+		return "", err
+	}
+
+	archiveName := content.Annotations["org.opencontainers.image.title"]
+	if archiveName == "" || filepath.Base(archiveName) != archiveName {
+		archiveName = fmt.Sprintf("%s.tgz", filepath.Base(s.ref.Repository))
+	}
+
+	err = os.MkdirAll(destination, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create destination directory, %s", err)
+	}
+
+	archivePath := filepath.Join(destination, archiveName)
+
+	err = os.WriteFile(archivePath, blob, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write pack archive, %s", err)
+	}
+
+	if packSignature != nil {
+		blob, err := s.pullBlob(*packSignature)
+		if err != nil {
+			return "", err
+		}
+
+		err = os.WriteFile(archivePath+signature.FileExtension, blob, 0644)
+		if err != nil {
+			return "", fmt.Errorf("failed to write pack signature, %s", err)
+		}
+	}
+
+	return archivePath, nil
+}
+
+// Returns the pack archive pulled from the OCI registry to the cache.
+func (s *Registry) Resolve(reference string) (string, error) {
+	ref, err := ParseReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	session := s.newSession(ref, "pull")
+
+	packManifest, err := session.manifest()
+	if err != nil {
+		return "", err
+	}
+
+	var contentDigest string
+
+	for _, layer := range packManifest.Layers {
+		if layer.MediaType == ContentMediaType {
+			contentDigest = strings.TrimPrefix(layer.Digest, "sha256:")
+		}
+	}
+
+	if len(contentDigest) < 12 {
+		return "", fmt.Errorf("%s is not a prism pack artifact", reference)
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory, %s", err)
+	}
+
+	archiveDir := filepath.Join(cacheDir, "prism", "registry", "packs", contentDigest[:12])
+
+	archives, err := filepath.Glob(filepath.Join(archiveDir, "*.tgz"))
+	if err == nil && len(archives) > 0 {
+		return archives[0], nil
+	}
+
+	return session.pull(packManifest, archiveDir)
+}
+
+// Parses the pack artifact reference.
+func ParseReference(reference string) (Reference, error) {
+	var ref Reference
+
+	if !strings.HasPrefix(reference, ReferencePrefix) {
+		return ref, fmt.Errorf("reference %s must start with %s", reference, ReferencePrefix)
+	}
+
+	name := strings.TrimPrefix(reference, ReferencePrefix)
+
+	if index := strings.Index(name, "@"); index != -1 {
+		ref.Digest = name[index+1:]
+		name = name[:index]
+	}
+
+	if index := strings.LastIndex(name, ":"); index > strings.LastIndex(name, "/") {
+		ref.Tag = name[index+1:]
+		name = name[:index]
+	}
+
+	index := strings.Index(name, "/")
+	if index == -1 || index == len(name)-1 {
+		return ref, fmt.Errorf("invalid reference %s, the repository is not specified", reference)
+	}
+
+	ref.Host = name[:index]
+	ref.Repository = name[index+1:]
+
+	return ref, nil
+}
+
+// Checks whether the path is an OCI artifact reference.
+func IsReference(path string) bool {
+	return strings.HasPrefix(path, ReferencePrefix)
+}
+
+// Registry session for the single repository.
+type session struct {
+	registry *Registry
+	ref      Reference
+	scope    string
+	baseURL  string
+	token    string
+}
+
+func (s *Registry) newSession(ref Reference, actions string) *session {
+	scheme := "https"
+	if s.PlainHTTP || isLoopback(ref.Host) {
+		scheme = "http"
+	}
+
+	return &session{
+		registry: s,
+		ref:      ref,
+		scope:    fmt.Sprintf("repository:%s:%s", ref.Repository, actions),
+		baseURL:  fmt.Sprintf("%s://%s", scheme, ref.Host),
+	}
+}
+
+func (s *session) manifest() (manifest, error) {
+	var packManifest manifest
+
+	reference := s.ref.Digest
+	if reference == "" {
+		reference = s.ref.Tag
+	}
+
+	if reference == "" {
+		return packManifest, fmt.Errorf("tag or digest is required to pull the pack")
+	}
+
+	response, err := s.do(
+		http.MethodGet,
+		fmt.Sprintf("/v2/%s/manifests/%s", s.ref.Repository, reference),
+		map[string]string{"Accept": ManifestMediaType},
+		nil,
+	)
+
+	if err != nil {
+		return packManifest, fmt.Errorf("failed to get manifest, %s", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return packManifest, fmt.Errorf("failed to get manifest, %s", responseError(response))
+	}
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return packManifest, fmt.Errorf("failed to read manifest, %s", err)
+	}
+
+	if s.ref.Digest != "" && digest(content) != s.ref.Digest {
+		return packManifest, fmt.Errorf("manifest digest does not match %s", s.ref.Digest)
+	}
+
+	err = json.Unmarshal(content, &packManifest)
+	if err != nil {
+		return packManifest, fmt.Errorf("failed to parsing manifest, %s", err)
+	}
+
+	if packManifest.Config.MediaType != ConfigMediaType {
+		return packManifest, fmt.Errorf(
+			"artifact is not a prism pack, config media type \"%s\"",
+			packManifest.Config.MediaType,
+		)
+	}
+
+	return packManifest, nil
+}
+
+func (s *session) pushBlob(mediaType string, content []byte) (descriptor, error) {
+	blob := descriptor{
+		MediaType: mediaType,
+		Digest:    digest(content),
+		Size:      int64(len(content)),
+	}
+
+	// Skip the upload if the blob already exists.
+	response, err := s.do(
+		http.MethodHead,
+		fmt.Sprintf("/v2/%s/blobs/%s", s.ref.Repository, blob.Digest),
+		nil,
+		nil,
+	)
+
+	if err != nil {
+		return blob, fmt.Errorf("failed to check blob, %s", err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode == http.StatusOK {
+		return blob, nil
+	}
+
+	response, err = s.do(
+		http.MethodPost,
+		fmt.Sprintf("/v2/%s/blobs/uploads/", s.ref.Repository),
+		nil,
+		nil,
+	)
+
+	if err != nil {
+		return blob, fmt.Errorf("failed to start blob upload, %s", err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		return blob, fmt.Errorf("failed to start blob upload, %s", responseError(response))
+	}
+
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		return blob, fmt.Errorf("invalid blob upload location, %s", err)
+	}
+
+	query := location.Query()
+	query.Set("digest", blob.Digest)
+	location.RawQuery = query.Encode()
+
+	response, err = s.do(
+		http.MethodPut,
+		location.String(),
+		map[string]string{"Content-Type": "application/octet-stream"},
+		content,
+	)
+
+	if err != nil {
+		return blob, fmt.Errorf("failed to upload blob, %s", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		return blob, fmt.Errorf("failed to upload blob, %s", responseError(response))
+	}
+
+	return blob, nil
+}
+
+func (s *session) pullBlob(blob descriptor) ([]byte, error) {
+	response, err := s.do(
+		http.MethodGet,
+		fmt.Sprintf("/v2/%s/blobs/%s", s.ref.Repository, blob.Digest),
+		nil,
+		nil,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob, %s", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get blob, %s", responseError(response))
+	}
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob, %s", err)
+	}
+
+	if digest(content) != blob.Digest {
+		return nil, fmt.Errorf("blob digest does not match %s", blob.Digest)
+	}
+
+	return content, nil
+}
+
+// Sends the request to the registry.
+// If the registry requires authorization, the request is
+// repeated with the credentials from the docker config.
+func (s *session) do(
+	method, location string,
+	header map[string]string,
+	body []byte,
+) (*http.Response, error) {
+	if strings.HasPrefix(location, "/") {
+		location = s.baseURL + location
+	}
+
+	request := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequest(method, location, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		return s.registry.Client.Do(req)
+	}
+
+	authorization := ""
+	if s.token != "" {
+		authorization = "Bearer " + s.token
+	}
+
+	response, err := request(authorization)
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		return response, err
+	}
+
+	response.Body.Close()
+
+	authorization, err = s.authorize(response.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return nil, err
+	}
+
+	return request(authorization)
+}
+
+// Returns the authorization header value for the registry challenge.
+func (s *session) authorize(challenge string) (string, error) {
+	credentials, err := dockerCredentials(s.ref.Host)
+	if err != nil {
+		return "", err
+	}
+
+	scheme, parameters := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if credentials.Username == "" {
+			return "", fmt.Errorf("registry %s requires authentication", s.ref.Host)
+		}
+
+		return "Basic " + credentials.basic(), nil
+	case "bearer":
+		tokenURL, err := url.Parse(parameters["realm"])
+		if err != nil || parameters["realm"] == "" {
+			return "", fmt.Errorf("invalid authentication realm \"%s\"", parameters["realm"])
+		}
+
+		query := tokenURL.Query()
+		if parameters["service"] != "" {
+			query.Set("service", parameters["service"])
+		}
+
+		query.Set("scope", s.scope)
+		tokenURL.RawQuery = query.Encode()
+
+		req, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+		if err != nil {
+			return "", err
+		}
+
+		if credentials.Username != "" {
+			req.Header.Set("Authorization", "Basic "+credentials.basic())
+		}
+
+		response, err := s.registry.Client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("failed to get registry token, %s", err)
+		}
+
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("failed to get registry token, %s", responseError(response))
+		}
+
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+
+		err = json.NewDecoder(response.Body).Decode(&token)
+		if err != nil {
+			return "", fmt.Errorf("failed to parsing registry token, %s", err)
+		}
+
+		s.token = token.Token
+		if s.token == "" {
+			s.token = token.AccessToken
+		}
+
+		return "Bearer " + s.token, nil
+	}
+
+	return "", fmt.Errorf("unsupported registry authentication \"%s\"", scheme)
+}
+
+// Parses the "WWW-Authenticate" header value.
+func parseChallenge(challenge string) (string, map[string]string) {
+	parameters := make(map[string]string)
+
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+
+	for rest != "" {
+		var key, value string
+
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		parameters[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+
+	return scheme, parameters
+}
+
+func responseError(response *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+
+	if len(body) == 0 {
+		return fmt.Sprintf("unexpected response status \"%s\"", response.Status)
+	}
+
+	return fmt.Sprintf(
+		"unexpected response status \"%s\": %s",
+		response.Status,
+		strings.TrimSpace(string(body)),
+	)
+}
+
+func digest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+func isLoopback(host string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	if hostname == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(hostname)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"prism/internal/service/archive"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// In-process OCI registry with the endpoints used by the pack commands.
+type testRegistry struct {
+	mutex     sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	uploads   int
+	// Number of the manifest requests.
+	manifestGets int
+}
+
+func newTestRegistry(t *testing.T) (*testRegistry, string) {
+	registry := &testRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+	}
+
+	server := httptest.NewServer(registry)
+	t.Cleanup(server.Close)
+
+	return registry, strings.TrimPrefix(server.URL, "http://")
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+
+	switch {
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/blobs/uploads/"):
+		r.uploads++
+		w.Header().Set("Location", fmt.Sprintf("/v2/%supload-%d", path, r.uploads))
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPut && strings.Contains(path, "/blobs/uploads/"):
+		content, _ := io.ReadAll(req.Body)
+
+		if digest(content) != req.URL.Query().Get("digest") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		r.blobs[digest(content)] = content
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/blobs/"):
+		content, ok := r.blobs[path[strings.LastIndex(path, "/")+1:]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if req.Method == http.MethodGet {
+			w.Write(content)
+		}
+	case req.Method == http.MethodPut && strings.Contains(path, "/manifests/"):
+		content, _ := io.ReadAll(req.Body)
+
+		r.manifests[path] = content
+		r.manifests[path[:strings.LastIndex(path, "/")+1]+digest(content)] = content
+		w.WriteHeader(http.StatusCreated)
+	case req.Method == http.MethodGet && strings.Contains(path, "/manifests/"):
+		r.manifestGets++
+
+		content, ok := r.manifests[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", ManifestMediaType)
+		w.Write(content)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Creates the archive of the pack with the name and the version.
+func createTestArchive(t *testing.T, name, version string) string {
+	packDirPath := filepath.Join(t.TempDir(), name)
+
+	err := os.MkdirAll(packDirPath, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(
+		filepath.Join(packDirPath, "pack.yaml"),
+		[]byte(fmt.Sprintf("name: %s\npack_version: %s\ndescription: test pack\n", name, version)),
+		0644,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(packDirPath, "config.yaml"), []byte("job:\n  name: test\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath, err := archive.NewArchive().Create(packDirPath, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return archivePath
+}
+
+func readFile(t *testing.T, path string) []byte {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return content
+}
+
+func TestPushPullResolve(t *testing.T) {
+	testRegistry, host := newTestRegistry(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	archivePath := createTestArchive(t, "example", "1.2.0")
+	registry := NewRegistry()
+
+	manifestDigest, err := registry.Push(archivePath, ReferencePrefix+host+"/packs/example")
+	if err != nil {
+		t.Fatalf("push: %s", err)
+	}
+
+	if _, ok := testRegistry.manifests["packs/example/manifests/1.2.0"]; !ok {
+		t.Fatalf("push: the pack version is not used as the tag")
+	}
+
+	for _, reference := range []string{
+		ReferencePrefix + host + "/packs/example:1.2.0",
+		ReferencePrefix + host + "/packs/example@" + manifestDigest,
+	} {
+		pulledPath, err := registry.Pull(reference, t.TempDir())
+		if err != nil {
+			t.Fatalf("pull %s: %s", reference, err)
+		}
+
+		if filepath.Base(pulledPath) != filepath.Base(archivePath) {
+			t.Errorf("pull %s: archive name %s, expected %s", reference, filepath.Base(pulledPath), filepath.Base(archivePath))
+		}
+
+		if !bytes.Equal(readFile(t, pulledPath), readFile(t, archivePath)) {
+			t.Errorf("pull %s: the pulled archive differs from the pushed archive", reference)
+		}
+	}
+
+	reference := ReferencePrefix + host + "/packs/example:1.2.0"
+	testRegistry.manifestGets = 0
+
+	resolvedPath, err := registry.Resolve(reference)
+	if err != nil {
+		t.Fatalf("resolve: %s", err)
+	}
+
+	if testRegistry.manifestGets != 1 {
+		t.Errorf("resolve: the manifest is fetched %d times, expected once", testRegistry.manifestGets)
+	}
+
+	if !bytes.Equal(readFile(t, resolvedPath), readFile(t, archivePath)) {
+		t.Errorf("resolve: the resolved archive differs from the pushed archive")
+	}
+
+	// The archive is taken from the cache, the blobs are not fetched.
+	delete(testRegistry.blobs, digest(readFile(t, archivePath)))
+
+	cachedPath, err := registry.Resolve(reference)
+	if err != nil {
+		t.Fatalf("resolve from cache: %s", err)
+	}
+
+	if cachedPath != resolvedPath {
+		t.Errorf("resolve from cache: path %s, expected %s", cachedPath, resolvedPath)
+	}
+}
+
+func TestPullDigestMismatch(t *testing.T) {
+	testRegistry, host := newTestRegistry(t)
+
+	_, err := NewRegistry().Push(createTestArchive(t, "example", "1.0.0"), ReferencePrefix+host+"/packs/example")
+	if err != nil {
+		t.Fatalf("push: %s", err)
+	}
+
+	// The manifest of the tag is replaced in the registry.
+	testRegistry.manifests["packs/example/manifests/"+digest([]byte("other"))] =
+		testRegistry.manifests["packs/example/manifests/1.0.0"]
+
+	_, err = NewRegistry().Pull(ReferencePrefix+host+"/packs/example@"+digest([]byte("other")), t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "digest does not match") {
+		t.Errorf("pull: expected a digest error, got %v", err)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		reference string
+		expected  Reference
+	}{
+		{"oci://ghcr.io/org/pack:1.0.0", Reference{Host: "ghcr.io", Repository: "org/pack", Tag: "1.0.0"}},
+		{"oci://localhost:5000/pack", Reference{Host: "localhost:5000", Repository: "pack"}},
+		{"oci://localhost:5000/pack@sha256:abc", Reference{Host: "localhost:5000", Repository: "pack", Digest: "sha256:abc"}},
+	}
+
+	for _, test := range tests {
+		ref, err := ParseReference(test.reference)
+		if err != nil {
+			t.Errorf("%s: %s", test.reference, err)
+			continue
+		}
+
+		if ref != test.expected {
+			t.Errorf("%s: got %+v, expected %+v", test.reference, ref, test.expected)
+		}
+	}
+
+	for _, reference := range []string{"ghcr.io/org/pack", "oci://ghcr.io", "oci://ghcr.io/"} {
+		if _, err := ParseReference(reference); err == nil {
+			t.Errorf("%s: expected an error", reference)
+		}
+	}
+}
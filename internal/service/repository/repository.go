@@ -0,0 +1,706 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package repository
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"prism/internal/service/archive"
+	"prism/internal/service/signature"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	indexFileName      = "index.yaml"
+	indexAPIVersion    = "v1"
+	repositoryFileName = "repositories.yaml"
+)
+
+// Formats of the pack name, version and digest of the index entries.
+// The name and the version are used in the paths of the downloaded archives.
+var (
+	packNameFormat = regexp.MustCompile(`^[\w.-]+$`)
+	digestFormat   = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+)
+
+type Repository struct {
+	archive archive.Archive
+}
+
+func NewRepository() *Repository {
+	return &Repository{archive: *archive.NewArchive()}
+}
+
+// Adds a pack repository to the list of repositories
+// and saves its index to the cache.
+// If verification is enabled for the repository, packs
+// from it are used only with a valid signature.
+func (s *Repository) Add(repository model.Repository) error {
+	nameFormat := regexp.MustCompile(`^[\w.-]+$`)
+	if !nameFormat.MatchString(repository.Name) {
+		return fmt.Errorf("invalid repository name \"%s\"", repository.Name)
+	}
+
+	repositoryFile, err := readRepositoryFile()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range repositoryFile.Repositories {
+		if r.Name == repository.Name {
+			return fmt.Errorf("repository \"%s\" already exists", repository.Name)
+		}
+	}
+
+	repository.URL = strings.TrimSuffix(repository.URL, "/")
+
+	err = s.updateIndex(repository)
+	if err != nil {
+		return err
+	}
+
+	repositoryFile.Repositories = append(repositoryFile.Repositories, repository)
+	return writeRepositoryFile(repositoryFile)
+}
+
+// Downloads the indexes of all added repositories.
+// Returns the names of the updated repositories.
+func (s *Repository) Update() ([]string, error) {
+	var updated []string
+
+	repositoryFile, err := readRepositoryFile()
+	if err != nil {
+		return updated, err
+	}
+
+	if len(repositoryFile.Repositories) == 0 {
+		return updated, fmt.Errorf("no repositories added, use the \"repo add\" command")
+	}
+
+	for _, repository := range repositoryFile.Repositories {
+		err = s.updateIndex(repository)
+		if err != nil {
+			return updated, err
+		}
+
+		updated = append(updated, repository.Name)
+	}
+
+	return updated, nil
+}
+
+// Searches for packs in the cached repository indexes
+// by name and description of each version. Returns only the latest
+// matching version of each pack unless all versions are requested.
+func (s *Repository) Search(
+	keyword string,
+	allVersions bool,
+) ([]model.RepositorySearchResult, error) {
+	var result []model.RepositorySearchResult
+
+	repositoryFile, err := readRepositoryFile()
+	if err != nil {
+		return result, err
+	}
+
+	keyword = strings.ToLower(keyword)
+
+	for _, repository := range repositoryFile.Repositories {
+		index, err := readCachedIndex(repository.Name)
+		if err != nil {
+			return result, err
+		}
+
+		for name, entries := range index.Packs {
+			fullName := fmt.Sprintf("%s/%s", repository.Name, name)
+
+			for _, entry := range sortEntries(entries) {
+				match := strings.Contains(strings.ToLower(fullName), keyword) ||
+					strings.Contains(strings.ToLower(entry.Description), keyword)
+
+				if !match {
+					continue
+				}
+
+				result = append(result, model.RepositorySearchResult{
+					Repository: repository.Name,
+					Entry:      entry,
+				})
+
+				if !allVersions {
+					break
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a := result[i].Repository + "/" + result[i].Entry.Name
+		b := result[j].Repository + "/" + result[j].Entry.Name
+		return a < b
+	})
+
+	return result, nil
+}
+
+// Generates the repository index file for the pack archives
+// in the directory. If the base URL is not specified,
+// the archive URLs are relative to the index file.
+func (s *Repository) Index(dirPath, baseURL string) (string, error) {
+	index := model.RepositoryIndex{
+		APIVersion: indexAPIVersion,
+		Generated:  time.Now().UTC().Format(time.RFC3339),
+		Packs:      make(map[string][]model.RepositoryIndexEntry),
+	}
+
+	archives, err := filepath.Glob(filepath.Join(dirPath, "*.tgz"))
+	if err != nil {
+		return "", fmt.Errorf("failed to find pack archives, %s", err)
+	}
+
+	for _, archivePath := range archives {
+		pack, err := s.archive.ReadPack(archivePath)
+		if err != nil {
+			return "", err
+		}
+
+		digest, err := archive.Digest(archivePath)
+		if err != nil {
+			return "", err
+		}
+
+		archiveURL := filepath.Base(archivePath)
+		if baseURL != "" {
+			archiveURL = fmt.Sprintf("%s/%s", strings.TrimSuffix(baseURL, "/"), archiveURL)
+		}
+
+		entry := model.RepositoryIndexEntry{
+			Name:          pack.Name,
+			PackVersion:   pack.PackVersion,
+			DeployVersion: pack.DeployVersion,
+			Description:   pack.Description,
+			Maintainers:   pack.Maintainers,
+			NomadVersion:  pack.NomadVersion,
+			Digest:        digest,
+			URL:           archiveURL,
+		}
+
+		index.Packs[pack.Name] = sortEntries(append(index.Packs[pack.Name], entry))
+	}
+
+	content, err := yaml.Marshal(index)
+	if err != nil {
+		return "", fmt.Errorf("failed to create index file, %s", err)
+	}
+
+	indexPath := filepath.Join(dirPath, indexFileName)
+
+	err = os.WriteFile(indexPath, content, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write index file, %s", err)
+	}
+
+	return indexPath, nil
+}
+
+// Downloads the pack archive specified as "<repository>/<name>@<version>"
+// into the destination directory. Returns the path to the archive.
+func (s *Repository) Pull(reference, destination string) (string, error) {
+	repositoryName, name, version := ParseReference(reference)
+
+	repository, entry, err := s.find(repositoryName, name, version)
+	if err != nil {
+		return "", err
+	}
+
+	return s.download(repository, entry, destination)
+}
+
+// Returns the pack archive of the specified version,
+// downloaded from the repository to the cache, and the verification
+// policy of the repository. The repository can be specified by name or by URL.
+func (s *Repository) Resolve(repositoryName, name, version string) (model.ResolvedPack, error) {
+	var resolved model.ResolvedPack
+
+	repository, entry, err := s.find(repositoryName, name, version)
+	if err != nil {
+		return resolved, err
+	}
+
+	resolved.Verification = model.Verification{
+		Enabled:     repository.Verify,
+		KeyringPath: repository.Keyring,
+	}
+
+	cacheDir, err := cacheDirPath()
+	if err != nil {
+		return resolved, err
+	}
+
+	digest := strings.TrimPrefix(entry.Digest, "sha256:")
+	if len(digest) > 12 {
+		digest = digest[:12]
+	}
+
+	archiveDir := filepath.Join(
+		cacheDir,
+		"repository",
+		"packs",
+		fmt.Sprintf("%s-%s-%s", entry.Name, entry.PackVersion, digest),
+	)
+
+	archivePath := filepath.Join(
+		archiveDir,
+		fmt.Sprintf("%s-%s.tgz", entry.Name, entry.PackVersion),
+	)
+
+	if _, err := os.Stat(archivePath); err == nil {
+		resolved.ArchivePath = archivePath
+		return resolved, nil
+	}
+
+	resolved.ArchivePath, err = s.download(repository, entry, archiveDir)
+	return resolved, err
+}
+
+// Splits the pack reference "<repository>/<name>@<version>"
+// into the repository name, pack name and version.
+func ParseReference(reference string) (repository, name, version string) {
+	name = reference
+
+	if index := strings.LastIndex(name, "@"); index != -1 {
+		version = name[index+1:]
+		name = name[:index]
+	}
+
+	if index := strings.LastIndex(name, "/"); index != -1 {
+		repository = name[:index]
+		name = name[index+1:]
+	}
+
+	return repository, name, version
+}
+
+// Finds the pack version in the repository index.
+// If the repository is not specified, all added repositories are searched.
+func (s *Repository) find(
+	repositoryName, name, version string,
+) (model.Repository, model.RepositoryIndexEntry, error) {
+	var repositories []model.Repository
+
+	if isRepositoryURL(repositoryName) {
+		repository := model.Repository{Name: repositoryName, URL: repositoryName}
+
+		index, err := fetchIndex(repository)
+		if err != nil {
+			return repository, model.RepositoryIndexEntry{}, err
+		}
+
+		entry, err := findVersion(index, name, version)
+		if err != nil {
+			return repository, entry, fmt.Errorf("%s in repository %s", err, repositoryName)
+		}
+
+		return repository, entry, checkEntry(entry, repositoryName)
+	}
+
+	repositoryFile, err := readRepositoryFile()
+	if err != nil {
+		return model.Repository{}, model.RepositoryIndexEntry{}, err
+	}
+
+	for _, r := range repositoryFile.Repositories {
+		if repositoryName == "" || r.Name == repositoryName {
+			repositories = append(repositories, r)
+		}
+	}
+
+	if len(repositories) == 0 {
+		if repositoryName != "" {
+			return model.Repository{}, model.RepositoryIndexEntry{}, fmt.Errorf(
+				"repository \"%s\" not found, use the \"repo add\" command", repositoryName,
+			)
+		}
+
+		return model.Repository{}, model.RepositoryIndexEntry{}, fmt.Errorf(
+			"no repositories added, use the \"repo add\" command",
+		)
+	}
+
+	for _, repository := range repositories {
+		index, err := readCachedIndex(repository.Name)
+		if err != nil {
+			return repository, model.RepositoryIndexEntry{}, err
+		}
+
+		entry, err := findVersion(index, name, version)
+		if err == nil {
+			return repository, entry, checkEntry(entry, repository.Name)
+		}
+	}
+
+	if version == "" {
+		return model.Repository{}, model.RepositoryIndexEntry{}, fmt.Errorf(
+			"pack \"%s\" not found", name,
+		)
+	}
+
+	return model.Repository{}, model.RepositoryIndexEntry{}, fmt.Errorf(
+		"pack \"%s\" version \"%s\" not found", name, version,
+	)
+}
+
+// Checks the pack name, version and digest of the index entry.
+// The index is received from the repository, an entry without a digest
+// is not used, so each downloaded archive is verified.
+func checkEntry(entry model.RepositoryIndexEntry, repositoryName string) error {
+	if !packNameFormat.MatchString(entry.Name) || !packNameFormat.MatchString(entry.PackVersion) {
+		return fmt.Errorf(
+			"invalid pack \"%s\" version \"%s\" in repository %s",
+			entry.Name, entry.PackVersion, repositoryName,
+		)
+	}
+
+	if !digestFormat.MatchString(entry.Digest) {
+		return fmt.Errorf(
+			"pack %s-%s in repository %s has no valid digest",
+			entry.Name, entry.PackVersion, repositoryName,
+		)
+	}
+
+	return nil
+}
+
+// Downloads the pack archive and checks its digest.
+func (s *Repository) download(
+	repository model.Repository,
+	entry model.RepositoryIndexEntry,
+	destination string,
+) (string, error) {
+	archiveURL, err := resolveURL(repository.URL, entry.URL)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := fetch(archiveURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download pack %s, %s", entry.Name, err)
+	}
+
+	err = os.MkdirAll(destination, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create destination directory, %s", err)
+	}
+
+	archivePath := filepath.Join(
+		destination,
+		fmt.Sprintf("%s-%s.tgz", entry.Name, entry.PackVersion),
+	)
+
+	err = os.WriteFile(archivePath, content, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write pack archive, %s", err)
+	}
+
+	digest, err := archive.Digest(archivePath)
+	if err != nil {
+		return "", err
+	}
+
+	if digest != entry.Digest {
+		os.Remove(archivePath)
+
+		return "", fmt.Errorf(
+			"digest of pack %s-%s does not match the repository index, expected %s, got %s",
+			entry.Name, entry.PackVersion, entry.Digest, digest,
+		)
+	}
+
+	// Download the detached signature, if the pack is signed.
+	packSignature, err := fetch(archiveURL + signature.FileExtension)
+	if err == nil {
+		err = os.WriteFile(archivePath+signature.FileExtension, packSignature, 0644)
+		if err != nil {
+			return "", fmt.Errorf("failed to write pack signature, %s", err)
+		}
+	}
+
+	return archivePath, nil
+}
+
+// Downloads the repository index and saves it to the cache.
+func (s *Repository) updateIndex(repository model.Repository) error {
+	index, err := fetchIndex(repository)
+	if err != nil {
+		return err
+	}
+
+	content, err := yaml.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to save index of repository %s, %s", repository.Name, err)
+	}
+
+	indexPath, err := cachedIndexPath(repository.Name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(indexPath), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create cache directory, %s", err)
+	}
+
+	err = os.WriteFile(indexPath, content, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to save index of repository %s, %s", repository.Name, err)
+	}
+
+	return nil
+}
+
+// Returns the pack version matching the version or version constraint.
+// If the version is not specified, the latest version is returned.
+func findVersion(
+	index model.RepositoryIndex,
+	name, version string,
+) (model.RepositoryIndexEntry, error) {
+	entries, ok := index.Packs[name]
+	if !ok || len(entries) == 0 {
+		return model.RepositoryIndexEntry{}, fmt.Errorf("pack \"%s\" not found", name)
+	}
+
+	entries = sortEntries(entries)
+
+	if version == "" {
+		return entries[0], nil
+	}
+
+	for _, entry := range entries {
+		if entry.PackVersion == version {
+			return entry, nil
+		}
+	}
+
+	constraint, err := semver.NewConstraint(version)
+	if err == nil {
+		for _, entry := range entries {
+			v, err := semver.NewVersion(entry.PackVersion)
+			if err == nil && constraint.Check(v) {
+				return entry, nil
+			}
+		}
+	}
+
+	return model.RepositoryIndexEntry{}, fmt.Errorf(
+		"pack \"%s\" version \"%s\" not found", name, version,
+	)
+}
+
+// Sorts pack versions from newest to oldest.
+func sortEntries(entries []model.RepositoryIndexEntry) []model.RepositoryIndexEntry {
+	sorted := append([]model.RepositoryIndexEntry{}, entries...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, errA := semver.NewVersion(sorted[i].PackVersion)
+		b, errB := semver.NewVersion(sorted[j].PackVersion)
+
+		if errA != nil || errB != nil {
+			return sorted[i].PackVersion > sorted[j].PackVersion
+		}
+
+		return a.GreaterThan(b)
+	})
+
+	return sorted
+}
+
+func fetchIndex(repository model.Repository) (model.RepositoryIndex, error) {
+	var index model.RepositoryIndex
+
+	indexURL, err := resolveURL(repository.URL, indexFileName)
+	if err != nil {
+		return index, err
+	}
+
+	content, err := fetch(indexURL)
+	if err != nil {
+		return index, fmt.Errorf(
+			"failed to get index of repository %s, %s", repository.Name, err,
+		)
+	}
+
+	err = yaml.Unmarshal(content, &index)
+	if err != nil {
+		return index, fmt.Errorf(
+			"failed to parsing index of repository %s, %s", repository.Name, err,
+		)
+	}
+
+	return index, nil
+}
+
+func readCachedIndex(name string) (model.RepositoryIndex, error) {
+	var index model.RepositoryIndex
+
+	indexPath, err := cachedIndexPath(name)
+	if err != nil {
+		return index, err
+	}
+
+	content, err := os.ReadFile(indexPath)
+	if err != nil {
+		return index, fmt.Errorf(
+			"index of repository %s not found, use the \"repo update\" command", name,
+		)
+	}
+
+	err = yaml.Unmarshal(content, &index)
+	if err != nil {
+		return index, fmt.Errorf("failed to parsing index of repository %s, %s", name, err)
+	}
+
+	return index, nil
+}
+
+// Reads the file from the local directory or downloads it over HTTP(S).
+func fetch(location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.ReadFile(strings.TrimPrefix(location, "file://"))
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+
+	response, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status \"%s\" from %s", response.Status, location)
+	}
+
+	return io.ReadAll(response.Body)
+}
+
+// Resolves the file location relative to the repository URL.
+func resolveURL(repositoryURL, location string) (string, error) {
+	if strings.Contains(location, "://") || filepath.IsAbs(location) {
+		return location, nil
+	}
+
+	if !strings.HasPrefix(repositoryURL, "http://") && !strings.HasPrefix(repositoryURL, "https://") {
+		return filepath.Join(strings.TrimPrefix(repositoryURL, "file://"), location), nil
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(repositoryURL, "/") + "/")
+	if err != nil {
+		return "", fmt.Errorf("invalid repository url %s, %s", repositoryURL, err)
+	}
+
+	reference, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %s, %s", location, err)
+	}
+
+	return base.ResolveReference(reference).String(), nil
+}
+
+// Checks whether the repository is specified by URL or path instead of name.
+func isRepositoryURL(repository string) bool {
+	return strings.Contains(repository, "://") ||
+		strings.HasPrefix(repository, "/") ||
+		strings.HasPrefix(repository, ".")
+}
+
+func readRepositoryFile() (model.RepositoryFile, error) {
+	var repositoryFile model.RepositoryFile
+
+	filePath, err := repositoryFilePath()
+	if err != nil {
+		return repositoryFile, err
+	}
+
+	content, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return repositoryFile, nil
+	}
+
+	if err != nil {
+		return repositoryFile, fmt.Errorf("failed to read repositories file, %s", err)
+	}
+
+	err = yaml.Unmarshal(content, &repositoryFile)
+	if err != nil {
+		return repositoryFile, fmt.Errorf("failed to parsing repositories file, %s", err)
+	}
+
+	return repositoryFile, nil
+}
+
+func writeRepositoryFile(repositoryFile model.RepositoryFile) error {
+	filePath, err := repositoryFilePath()
+	if err != nil {
+		return err
+	}
+
+	content, err := yaml.Marshal(repositoryFile)
+	if err != nil {
+		return fmt.Errorf("failed to save repositories file, %s", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create config directory, %s", err)
+	}
+
+	err = os.WriteFile(filePath, content, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to save repositories file, %s", err)
+	}
+
+	return nil
+}
+
+func repositoryFilePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory, %s", err)
+	}
+
+	return filepath.Join(configDir, "prism", repositoryFileName), nil
+}
+
+func cachedIndexPath(name string) (string, error) {
+	cacheDir, err := cacheDirPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cacheDir, "repository", fmt.Sprintf("%s-index.yaml", name)), nil
+}
+
+func cacheDirPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory, %s", err)
+	}
+
+	return filepath.Join(cacheDir, "prism"), nil
+}
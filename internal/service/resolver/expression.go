@@ -0,0 +1,445 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package resolver
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const expressionStart = "${PRISM_"
+
+// Backends of the secrets referenced as ${<backend>:<path>#<key>}.
+var secretBackends = []string{"vault", "nomadvar"}
+
+// Types of the value that can be specified with the type modifier.
+var expressionTypes = []string{"string", "int", "float", "bool", "list"}
+
+// Modifiers that change the value of the variable.
+var expressionFilters = []string{"upper", "lower", "trim", "b64enc"}
+
+// Part of the value: a text or an expression.
+type part struct {
+	text       string
+	expression *expression
+}
+
+// Expression in the form ${PRISM_NAME|modifier|modifier=argument}
+// or ${<backend>:<path>#<key>|modifier} for the secrets.
+type expression struct {
+	source string
+	name   string
+	// Secret reference, the backend is empty for the environment variables.
+	backend string
+	path    string
+	key     string
+	// Value if the variable is not specified, a text with expressions.
+	fallback    []part
+	hasFallback bool
+	// Message of the error if the variable is not specified.
+	required    string
+	hasRequired bool
+	valueType   string
+	filters     []string
+}
+
+// Error of the expression syntax.
+type SyntaxError struct {
+	Value    string
+	Position int
+	Message  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf(
+		"syntax error in %q at position %d, %s", e.Value, e.Position+1, e.Message,
+	)
+}
+
+// Expression parser, the position is the index of the next character.
+type expressionParser struct {
+	value    string
+	position int
+}
+
+// Parsing the value into the texts and expressions. The escaped
+// expressions $${PRISM_...} and $${vault:...} are texts ${PRISM_...} and ${vault:...}.
+func parse(value string) ([]part, error) {
+	p := &expressionParser{value: value}
+
+	parts, err := p.parts(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return parts, nil
+}
+
+// Parsing the texts and expressions until the end of the value,
+// or until the end of the argument of the modifier ("|" or "}").
+func (p *expressionParser) parts(argument bool) ([]part, error) {
+	var parts []part
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			parts = append(parts, part{text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for p.position < len(p.value) {
+		rest := p.value[p.position:]
+
+		switch {
+		case rest[0] == '$' && isExpressionStart(rest[1:]):
+			end, err := p.closingBrace(p.position + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			text.WriteString(p.value[p.position+1 : end+1])
+			p.position = end + 1
+		case isExpressionStart(rest):
+			expression, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+
+			flush()
+			parts = append(parts, part{expression: expression})
+		case argument && (rest[0] == '|' || rest[0] == '}'):
+			flush()
+			return parts, nil
+		default:
+			text.WriteByte(rest[0])
+			p.position++
+		}
+	}
+
+	flush()
+	return parts, nil
+}
+
+// Returns the index of the brace that closes the expression at the position.
+func (p *expressionParser) closingBrace(start int) (int, error) {
+	depth := 0
+	var quote byte
+
+	for index := start; index < len(p.value); index++ {
+		char := p.value[index]
+
+		switch {
+		case quote != 0:
+			if char == '\\' {
+				index++
+			} else if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == '{':
+			depth++
+		case char == '}':
+			depth--
+
+			if depth == 0 {
+				return index, nil
+			}
+		}
+	}
+
+	return 0, p.error(start, "the expression is not closed with \"}\"")
+}
+
+// Parsing the expression at the current position.
+func (p *expressionParser) expression() (*expression, error) {
+	start := p.position
+	p.position += len("${")
+
+	nameStart := p.position
+	expr := &expression{}
+
+	if strings.HasPrefix(p.value[p.position:], "PRISM_") {
+		for p.position < len(p.value) && isNameChar(p.value[p.position]) {
+			p.position++
+		}
+
+		expr.name = p.value[nameStart:p.position]
+
+		if expr.name == "PRISM_" {
+			return nil, p.error(nameStart, "the variable name is not specified after PRISM_")
+		}
+	} else {
+		err := p.secret(expr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		if p.position >= len(p.value) {
+			return nil, p.error(start, "the expression is not closed with \"}\"")
+		}
+
+		switch p.value[p.position] {
+		case '}':
+			p.position++
+			expr.source = p.value[start:p.position]
+			return expr, nil
+		case '|':
+			p.position++
+
+			err := p.modifier(expr)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, p.error(
+				p.position,
+				fmt.Sprintf("unexpected character %q in the variable name", p.value[p.position]),
+			)
+		}
+	}
+}
+
+// Parsing the secret reference <backend>:<path>#<key> of the expression,
+// the path and the key end with "|" or "}".
+func (p *expressionParser) secret(expr *expression) error {
+	start := p.position
+
+	for p.position < len(p.value) && isSecretChar(p.value[p.position]) {
+		p.position++
+	}
+
+	expr.name = p.value[start:p.position]
+
+	backend, reference, _ := strings.Cut(expr.name, ":")
+	index := strings.LastIndex(reference, "#")
+
+	if index <= 0 || index == len(reference)-1 {
+		return p.error(start, fmt.Sprintf(
+			"the secret must be specified in the form %s:<path>#<key>", backend,
+		))
+	}
+
+	expr.backend = backend
+	expr.path = reference[:index]
+	expr.key = reference[index+1:]
+
+	return nil
+}
+
+// Parsing the modifier of the expression after "|".
+func (p *expressionParser) modifier(expr *expression) error {
+	start := p.position
+
+	for p.position < len(p.value) && isModifierChar(p.value[p.position]) {
+		p.position++
+	}
+
+	name := p.value[start:p.position]
+	if name == "" {
+		return p.error(start, "the modifier name is not specified")
+	}
+
+	hasArgument := p.position < len(p.value) && p.value[p.position] == '='
+
+	if slices.Contains(expressionFilters, name) {
+		if hasArgument {
+			return p.error(p.position, fmt.Sprintf("the %s modifier has no argument", name))
+		}
+
+		expr.filters = append(expr.filters, name)
+		return nil
+	}
+
+	if !hasArgument {
+		switch name {
+		case "default", "required", "type":
+			return p.error(p.position, fmt.Sprintf("the %s modifier requires a value", name))
+		}
+
+		return p.error(start, fmt.Sprintf("unknown modifier %q", name))
+	}
+
+	p.position++
+
+	switch name {
+	case "default":
+		if expr.hasFallback {
+			return p.error(start, "the default value is specified twice")
+		}
+
+		if expr.hasRequired {
+			return p.error(start, "default and required cannot be used together")
+		}
+
+		fallback, err := p.argument()
+		if err != nil {
+			return err
+		}
+
+		expr.fallback = fallback
+		expr.hasFallback = true
+	case "required", "type":
+		argumentStart := p.position
+
+		argument, err := p.argument()
+		if err != nil {
+			return err
+		}
+
+		var text strings.Builder
+
+		for _, item := range argument {
+			if item.expression != nil {
+				return p.error(
+					argumentStart,
+					fmt.Sprintf("the %s modifier cannot contain expressions", name),
+				)
+			}
+
+			text.WriteString(item.text)
+		}
+
+		if name == "type" {
+			if !slices.Contains(expressionTypes, text.String()) {
+				return p.error(argumentStart, fmt.Sprintf(
+					"unknown type %q (available: %s)",
+					text.String(),
+					strings.Join(expressionTypes, ", "),
+				))
+			}
+
+			expr.valueType = text.String()
+			return nil
+		}
+
+		if expr.hasFallback {
+			return p.error(start, "default and required cannot be used together")
+		}
+
+		expr.required = text.String()
+		expr.hasRequired = true
+	default:
+		return p.error(start, fmt.Sprintf("unknown modifier %q", name))
+	}
+
+	return nil
+}
+
+// Parsing the argument of the modifier, a quoted string
+// or a text with expressions until "|" or "}".
+func (p *expressionParser) argument() ([]part, error) {
+	if p.position < len(p.value) && (p.value[p.position] == '"' || p.value[p.position] == '\'') {
+		text, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+
+		return []part{{text: text}}, nil
+	}
+
+	return p.parts(true)
+}
+
+// Parsing the quoted string, the quote and backslash are escaped with a backslash.
+func (p *expressionParser) quoted() (string, error) {
+	start := p.position
+	quote := p.value[p.position]
+	p.position++
+
+	var text strings.Builder
+
+	for p.position < len(p.value) {
+		char := p.value[p.position]
+		p.position++
+
+		switch char {
+		case '\\':
+			if p.position >= len(p.value) {
+				return "", p.error(start, "the quoted string is not closed")
+			}
+
+			text.WriteByte(p.value[p.position])
+			p.position++
+		case quote:
+			if p.position < len(p.value) && p.value[p.position] != '|' && p.value[p.position] != '}' {
+				return "", p.error(p.position, "expected \"|\" or \"}\" after the quoted string")
+			}
+
+			return text.String(), nil
+		default:
+			text.WriteByte(char)
+		}
+	}
+
+	return "", p.error(start, "the quoted string is not closed")
+}
+
+func (p *expressionParser) error(position int, message string) error {
+	return &SyntaxError{Value: p.value, Position: position, Message: message}
+}
+
+// Checks whether the value starts with an expression
+// of an environment variable or a secret.
+func isExpressionStart(value string) bool {
+	if strings.HasPrefix(value, expressionStart) {
+		return true
+	}
+
+	for _, backend := range secretBackends {
+		if strings.HasPrefix(value, "${"+backend+":") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Escapes the expressions in the value, so that they are kept as text.
+func Escape(value string) string {
+	var text strings.Builder
+
+	for index := range value {
+		if value[index] == '$' && isExpressionStart(value[index:]) {
+			text.WriteByte('$')
+		}
+
+		text.WriteByte(value[index])
+	}
+
+	return text.String()
+}
+
+// Checks whether the value contains an expression.
+func hasExpression(value string) bool {
+	for index := range value {
+		if value[index] == '$' && isExpressionStart(value[index:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isNameChar(char byte) bool {
+	return char == '_' || char == '-' || char == '+' ||
+		(char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') ||
+		(char >= '0' && char <= '9')
+}
+
+func isSecretChar(char byte) bool {
+	return char != '|' && char != '}' && char != '{' && char != '$' &&
+		char != '"' && char != '\'' && char > ' '
+}
+
+func isModifierChar(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') || char == '_'
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package resolver
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"prism/internal/service/sops"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Variables specified with the values, for example with the --env flag.
+type Values struct {
+	name   string
+	values map[string]string
+}
+
+func NewValues(name string, values map[string]string) *Values {
+	return &Values{name: name, values: values}
+}
+
+func (p *Values) Name() string {
+	return p.name
+}
+
+func (p *Values) Lookup(name string) (string, bool) {
+	value, ok := p.values[name]
+	return value, ok
+}
+
+// Variables of the file with environment variables.
+// The file is read once, the names of the variables are case-insensitive.
+type File struct {
+	path   string
+	values map[string]string
+}
+
+// Reads the file with environment variables,
+// the format is determined by the file extension (yaml, json, env, ...).
+// The yaml, json and env files encrypted with SOPS are decrypted
+// in memory with the age identities or the PGP keys of GnuPG.
+func NewFile(path string, identities []string) (*File, error) {
+	vp := viper.New()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file %s, %s", path, err)
+	}
+
+	decryptor := sops.NewSops()
+	format, formatErr := sops.FileFormat(path)
+
+	if formatErr == nil && decryptor.IsEncrypted(content, format) {
+		content, err = decryptor.Decrypt(content, format, identities)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt env file %s, %s", path, err)
+		}
+
+		vp.SetConfigType(strings.TrimPrefix(filepath.Ext(path), "."))
+		err = vp.ReadConfig(bytes.NewReader(content))
+	} else {
+		vp.SetConfigFile(path)
+		err = vp.ReadInConfig()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file %s, %s", path, err)
+	}
+
+	values := make(map[string]string)
+
+	for key, value := range vp.AllSettings() {
+		if value == nil {
+			continue
+		}
+
+		values[strings.ToLower(key)] = fmt.Sprint(value)
+	}
+
+	return &File{path: path, values: values}, nil
+}
+
+func (p *File) Name() string {
+	return p.path
+}
+
+func (p *File) Lookup(name string) (string, bool) {
+	value, ok := p.values[strings.ToLower(name)]
+	return value, ok
+}
+
+// Variables of the process environment.
+type Environment struct{}
+
+func NewEnvironment() *Environment {
+	return &Environment{}
+}
+
+func (p *Environment) Name() string {
+	return "environment"
+}
+
+func (p *Environment) Lookup(name string) (string, bool) {
+	return os.LookupEnv(name)
+}
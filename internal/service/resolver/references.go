@@ -0,0 +1,117 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package resolver
+
+import (
+	"strings"
+)
+
+// Reference to the environment variable in the value.
+type Reference struct {
+	Name string
+	// Text of the default value, the expressions in it are not replaced.
+	Default    string
+	HasDefault bool
+	// Message of the required modifier.
+	Required string
+	fallback []part
+}
+
+// Returns the references to the environment variables in the value,
+// including the variables in the default values. The secrets are skipped.
+func References(value string) ([]Reference, error) {
+	if !hasExpression(value) {
+		return nil, nil
+	}
+
+	parts, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return references(parts), nil
+}
+
+func references(parts []part) []Reference {
+	var result []Reference
+
+	for _, item := range parts {
+		if item.expression == nil {
+			continue
+		}
+
+		if item.expression.backend == "" {
+			result = append(result, Reference{
+				Name:       item.expression.name,
+				Default:    partsText(item.expression.fallback),
+				HasDefault: item.expression.hasFallback,
+				Required:   item.expression.required,
+				fallback:   item.expression.fallback,
+			})
+		}
+
+		result = append(result, references(item.expression.fallback)...)
+	}
+
+	return result
+}
+
+// Returns the value of the variable of the reference and the name of
+// the source: the source of the variable or "default" for the default value.
+// Returns the variables of the default value that are not specified.
+// A default value with secrets is returned as text, the secrets are not read.
+func (r *Resolver) ReferenceValue(reference Reference) (string, string, []Missing, error) {
+	if value, source, ok := r.Lookup(reference.Name); ok {
+		return value, source, nil, nil
+	}
+
+	if !reference.HasDefault {
+		return "", "", []Missing{{Name: reference.Name, Message: reference.Required}}, nil
+	}
+
+	if hasSecret(reference.fallback) {
+		return reference.Default, "default", nil, nil
+	}
+
+	value, missing, err := r.text(reference.fallback)
+	if err != nil || len(missing) > 0 {
+		return "", "", missing, err
+	}
+
+	return value, "default", nil, nil
+}
+
+// Checks whether the parts contain a secret, also in the default values.
+func hasSecret(parts []part) bool {
+	for _, item := range parts {
+		if item.expression == nil {
+			continue
+		}
+
+		if item.expression.backend != "" || hasSecret(item.expression.fallback) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the text of the parts, the expressions are written as in the value.
+func partsText(parts []part) string {
+	var text strings.Builder
+
+	for _, item := range parts {
+		if item.expression != nil {
+			text.WriteString(item.expression.source)
+			continue
+		}
+
+		text.WriteString(item.text)
+	}
+
+	return text.String()
+}
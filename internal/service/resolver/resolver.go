@@ -0,0 +1,316 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package resolver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Variable that is not specified in any source and has no default value.
+type Missing struct {
+	Name string
+	// Message of the required modifier.
+	Message string
+}
+
+func (m Missing) String() string {
+	if m.Message == "" {
+		return m.Name
+	}
+
+	return fmt.Sprintf("%s (%s)", m.Name, m.Message)
+}
+
+// Source of the values of the variables.
+type Provider interface {
+	// Name of the source, for example the path to the file.
+	Name() string
+
+	// Returns the value of the variable and whether it is specified.
+	Lookup(name string) (string, bool)
+}
+
+// Chain of the sources of the variables, the value is taken
+// from the first source in which the variable is specified.
+// The resolver is created once per render, the sources are read
+// when they are created. The secrets of the backends are read
+// when they are used for the first time and are cached for the run.
+type Resolver struct {
+	providers []Provider
+	backends  map[string]Backend
+	// Secrets read from the backends by backend and path.
+	secrets map[string]map[string]string
+	// Values of the secrets used in the configuration.
+	sensitive []string
+}
+
+func NewResolver(providers []Provider, backends []Backend) *Resolver {
+	resolver := &Resolver{
+		providers: providers,
+		backends:  make(map[string]Backend),
+		secrets:   make(map[string]map[string]string),
+	}
+
+	for _, backend := range backends {
+		resolver.backends[backend.Name()] = backend
+	}
+
+	return resolver
+}
+
+// Returns the resolver of the environment variables: the values from
+// the command line, the files with environment variables (the last file
+// takes precedence) and the environment of the process,
+// and the backends of the secrets. The encrypted files are decrypted
+// with the age identities.
+func NewEnvResolver(
+	envVars map[string]string,
+	filePaths []string,
+	identities []string,
+	backends ...Backend,
+) (*Resolver, error) {
+	providers := []Provider{NewValues("--env", envVars)}
+
+	for index := len(filePaths) - 1; index >= 0; index-- {
+		file, err := NewFile(filePaths[index], identities)
+		if err != nil {
+			return nil, err
+		}
+
+		providers = append(providers, file)
+	}
+
+	providers = append(providers, NewEnvironment())
+	return NewResolver(providers, backends), nil
+}
+
+// Returns the value of the variable and the name of the source it is taken from.
+func (r *Resolver) Lookup(name string) (string, string, bool) {
+	for _, provider := range r.providers {
+		if value, ok := provider.Lookup(name); ok {
+			return value, provider.Name(), true
+		}
+	}
+
+	return "", "", false
+}
+
+// Returns the value of the secret key and whether it is specified.
+// The secret is read from the backend once, the values of the secrets
+// are marked as sensitive.
+func (r *Resolver) secret(backendName, path, key string) (string, bool, error) {
+	backend, ok := r.backends[backendName]
+	if !ok {
+		return "", false, fmt.Errorf("secret backend %s is not configured", backendName)
+	}
+
+	cacheKey := backendName + ":" + path
+
+	values, ok := r.secrets[cacheKey]
+	if !ok {
+		var err error
+
+		values, err = backend.Read(path)
+		if err != nil {
+			return "", false, err
+		}
+
+		r.secrets[cacheKey] = values
+	}
+
+	value, ok := values[key]
+	return value, ok, nil
+}
+
+// Returns the values of the secrets used in the configuration,
+// the values are masked in the output.
+func (r *Resolver) Sensitive() []string {
+	return append([]string{}, r.sensitive...)
+}
+
+// Marks the value as sensitive.
+func (r *Resolver) markSensitive(value string) {
+	if value != "" && !slices.Contains(r.sensitive, value) {
+		r.sensitive = append(r.sensitive, value)
+	}
+}
+
+// Evaluates the expressions in the value. If the value is one expression,
+// the result has the type specified with the type modifier or the type
+// detected from the value (int, float, bool or string). A value without
+// expressions has the detected type, a text with expressions is a string.
+// Returns the variables that are not specified and have no default.
+func (r *Resolver) Evaluate(value string) (interface{}, []Missing, error) {
+	parts, err := parse(value)
+	if err != nil {
+		return value, nil, err
+	}
+
+	if !hasExpression(value) {
+		return typedValue(value, ""), nil, nil
+	}
+
+	if len(parts) == 1 && parts[0].expression != nil {
+		expression := parts[0].expression
+
+		text, missing, err := r.evaluate(expression)
+		if err != nil || len(missing) > 0 {
+			return value, missing, err
+		}
+
+		return typedValue(text, expression.valueType), nil, nil
+	}
+
+	text, missing, err := r.text(parts)
+	if err != nil || len(missing) > 0 {
+		return value, missing, err
+	}
+
+	return text, nil, nil
+}
+
+// Replaces the expressions in the value with the values of the variables.
+// Returns the variables that are not specified and have no default.
+func (r *Resolver) Replace(value string) (string, []Missing, error) {
+	parts, err := parse(value)
+	if err != nil {
+		return value, nil, err
+	}
+
+	text, missing, err := r.text(parts)
+	if err != nil || len(missing) > 0 {
+		return value, missing, err
+	}
+
+	return text, nil, nil
+}
+
+// Replaces the expressions in the value with the values of the variables.
+// Returns an error if a variable is not found and has no default value.
+func (r *Resolver) Resolve(value string) (string, error) {
+	result, missing, err := r.Replace(value)
+	if err != nil {
+		return "", err
+	}
+
+	if len(missing) > 0 {
+		var items []string
+
+		for _, item := range missing {
+			items = append(items, item.String())
+		}
+
+		return "", fmt.Errorf("environment variables not found: %s", strings.Join(items, ", "))
+	}
+
+	return result, nil
+}
+
+// Returns the text of the parts with the values of the expressions.
+func (r *Resolver) text(parts []part) (string, []Missing, error) {
+	var text strings.Builder
+	var missing []Missing
+
+	for _, item := range parts {
+		if item.expression == nil {
+			text.WriteString(item.text)
+			continue
+		}
+
+		value, expressionMissing, err := r.evaluate(item.expression)
+		if err != nil {
+			return "", nil, err
+		}
+
+		for _, variable := range expressionMissing {
+			if !slices.Contains(missing, variable) {
+				missing = append(missing, variable)
+			}
+		}
+
+		text.WriteString(value)
+	}
+
+	return text.String(), missing, nil
+}
+
+// Returns the value of the expression: the value of the variable or
+// the default value, with the filters applied. The value is checked
+// for the type specified with the type modifier. The values of the secrets
+// are marked as sensitive, also after the filters are applied.
+func (r *Resolver) evaluate(expression *expression) (string, []Missing, error) {
+	var value string
+	var ok, sensitive bool
+
+	if expression.backend != "" {
+		var err error
+
+		value, ok, err = r.secret(expression.backend, expression.path, expression.key)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to resolve %s, %s", expression.name, err)
+		}
+
+		if ok {
+			sensitive = true
+			r.markSensitive(value)
+		}
+	} else {
+		value, _, ok = r.Lookup(expression.name)
+	}
+
+	if !ok {
+		if !expression.hasFallback {
+			return "", []Missing{{Name: expression.name, Message: expression.required}}, nil
+		}
+
+		fallback, missing, err := r.text(expression.fallback)
+		if err != nil || len(missing) > 0 {
+			return "", missing, err
+		}
+
+		value = fallback
+	}
+
+	for _, filter := range expression.filters {
+		switch filter {
+		case "upper":
+			value = strings.ToUpper(value)
+		case "lower":
+			value = strings.ToLower(value)
+		case "trim":
+			value = strings.TrimSpace(value)
+		case "b64enc":
+			value = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	}
+
+	if sensitive {
+		r.markSensitive(value)
+
+		err := checkType(value, expression.valueType)
+		if err != nil {
+			return "", nil, fmt.Errorf(
+				"invalid value of %s in %q, the secret is not a valid %s",
+				expression.name,
+				expression.source,
+				expression.valueType,
+			)
+		}
+
+		return value, nil, nil
+	}
+
+	err := checkType(value, expression.valueType)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid value of %s in %q, %s", expression.name, expression.source, err)
+	}
+
+	return value, nil, nil
+}
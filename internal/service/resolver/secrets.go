@@ -0,0 +1,252 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package resolver
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Source of the secrets referenced as ${<backend>:<path>#<key>}.
+type Backend interface {
+	// Name of the backend in the expression, for example "vault".
+	Name() string
+
+	// Returns the keys and values of the secret at the path,
+	// or nil if the secret does not exist.
+	Read(path string) (map[string]string, error)
+}
+
+// Secrets of the Vault KV secrets engine (version 1 or 2), for example
+// ${vault:secret/data/app#password}. The address, the token, the namespace
+// and the TLS parameters are read from the VAULT_* environment variables.
+type Vault struct {
+	client    *http.Client
+	address   string
+	token     string
+	namespace string
+}
+
+func NewVault() *Vault {
+	return &Vault{}
+}
+
+func (b *Vault) Name() string {
+	return "vault"
+}
+
+func (b *Vault) Read(path string) (map[string]string, error) {
+	if b.client == nil {
+		err := b.configure()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	request, err := http.NewRequest(
+		http.MethodGet,
+		fmt.Sprintf("%s/v1/%s", b.address, strings.TrimPrefix(path, "/")),
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret %s, %s", path, err)
+	}
+
+	request.Header.Set("X-Vault-Token", b.token)
+
+	if b.namespace != "" {
+		request.Header.Set("X-Vault-Namespace", b.namespace)
+	}
+
+	response, err := b.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret %s, %s", path, err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+
+		return nil, fmt.Errorf(
+			"failed to read vault secret %s, unexpected response code %d (%s)",
+			path,
+			response.StatusCode,
+			strings.TrimSpace(string(body)),
+		)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	decoder := json.NewDecoder(response.Body)
+	decoder.UseNumber()
+
+	err = decoder.Decode(&secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode vault secret %s, %s", path, err)
+	}
+
+	data := secret.Data
+
+	// The KV version 2 returns the secret in the data with the metadata.
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	values := make(map[string]string)
+
+	for key, value := range data {
+		switch v := value.(type) {
+		case nil:
+			continue
+		case string:
+			values[key] = v
+		case json.Number, bool:
+			values[key] = fmt.Sprint(v)
+		default:
+			content, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode vault secret %s, %s", path, err)
+			}
+
+			values[key] = string(content)
+		}
+	}
+
+	return values, nil
+}
+
+// Creates the HTTP client of Vault from the environment variables,
+// the token is read from ~/.vault-token if VAULT_TOKEN is not specified.
+func (b *Vault) configure() error {
+	address := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if address == "" {
+		return fmt.Errorf("failed to read vault secret, the VAULT_ADDR environment variable is not specified")
+	}
+
+	_, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("invalid value of VAULT_ADDR, %s", err)
+	}
+
+	token := os.Getenv("VAULT_TOKEN")
+
+	if token == "" {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			content, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+			if err == nil {
+				token = strings.TrimSpace(string(content))
+			}
+		}
+	}
+
+	if token == "" {
+		return fmt.Errorf("failed to read vault secret, the VAULT_TOKEN environment variable is not specified")
+	}
+
+	var insecure bool
+
+	if value := os.Getenv("VAULT_SKIP_VERIFY"); value != "" {
+		skipVerify, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value of VAULT_SKIP_VERIFY, %s", err)
+		}
+
+		insecure = skipVerify
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	client := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+
+	err = api.ConfigureTLS(client, &api.TLSConfig{
+		CACert:        os.Getenv("VAULT_CACERT"),
+		CAPath:        os.Getenv("VAULT_CAPATH"),
+		ClientCert:    os.Getenv("VAULT_CLIENT_CERT"),
+		ClientKey:     os.Getenv("VAULT_CLIENT_KEY"),
+		TLSServerName: os.Getenv("VAULT_TLS_SERVER_NAME"),
+		Insecure:      insecure,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure vault TLS, %s", err)
+	}
+
+	b.client = client
+	b.address = address
+	b.token = token
+	b.namespace = os.Getenv("VAULT_NAMESPACE")
+
+	return nil
+}
+
+// Nomad Variables of the cluster of the deployment,
+// for example ${nomadvar:nomad/jobs/app#key}.
+type NomadVariables struct {
+	config    *api.Config
+	namespace string
+	client    *api.Client
+}
+
+// The variables are read in the namespace of the deployment with the client
+// configuration of the deployment. If the configuration is not specified,
+// the NOMAD_ADDR and NOMAD_TOKEN environment variables are used.
+func NewNomadVariables(config *api.Config, namespace string) *NomadVariables {
+	return &NomadVariables{config: config, namespace: namespace}
+}
+
+func (b *NomadVariables) Name() string {
+	return "nomadvar"
+}
+
+func (b *NomadVariables) Read(path string) (map[string]string, error) {
+	if b.client == nil {
+		config := b.config
+		if config == nil {
+			config = api.DefaultConfig()
+		}
+
+		client, err := api.NewClient(config)
+		if err != nil {
+			return nil, fmt.Errorf("error create nomad api client: %s", err)
+		}
+
+		b.client = client
+	}
+
+	variable, _, err := b.client.Variables().Read(path, &api.QueryOptions{Namespace: b.namespace})
+	if errors.Is(err, api.ErrVariablePathNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read nomad variable %s, %s", path, err)
+	}
+
+	return variable.Items, nil
+}
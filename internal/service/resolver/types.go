@@ -0,0 +1,96 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package resolver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Integer without leading zeros, "007" remains a string.
+	intFormat = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	// Decimal number with a fraction, "1e3" remains a string.
+	floatFormat = regexp.MustCompile(`^-?(0|[1-9][0-9]*)\.[0-9]+$`)
+)
+
+// Checks that the value can be converted to the type.
+func checkType(value, valueType string) error {
+	var err error
+
+	switch valueType {
+	case "int":
+		_, err = strconv.Atoi(strings.TrimSpace(value))
+	case "float":
+		_, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case "bool":
+		_, err = strconv.ParseBool(strings.TrimSpace(value))
+	}
+
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", value, valueType)
+	}
+
+	return nil
+}
+
+// Returns the value converted to the type. If the type is not specified,
+// the value is an int, a float or a bool only if it is written as such.
+// The value must be checked with checkType before.
+func typedValue(value, valueType string) interface{} {
+	switch valueType {
+	case "string":
+		return value
+	case "int":
+		result, _ := strconv.Atoi(strings.TrimSpace(value))
+		return result
+	case "float":
+		result, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return result
+	case "bool":
+		result, _ := strconv.ParseBool(strings.TrimSpace(value))
+		return result
+	case "list":
+		list := make([]interface{}, 0)
+
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+
+			if item != "" {
+				list = append(list, item)
+			}
+		}
+
+		return list
+	}
+
+	switch {
+	case intFormat.MatchString(value):
+		result, err := strconv.Atoi(value)
+		if err == nil {
+			return result
+		}
+	case floatFormat.MatchString(value):
+		result, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return result
+		}
+	case value == "true" || value == "false":
+		return value == "true"
+	}
+
+	return value
+}
+
+// Checks whether the value is converted to an int, a float
+// or a bool if the type is not specified.
+func IsTypedValue(value string) bool {
+	_, ok := typedValue(value, "").(string)
+	return !ok
+}
@@ -8,11 +8,22 @@ package service
 
 import (
 	"prism/internal/model"
+	"prism/internal/service/archive"
 	"prism/internal/service/builder"
 	"prism/internal/service/deployment"
+	"prism/internal/service/importer"
+	"prism/internal/service/manifest"
 	"prism/internal/service/output"
 	"prism/internal/service/parser"
+	"prism/internal/service/patch"
 	"prism/internal/service/project"
+	"prism/internal/service/registry"
+	"prism/internal/service/repository"
+	"prism/internal/service/resolver"
+	"prism/internal/service/signature"
+	"prism/internal/service/sops"
+
+	"github.com/hashicorp/nomad/api"
 )
 
 type Project interface {
@@ -20,10 +31,94 @@ type Project interface {
 	Create(name string) (string, error)
 }
 
+type Archive interface {
+	// Packages the pack directory into an archive.
+	Create(packDirPath, destination string) (string, error)
+
+	// Extracts the pack archive into the destination directory.
+	Extract(archivePath, destination string) (string, error)
+
+	// Reads the pack file from the pack archive.
+	ReadPack(archivePath string) (model.Pack, error)
+}
+
+type Repository interface {
+	// Adds a pack repository to the list of repositories.
+	Add(repository model.Repository) error
+
+	// Downloads the indexes of all added repositories.
+	Update() ([]string, error)
+
+	// Searches for packs in the repository indexes.
+	Search(keyword string, allVersions bool) ([]model.RepositorySearchResult, error)
+
+	// Generates the repository index file for the pack archives in the directory.
+	Index(dirPath, baseURL string) (string, error)
+
+	// Downloads the pack archive into the destination directory.
+	Pull(reference, destination string) (string, error)
+
+	// Returns the pack archive downloaded from the repository
+	// and the verification policy of the repository.
+	Resolve(repository, name, version string) (model.ResolvedPack, error)
+}
+
+type Registry interface {
+	// Pushes the pack archive to the OCI registry.
+	Push(archivePath, reference string) (string, error)
+
+	// Pulls the pack archive from the OCI registry.
+	Pull(reference, destination string) (string, error)
+
+	// Returns the pack archive pulled from the OCI registry.
+	Resolve(reference string) (string, error)
+}
+
+type Signature interface {
+	// Signs the pack archive, creates a detached signature file.
+	Sign(archivePath, keyPath string) (string, error)
+
+	// Verifies the pack archive against its detached signature file.
+	Verify(archivePath, keyringPath string) (model.PackSignature, error)
+}
+
+type Sops interface {
+	// Checks whether the content of the file is encrypted with SOPS.
+	IsEncrypted(content []byte, format string) bool
+
+	// Decrypts the content of the file encrypted with SOPS.
+	Decrypt(content []byte, format string, identities []string) ([]byte, error)
+
+	// Encrypts the content of the file for the age recipients and the PGP keys.
+	Encrypt(content []byte, format string, keys model.SopsKeys) ([]byte, error)
+
+	// Opens the decrypted file in the editor and encrypts the changes.
+	Edit(path string, identities []string, keys model.SopsKeys) error
+
+	// Returns the keys of the file from the creation rules of .sops.yaml.
+	CreationKeys(path string) (model.SopsKeys, error)
+}
+
 type Parser interface {
 	// Parsing the YAML configuration file.
 	ParseYAML(file []byte) (map[string]interface{}, error)
 
+	// Parsing the YAML file that updates the base configuration.
+	// Anchors defined in the base configuration can be used in the file.
+	ParseOverlayYAML(file, base []byte) (map[string]interface{}, error)
+
+	// Resolves the $include directives in the configuration map.
+	ResolveIncludes(config map[string]interface{}, include model.Include) error
+
+	// Renders the configuration file as a Go template.
+	RenderTemplate(name string, file []byte, data model.TemplateData) ([]byte, error)
+
+	// Evaluates the $if and $for_each directives in the configuration map.
+	EvaluateDirectives(
+		config map[string]interface{},
+		resolve func(value string) (string, error),
+	) error
+
 	// Parsing the configuration map. Assembles a block structure.
 	ParseConfig(blockType string, config map[string]interface{}) model.ConfigBlock
 }
@@ -99,8 +194,28 @@ type StructureBuilder interface {
 }
 
 type Deployment interface {
-	// Returns the configuration structure.
-	CreateConfigStructure(parameter model.ConfigParameter) ([]model.TemplateBlock, error)
+	// Returns the path to the local pack directory.
+	// The pack can be specified as a directory, archive or OCI reference.
+	PackPath(path string, verification model.Verification) (string, error)
+
+	// Returns the path to the local pack directory.
+	// The pack can also be specified as a reference to the pack in the repository.
+	ResolvePack(reference, baseDirPath string, verification model.Verification) (string, error)
+
+	// Returns the configuration structure of the jobs
+	// with the transformers applied to each job.
+	CreateConfigStructure(parameter model.ConfigParameter) ([]model.RenderedJob, error)
+
+	// Returns the release declared in the pack file.
+	// Returns an error if the pack declares releases and the release is not one of them.
+	Release(path, release string, verification model.Verification) (model.PackRelease, error)
+
+	// Returns the configuration of each pack in the inheritance chain.
+	CreateConfigLayers(parameter model.ConfigParameter) ([]model.ConfigLayer, error)
+
+	// Returns the environment variables referenced in the files of the pack
+	// and its dependencies with the values of the sources of the render.
+	EnvVariables(parameter model.ConfigParameter) ([]model.EnvVariable, error)
 
 	// Checks whether the namespace exists in the cluster.
 	// If the --create-namespace flag is specified and
@@ -109,28 +224,95 @@ type Deployment interface {
 
 	// Job configuration deployment in the nomad cluster.
 	Deployment(deployment model.Deployment) (string, error)
+
+	// Plans the job configuration in the cluster.
+	Plan(deployment model.Deployment) (model.PlanResult, error)
+
+	// Stops the job of the configuration in the cluster
+	// and removes the Nomad Variables with the files of the job.
+	Destroy(deployment model.Deployment, purge bool) (string, error)
+}
+
+type Manifest interface {
+	// Reads and validates the manifest file.
+	Read(path string) (model.Manifest, error)
+
+	// Returns the releases matching all selectors in the form label=value.
+	Select(manifest model.Manifest, selectors []string) ([]model.ManifestRelease, error)
+
+	// Runs the function for each release, taking into account
+	// the dependencies between releases and the concurrency.
+	Run(
+		releases []model.ManifestRelease,
+		concurrency int,
+		reverse bool,
+		run func(release model.ManifestRelease) model.ReleaseResult,
+	) []model.ReleaseResult
+}
+
+type Importer interface {
+	// Reads the Nomad job from the HCL or JSON file.
+	// The HCL file is parsed by the Nomad cluster.
+	ReadJob(path string, client *api.Client) (*api.Job, error)
+
+	// Returns the job registered in the Nomad cluster.
+	ClusterJob(id, namespace string, client *api.Client) (*api.Job, error)
+
+	// Creates the pack with the configuration of the job.
+	CreatePack(job *api.Job, parameter model.ImportParameter) (model.ImportResult, error)
+
+	// Creates the pack from the docker-compose file.
+	CreateComposePack(path string, parameter model.ImportParameter) (model.ImportResult, error)
+
+	// Returns the differences between the source job and the job rendered from the pack.
+	Compare(source, rendered *api.Job) ([]string, error)
 }
 
 type Changes interface {
 	SetChanges(config *model.TemplateBlock, changes *model.Changes) error
+
+	// Replaces environment variables in the configuration.
+	ReplaceEnvVars(config *model.TemplateBlock, resolver *resolver.Resolver) error
+}
+
+type Patch interface {
+	// Applies the JSON Patch or JSON Merge Patch to the job configuration.
+	Apply(config *model.TemplateBlock, content []byte) error
+
+	// Returns the canonical representation of the configuration block.
+	Canonical(config model.TemplateBlock) map[string]interface{}
 }
 
 type Output interface {
 	// Returns the formated job configuration of the nomad.
-	OutputConfig(config model.TemplateBlock) (string, error)
+	// The HCL2 variable and locals blocks are written before the job.
+	OutputConfig(config model.TemplateBlock, declarations ...model.TemplateBlock) (string, error)
 
 	// Creates a nomad configuration file in .nomad.hcl format.
-	CreateConfigFile(name, path string, config model.TemplateBlock) error
+	// The comment is written before the job.
+	CreateConfigFile(
+		name, path, comment string,
+		config model.TemplateBlock,
+		declarations ...model.TemplateBlock,
+	) error
 }
 
 type Service struct {
 	Project          Project
+	Archive          Archive
+	Repository       Repository
+	Registry         Registry
+	Signature        Signature
+	Sops             Sops
 	Output           Output
 	Parser           Parser
 	BlockBuilder     BlockBuilder
 	StructureBuilder StructureBuilder
 	Changes          Changes
+	Patch            Patch
 	Deployment       Deployment
+	Manifest         Manifest
+	Importer         Importer
 }
 
 func NewService(
@@ -139,14 +321,24 @@ func NewService(
 	sb *builder.StructureBuilder,
 	c *builder.Changes,
 	o *output.Output,
+	r *repository.Repository,
+	rg *registry.Registry,
 ) *Service {
 	return &Service{
 		Project:          project.NewProject(),
+		Archive:          archive.NewArchive(),
+		Repository:       repository.NewRepository(),
+		Registry:         registry.NewRegistry(),
+		Signature:        signature.NewSignature(),
+		Sops:             sops.NewSops(),
 		Output:           output.NewOutput(),
 		Parser:           parser.NewParser(),
 		BlockBuilder:     builder.NewBlockBuilder(),
 		StructureBuilder: builder.NewStructureBuilder(*bb),
 		Changes:          builder.NewChanges(),
-		Deployment:       deployment.NewDeployment(*p, *sb, *c),
+		Patch:            patch.NewPatch(),
+		Deployment:       deployment.NewDeployment(*p, *sb, *c, *r, *rg),
+		Manifest:         manifest.NewManifest(),
+		Importer:         importer.NewImporter(),
 	}
 }
@@ -0,0 +1,271 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"prism/internal/model"
+	"prism/internal/service/archive"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Extension of the detached signature file,
+// created next to the pack archive.
+const FileExtension = ".sig"
+
+type Signature struct {
+	archive archive.Archive
+}
+
+func NewSignature() *Signature {
+	return &Signature{archive: *archive.NewArchive()}
+}
+
+// Signs the pack archive with the ed25519 private key (PEM, PKCS #8).
+// Creates the detached signature file "<archive>.sig"
+// and returns the path to it.
+func (s *Signature) Sign(archivePath, keyPath string) (string, error) {
+	privateKey, err := readPrivateKey(keyPath)
+	if err != nil {
+		return "", err
+	}
+
+	packSignature, err := s.metadata(archivePath)
+	if err != nil {
+		return "", err
+	}
+
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+
+	packSignature.KeyID = KeyID(publicKey)
+	packSignature.Created = time.Now().UTC().Format(time.RFC3339)
+	packSignature.Signature = base64.StdEncoding.EncodeToString(
+		ed25519.Sign(privateKey, payload(packSignature)),
+	)
+
+	content, err := yaml.Marshal(packSignature)
+	if err != nil {
+		return "", fmt.Errorf("failed to create signature, %s", err)
+	}
+
+	signaturePath := archivePath + FileExtension
+
+	err = os.WriteFile(signaturePath, content, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write signature, %s", err)
+	}
+
+	return signaturePath, nil
+}
+
+// Verifies the pack archive against its detached signature file
+// using the keyring of trusted ed25519 public keys.
+// The keyring is a PEM file with one or more public keys,
+// or a directory with such files.
+func (s *Signature) Verify(archivePath, keyringPath string) (model.PackSignature, error) {
+	var packSignature model.PackSignature
+
+	content, err := os.ReadFile(archivePath + FileExtension)
+	if os.IsNotExist(err) {
+		return packSignature, fmt.Errorf("pack %s is not signed", filepath.Base(archivePath))
+	}
+
+	if err != nil {
+		return packSignature, fmt.Errorf("failed to read signature, %s", err)
+	}
+
+	err = yaml.Unmarshal(content, &packSignature)
+	if err != nil {
+		return packSignature, fmt.Errorf("failed to parsing signature, %s", err)
+	}
+
+	metadata, err := s.metadata(archivePath)
+	if err != nil {
+		return packSignature, err
+	}
+
+	if metadata.Digest != packSignature.Digest {
+		return packSignature, fmt.Errorf(
+			"pack %s has been modified, digest %s does not match the signature",
+			filepath.Base(archivePath), metadata.Digest,
+		)
+	}
+
+	if metadata.Name != packSignature.Name ||
+		metadata.PackVersion != packSignature.PackVersion ||
+		metadata.DeployVersion != packSignature.DeployVersion {
+		return packSignature, fmt.Errorf(
+			"pack %s metadata does not match the signature",
+			filepath.Base(archivePath),
+		)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(packSignature.Signature)
+	if err != nil {
+		return packSignature, fmt.Errorf("invalid signature, %s", err)
+	}
+
+	keyring, err := readKeyring(keyringPath)
+	if err != nil {
+		return packSignature, err
+	}
+
+	publicKey, ok := keyring[packSignature.KeyID]
+	if !ok {
+		return packSignature, fmt.Errorf(
+			"pack %s is signed with an untrusted key %s",
+			filepath.Base(archivePath), packSignature.KeyID,
+		)
+	}
+
+	if !ed25519.Verify(publicKey, payload(packSignature), signature) {
+		return packSignature, fmt.Errorf(
+			"invalid signature of pack %s", filepath.Base(archivePath),
+		)
+	}
+
+	return packSignature, nil
+}
+
+// Returns the key identifier, the first 8 bytes
+// of the SHA-256 hash of the public key in hex.
+func KeyID(publicKey ed25519.PublicKey) string {
+	hash := sha256.Sum256(publicKey)
+	return fmt.Sprintf("%x", hash[:8])
+}
+
+// Returns the signed pack metadata of the archive.
+func (s *Signature) metadata(archivePath string) (model.PackSignature, error) {
+	var packSignature model.PackSignature
+
+	pack, err := s.archive.ReadPack(archivePath)
+	if err != nil {
+		return packSignature, err
+	}
+
+	digest, err := archive.Digest(archivePath)
+	if err != nil {
+		return packSignature, err
+	}
+
+	packSignature = model.PackSignature{
+		Name:          pack.Name,
+		PackVersion:   pack.PackVersion,
+		DeployVersion: pack.DeployVersion,
+		Digest:        digest,
+	}
+
+	return packSignature, nil
+}
+
+// Returns the signed data, the archive digest and pack metadata.
+func payload(packSignature model.PackSignature) []byte {
+	return []byte(fmt.Sprintf(
+		"prism-pack-signature-v1\nname:%s\npack_version:%s\ndeploy_version:%s\ndigest:%s\n",
+		packSignature.Name,
+		packSignature.PackVersion,
+		packSignature.DeployVersion,
+		packSignature.Digest,
+	))
+}
+
+func readPrivateKey(keyPath string) (ed25519.PrivateKey, error) {
+	content, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key, %s", err)
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("key %s is not PEM encoded", keyPath)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parsing key %s, %s", keyPath, err)
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key %s is not an ed25519 private key", keyPath)
+	}
+
+	return privateKey, nil
+}
+
+// Reads the trusted public keys, returns them by key identifier.
+func readKeyring(keyringPath string) (map[string]ed25519.PublicKey, error) {
+	keyring := make(map[string]ed25519.PublicKey)
+	files := []string{keyringPath}
+
+	if keyringPath == "" {
+		return keyring, fmt.Errorf("keyring is not specified")
+	}
+
+	info, err := os.Stat(keyringPath)
+	if err != nil {
+		return keyring, fmt.Errorf("failed to read keyring, %s", err)
+	}
+
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(keyringPath, "*.pem"))
+		if err != nil {
+			return keyring, fmt.Errorf("failed to read keyring, %s", err)
+		}
+
+		pub, err := filepath.Glob(filepath.Join(keyringPath, "*.pub"))
+		if err != nil {
+			return keyring, fmt.Errorf("failed to read keyring, %s", err)
+		}
+
+		files = append(files, pub...)
+	}
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return keyring, fmt.Errorf("failed to read keyring, %s", err)
+		}
+
+		for {
+			var block *pem.Block
+
+			block, content = pem.Decode(content)
+			if block == nil {
+				break
+			}
+
+			if block.Type != "PUBLIC KEY" {
+				continue
+			}
+
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return keyring, fmt.Errorf("failed to parsing public key in %s, %s", file, err)
+			}
+
+			if publicKey, ok := key.(ed25519.PublicKey); ok {
+				keyring[KeyID(publicKey)] = publicKey
+			}
+		}
+	}
+
+	if len(keyring) == 0 {
+		return keyring, fmt.Errorf("no ed25519 public keys found in keyring %s", keyringPath)
+	}
+
+	return keyring, nil
+}
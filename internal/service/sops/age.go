@@ -0,0 +1,141 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Parses the recipient in the form age1...
+func parseAgeRecipient(value string) (age.Recipient, error) {
+	recipient, err := age.ParseX25519Recipient(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient %s, %s", value, err)
+	}
+
+	return recipient, nil
+}
+
+// Reads the age identities: the files specified with the --age-identity
+// flag, the SOPS_AGE_KEY and SOPS_AGE_KEY_FILE environment variables
+// and the default key file of SOPS (<config dir>/sops/age/keys.txt).
+func readAgeIdentities(paths []string) ([]age.Identity, error) {
+	var identities []age.Identity
+
+	parse := func(content, source string) error {
+		parsed, err := age.ParseIdentities(strings.NewReader(content))
+		if err != nil {
+			return fmt.Errorf("failed to read age identities from %s, %s", source, err)
+		}
+
+		identities = append(identities, parsed...)
+		return nil
+	}
+
+	readFile := func(path string, optional bool) error {
+		content, err := os.ReadFile(path)
+		if optional && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read age identities, %s", err)
+		}
+
+		return parse(string(content), path)
+	}
+
+	for _, path := range paths {
+		err := readFile(path, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if value := os.Getenv("SOPS_AGE_KEY"); value != "" {
+		err := parse(value, "SOPS_AGE_KEY")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if path := os.Getenv("SOPS_AGE_KEY_FILE"); path != "" {
+		err := readFile(path, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err == nil {
+		err = readFile(filepath.Join(configDir, "sops", "age", "keys.txt"), true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return identities, nil
+}
+
+// Encrypts the data for the recipient and returns the age file
+// in the ASCII armor, as the data key is stored by SOPS.
+func ageEncrypt(data []byte, recipient age.Recipient) ([]byte, error) {
+	var buf bytes.Buffer
+
+	armorWriter := armor.NewWriter(&buf)
+
+	writer, err := age.Encrypt(armorWriter, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = armorWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decrypts the armored or binary age file with the identities.
+func ageDecrypt(content []byte, identities []age.Identity) ([]byte, error) {
+	if len(identities) == 0 {
+		return nil, errors.New("no age identities")
+	}
+
+	var reader io.Reader = bytes.NewReader(content)
+
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte(armor.Header)) {
+		reader = armor.NewReader(reader)
+	}
+
+	decrypted, err := age.Decrypt(reader, identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(decrypted)
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sops
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Encrypted value of SOPS, the additional data is the path of the value.
+var encryptedFormat = regexp.MustCompile(
+	`^ENC\[AES256_GCM,data:(.*),iv:(.*),tag:(.*),type:(.*)\]$`,
+)
+
+// Size of the initialization vector of the values, as in SOPS.
+const ivSize = 32
+
+// Checks whether the value is encrypted.
+func isEncryptedValue(value string) bool {
+	return encryptedFormat.MatchString(value)
+}
+
+// Encrypts the value with the data key, the type is one of
+// str, int, float, bool or comment. An empty value is not encrypted.
+// The booleans are encrypted as in SOPS ("True" and "False").
+func encryptValue(value, valueType string, key []byte, additionalData string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	value = macValue(value, valueType)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt value, %s", err)
+	}
+
+	gcm, err := cipher.NewGCMWithNonceSize(block, ivSize)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt value, %s", err)
+	}
+
+	iv := make([]byte, ivSize)
+
+	_, err = rand.Read(iv)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt value, %s", err)
+	}
+
+	sealed := gcm.Seal(nil, iv, []byte(value), []byte(additionalData))
+	tagStart := len(sealed) - gcm.Overhead()
+
+	return fmt.Sprintf(
+		"ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]",
+		base64.StdEncoding.EncodeToString(sealed[:tagStart]),
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(sealed[tagStart:]),
+		valueType,
+	), nil
+}
+
+// Decrypts the value with the data key.
+// Returns the value and its type, the booleans are "true" or "false".
+func decryptValue(value string, key []byte, additionalData string) (string, string, error) {
+	if value == "" {
+		return "", "str", nil
+	}
+
+	match := encryptedFormat.FindStringSubmatch(value)
+	if match == nil {
+		return "", "", fmt.Errorf("invalid encrypted value format")
+	}
+
+	var parts [3][]byte
+
+	for index := range parts {
+		decoded, err := base64.StdEncoding.DecodeString(match[index+1])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid encrypted value, %s", err)
+		}
+
+		parts[index] = decoded
+	}
+
+	data, iv, tag := parts[0], parts[1], parts[2]
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decrypt value, %s", err)
+	}
+
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decrypt value, %s", err)
+	}
+
+	plain, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decrypt value, %s", err)
+	}
+
+	if match[4] == "bool" {
+		if result, err := strconv.ParseBool(string(plain)); err == nil {
+			return strconv.FormatBool(result), match[4], nil
+		}
+	}
+
+	return string(plain), match[4], nil
+}
+
+// Returns the representation of the value for the MAC of the file,
+// the booleans are written as in Python ("True" and "False") as in SOPS.
+func macValue(value, valueType string) string {
+	if valueType != "bool" {
+		return value
+	}
+
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return value
+	}
+
+	if result {
+		return "True"
+	}
+
+	return "False"
+}
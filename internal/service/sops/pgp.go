@@ -0,0 +1,83 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sops
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Returns the GnuPG command, as in SOPS it can be changed
+// with the SOPS_GPG_EXEC environment variable.
+func gpgCommand() string {
+	if command := os.Getenv("SOPS_GPG_EXEC"); command != "" {
+		return command
+	}
+
+	return "gpg"
+}
+
+// Encrypts the data for the PGP key with the fingerprint using GnuPG.
+// Returns the armored PGP message.
+func pgpEncrypt(data []byte, fingerprint string) ([]byte, error) {
+	fingerprint = strings.ReplaceAll(fingerprint, " ", "")
+
+	trustedKey := fingerprint
+	if len(trustedKey) > 16 {
+		trustedKey = trustedKey[len(trustedKey)-16:]
+	}
+
+	command := exec.Command(
+		gpgCommand(),
+		"--no-default-recipient",
+		"--yes",
+		"--encrypt",
+		"--armor",
+		"--recipient", fingerprint,
+		"--trusted-key", trustedKey,
+		"--no-encrypt-to",
+	)
+
+	var stdout, stderr bytes.Buffer
+
+	command.Stdin = bytes.NewReader(data)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	err := command.Run()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to encrypt with pgp key %s, %s (%s)",
+			fingerprint,
+			err,
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// Decrypts the armored PGP message using GnuPG and its agent.
+func pgpDecrypt(message []byte) ([]byte, error) {
+	command := exec.Command(gpgCommand(), "--use-agent", "--quiet", "--decrypt")
+
+	var stdout, stderr bytes.Buffer
+
+	command.Stdin = bytes.NewReader(message)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	err := command.Run()
+	if err != nil {
+		return nil, fmt.Errorf("%s (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
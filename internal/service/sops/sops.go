@@ -0,0 +1,779 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sops
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"prism/internal/model"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Version of SOPS written to the metadata of the encrypted files.
+const sopsVersion = "3.9.0"
+
+// Suffix of the keys that are not encrypted, if no rule is specified.
+const defaultUnencryptedSuffix = "_unencrypted"
+
+// Name of the configuration file of SOPS with the creation rules.
+const configFileName = ".sops.yaml"
+
+// Files with environment variables encrypted with SOPS (age or PGP).
+// The files are decrypted in memory.
+type Sops struct{}
+
+func NewSops() *Sops {
+	return &Sops{}
+}
+
+// Returns the format of the file by the extension: yaml, json or dotenv.
+func FileFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".json":
+		return FormatJSON, nil
+	case ".env":
+		return FormatDotenv, nil
+	}
+
+	return "", fmt.Errorf(
+		"unsupported format of the file %s, the encrypted files can be yaml, json or env files",
+		path,
+	)
+}
+
+// Checks whether the content of the file is encrypted with SOPS.
+func (s *Sops) IsEncrypted(content []byte, format string) bool {
+	doc, err := parseDocument(content, format)
+	if err != nil || doc.metadata == nil {
+		return false
+	}
+
+	var meta metadata
+
+	return doc.metadata.Decode(&meta) == nil && meta.MAC != ""
+}
+
+// Decrypts the content of the file with the age identities
+// or the PGP keys of GnuPG. Returns the content in the same format.
+func (s *Sops) Decrypt(content []byte, format string, identities []string) ([]byte, error) {
+	doc, _, err := s.decrypt(content, format, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.emit()
+}
+
+// Encrypts the content of the file for the age recipients and the PGP keys.
+func (s *Sops) Encrypt(content []byte, format string, keys model.SopsKeys) ([]byte, error) {
+	doc, err := parseDocument(content, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.metadata != nil {
+		return nil, fmt.Errorf("the file is already encrypted")
+	}
+
+	dataKey := make([]byte, 32)
+
+	_, err = rand.Read(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data key, %s", err)
+	}
+
+	meta, err := encryptDataKey(dataKey, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	err = doc.encrypt(dataKey, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.emit()
+}
+
+// Opens the decrypted file in the editor ($VISUAL, $EDITOR or vi) and
+// encrypts the changes with the same data key. The decrypted file
+// is created in memory (/dev/shm) if possible and removed after editing,
+// also if the command is interrupted.
+// A file that does not exist is created with the keys.
+func (s *Sops) Edit(path string, identities []string, keys model.SopsKeys) error {
+	format, err := FileFormat(path)
+	if err != nil {
+		return err
+	}
+
+	var doc *document
+	var dataKey []byte
+	var plain []byte
+
+	mode := os.FileMode(0600)
+	content, err := os.ReadFile(path)
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		err = checkKeys(keys)
+		if err != nil {
+			return err
+		}
+
+		if format == FormatJSON {
+			plain = []byte("{}\n")
+		}
+	case err != nil:
+		return fmt.Errorf("failed to read file, %s", err)
+	default:
+		if !s.IsEncrypted(content, format) {
+			return fmt.Errorf("file %s is not encrypted, use \"prism env encrypt\"", path)
+		}
+
+		doc, dataKey, err = s.decrypt(content, format, identities)
+		if err != nil {
+			return err
+		}
+
+		plain, err = doc.emit()
+		if err != nil {
+			return err
+		}
+
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+
+	dir, err := plaintextDir()
+	if err != nil {
+		return err
+	}
+
+	// The signals of the terminal stop the command without the deferred calls,
+	// the decrypted file is removed before the exit. The interrupt is ignored
+	// while the editor runs, the editor handles Ctrl+C itself.
+	var editing atomic.Bool
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		for sig := range signals {
+			if sig == os.Interrupt && editing.Load() {
+				continue
+			}
+
+			os.RemoveAll(dir)
+			os.Exit(1)
+		}
+	}()
+
+	defer func() {
+		signal.Stop(signals)
+		os.RemoveAll(dir)
+	}()
+
+	tempPath := filepath.Join(dir, filepath.Base(path))
+
+	err = os.WriteFile(tempPath, plain, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file, %s", err)
+	}
+
+	input := bufio.NewReader(os.Stdin)
+
+	for {
+		editing.Store(true)
+		err = runEditor(tempPath)
+		editing.Store(false)
+
+		if err != nil {
+			return err
+		}
+
+		edited, err := os.ReadFile(tempPath)
+		if err != nil {
+			return fmt.Errorf("failed to read temporary file, %s", err)
+		}
+
+		if bytes.Equal(edited, plain) {
+			fmt.Println("File unchanged.")
+			return nil
+		}
+
+		encrypted, err := encryptEdited(edited, format, doc, dataKey, keys)
+		if err == nil {
+			err = os.WriteFile(path, encrypted, mode)
+			if err != nil {
+				return fmt.Errorf("failed to write file, %s", err)
+			}
+
+			return nil
+		}
+
+		fmt.Printf("%s\nPress enter to edit the file again or Ctrl+C to cancel.\n", err)
+
+		_, err = input.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("file %s is not changed", path)
+		}
+	}
+}
+
+// Returns the keys of the file from the creation rules of the .sops.yaml file
+// in the directory of the file or its parent directories. The path regex of the
+// rule is matched against the path relative to the directory of .sops.yaml.
+// The SOPS_AGE_RECIPIENTS and SOPS_PGP_FP environment variables are used
+// if there is no matching rule.
+func (s *Sops) CreationKeys(path string) (model.SopsKeys, error) {
+	var keys model.SopsKeys
+
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return keys, fmt.Errorf("failed to get file path, %s", err)
+	}
+
+	for dir := filepath.Dir(absolutePath); ; dir = filepath.Dir(dir) {
+		configPath := filepath.Join(dir, configFileName)
+
+		content, err := os.ReadFile(configPath)
+		if err == nil {
+			relativePath, err := filepath.Rel(dir, absolutePath)
+			if err != nil {
+				return keys, fmt.Errorf("failed to get file path, %s", err)
+			}
+
+			found, err := creationRule(content, filepath.ToSlash(relativePath), &keys)
+			if err != nil {
+				return keys, fmt.Errorf("failed to read %s, %s", configPath, err)
+			}
+
+			if found {
+				return keys, nil
+			}
+
+			break
+		}
+
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	keys.Age = splitKeys(os.Getenv("SOPS_AGE_RECIPIENTS"))
+	keys.PGP = splitKeys(os.Getenv("SOPS_PGP_FP"))
+
+	return keys, nil
+}
+
+// Decrypts the document, returns the document and the data key.
+func (s *Sops) decrypt(content []byte, format string, identities []string) (*document, []byte, error) {
+	doc, err := parseDocument(content, format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if doc.metadata == nil {
+		return nil, nil, fmt.Errorf("the file is not encrypted with sops")
+	}
+
+	var meta metadata
+
+	err = doc.metadata.Decode(&meta)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid sops metadata, %s", err)
+	}
+
+	dataKey, err := decryptDataKey(meta, identities)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = doc.decrypt(dataKey, meta)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc.metadata = nil
+	return doc, dataKey, nil
+}
+
+// Encrypts the edited content. The existing file is encrypted with the data key
+// and the metadata of the file, the new file is encrypted with the keys.
+func encryptEdited(
+	content []byte,
+	format string,
+	original *document,
+	dataKey []byte,
+	keys model.SopsKeys,
+) ([]byte, error) {
+	doc, err := parseDocument(content, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.metadata != nil {
+		return nil, fmt.Errorf("the edited file must not contain the sops metadata")
+	}
+
+	if original == nil {
+		dataKey = make([]byte, 32)
+
+		_, err = rand.Read(dataKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create data key, %s", err)
+		}
+
+		meta, err := encryptDataKey(dataKey, keys)
+		if err != nil {
+			return nil, err
+		}
+
+		err = doc.encrypt(dataKey, meta)
+		if err != nil {
+			return nil, err
+		}
+
+		return doc.emit()
+	}
+
+	meta, err := readMetadata(original.source)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.source = original.source
+
+	err = doc.encrypt(dataKey, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.emit()
+}
+
+// Encrypts the data key for the age recipients and the PGP keys.
+// Returns the metadata of the new file.
+func encryptDataKey(dataKey []byte, keys model.SopsKeys) (*metadata, error) {
+	err := checkKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &metadata{
+		UnencryptedSuffix: keys.UnencryptedSuffix,
+		EncryptedRegex:    keys.EncryptedRegex,
+		Version:           sopsVersion,
+	}
+
+	if meta.UnencryptedSuffix == "" && meta.EncryptedRegex == "" {
+		meta.UnencryptedSuffix = defaultUnencryptedSuffix
+	}
+
+	for _, recipient := range keys.Age {
+		publicKey, err := parseAgeRecipient(recipient)
+		if err != nil {
+			return nil, err
+		}
+
+		enc, err := ageEncrypt(dataKey, publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt data key for %s, %s", recipient, err)
+		}
+
+		meta.Age = append(meta.Age, ageKey{Recipient: recipient, Enc: string(enc)})
+	}
+
+	for _, fingerprint := range keys.PGP {
+		enc, err := pgpEncrypt(dataKey, fingerprint)
+		if err != nil {
+			return nil, err
+		}
+
+		meta.PGP = append(meta.PGP, pgpKey{
+			CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+			Enc:         string(enc),
+			Fingerprint: fingerprint,
+		})
+	}
+
+	return meta, nil
+}
+
+// Checks that the keys to encrypt the file are specified.
+func checkKeys(keys model.SopsKeys) error {
+	if len(keys.Age) == 0 && len(keys.PGP) == 0 {
+		return fmt.Errorf(
+			"no age recipients or pgp keys specified, use the --age or --pgp flags or the creation rules of %s",
+			configFileName,
+		)
+	}
+
+	return nil
+}
+
+// Decrypts the data key with the age identities or the PGP keys.
+func decryptDataKey(meta metadata, identityPaths []string) ([]byte, error) {
+	var messages []string
+
+	if len(meta.Age) > 0 {
+		identities, err := readAgeIdentities(identityPaths)
+		if err != nil {
+			return nil, err
+		}
+
+		var recipients []string
+
+		for _, key := range meta.Age {
+			dataKey, err := ageDecrypt([]byte(key.Enc), identities)
+			if err == nil && len(dataKey) == 32 {
+				return dataKey, nil
+			}
+
+			recipients = append(recipients, key.Recipient)
+		}
+
+		messages = append(messages, fmt.Sprintf(
+			"no age identity for the recipients %s",
+			strings.Join(recipients, ", "),
+		))
+	}
+
+	for _, key := range meta.PGP {
+		dataKey, err := pgpDecrypt([]byte(key.Enc))
+		if err == nil && len(dataKey) == 32 {
+			return dataKey, nil
+		}
+
+		messages = append(messages, fmt.Sprintf("pgp key %s: %s", key.Fingerprint, err))
+	}
+
+	if len(messages) == 0 {
+		messages = append(messages, "the file has no age or pgp keys")
+	}
+
+	return nil, fmt.Errorf("failed to decrypt the data key, %s", strings.Join(messages, "; "))
+}
+
+// Encrypts the values of the document and sets the metadata
+// with the MAC of the values.
+func (d *document) encrypt(dataKey []byte, meta *metadata) error {
+	hash := sha512.New()
+
+	err := walkValues(d.root, nil, func(node *yaml.Node, path []string) error {
+		value, valueType := scalarValue(node)
+		if valueType == "null" {
+			return nil
+		}
+
+		encrypted, err := isEncryptedPath(path, *meta)
+		if err != nil {
+			return err
+		}
+
+		if encrypted || !meta.MACOnlyEncrypted {
+			hash.Write([]byte(macValue(value, valueType)))
+		}
+
+		if !encrypted {
+			return nil
+		}
+
+		enc, err := encryptValue(value, valueType, dataKey, strings.Join(path, ":")+":")
+		if err != nil {
+			return err
+		}
+
+		setScalar(node, enc, "str")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	meta.LastModified = time.Now().UTC().Format(time.RFC3339)
+
+	meta.MAC, err = encryptValue(fmt.Sprintf("%X", hash.Sum(nil)), "str", dataKey, meta.LastModified)
+	if err != nil {
+		return err
+	}
+
+	if d.source != nil {
+		// The metadata of the existing file is kept,
+		// only the modification time and the MAC are changed.
+		d.metadata = d.source
+		setMetadataValue(d.metadata, "lastmodified", meta.LastModified)
+		setMetadataValue(d.metadata, "mac", meta.MAC)
+
+		return nil
+	}
+
+	var node yaml.Node
+
+	err = node.Encode(meta)
+	if err != nil {
+		return fmt.Errorf("failed to create sops metadata, %s", err)
+	}
+
+	d.metadata = &node
+	return nil
+}
+
+// Decrypts the values of the document and verifies the MAC of the values.
+func (d *document) decrypt(dataKey []byte, meta metadata) error {
+	hash := sha512.New()
+
+	err := walkValues(d.root, nil, func(node *yaml.Node, path []string) error {
+		value, valueType := scalarValue(node)
+		if valueType == "null" {
+			return nil
+		}
+
+		encrypted, err := isEncryptedPath(path, meta)
+		if err != nil {
+			return err
+		}
+
+		if encrypted {
+			value, valueType, err = decryptValue(node.Value, dataKey, strings.Join(path, ":")+":")
+			if err != nil {
+				return fmt.Errorf("failed to decrypt %s, %s", strings.Join(path, "."), err)
+			}
+
+			setScalar(node, value, valueType)
+		}
+
+		if encrypted || !meta.MACOnlyEncrypted {
+			hash.Write([]byte(macValue(value, valueType)))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	lastModified, err := time.Parse(time.RFC3339, meta.LastModified)
+	if err != nil {
+		return fmt.Errorf("invalid sops metadata, %s", err)
+	}
+
+	mac, _, err := decryptValue(meta.MAC, dataKey, lastModified.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to verify the MAC of the file, %s", err)
+	}
+
+	if !strings.EqualFold(mac, fmt.Sprintf("%X", hash.Sum(nil))) {
+		return fmt.Errorf("failed to verify the MAC of the file, the file was changed")
+	}
+
+	d.source = d.metadata
+	return nil
+}
+
+// Checks whether the value with the path is encrypted by the rules of the file.
+func isEncryptedPath(path []string, meta metadata) (bool, error) {
+	encrypted := true
+
+	if meta.UnencryptedSuffix != "" {
+		for _, key := range path {
+			if strings.HasSuffix(key, meta.UnencryptedSuffix) {
+				encrypted = false
+				break
+			}
+		}
+	}
+
+	if meta.EncryptedSuffix != "" {
+		encrypted = false
+
+		for _, key := range path {
+			if strings.HasSuffix(key, meta.EncryptedSuffix) {
+				encrypted = true
+				break
+			}
+		}
+	}
+
+	for _, rule := range []struct {
+		pattern string
+		match   bool
+	}{
+		{pattern: meta.UnencryptedRegex, match: false},
+		{pattern: meta.EncryptedRegex, match: true},
+	} {
+		if rule.pattern == "" {
+			continue
+		}
+
+		format, err := regexp.Compile(rule.pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid regex %q, %s", rule.pattern, err)
+		}
+
+		if rule.match {
+			encrypted = false
+		}
+
+		for _, key := range path {
+			if format.MatchString(key) {
+				encrypted = rule.match
+				break
+			}
+		}
+	}
+
+	return encrypted, nil
+}
+
+// Reads the metadata of the node.
+func readMetadata(node *yaml.Node) (*metadata, error) {
+	var meta metadata
+
+	err := node.Decode(&meta)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sops metadata, %s", err)
+	}
+
+	return &meta, nil
+}
+
+// Sets the value of the key of the metadata node.
+func setMetadataValue(node *yaml.Node, key, value string) {
+	for index := 0; index < len(node.Content); index += 2 {
+		if node.Content[index].Value == key {
+			setScalar(node.Content[index+1], value, "str")
+			return
+		}
+	}
+
+	node.Content = append(node.Content, stringNode(key), stringNode(value))
+}
+
+// Reads the creation rule of the file from the configuration of SOPS.
+func creationRule(content []byte, path string, keys *model.SopsKeys) (bool, error) {
+	var config struct {
+		CreationRules []struct {
+			PathRegex         string `yaml:"path_regex"`
+			Age               string `yaml:"age"`
+			PGP               string `yaml:"pgp"`
+			UnencryptedSuffix string `yaml:"unencrypted_suffix"`
+			EncryptedRegex    string `yaml:"encrypted_regex"`
+		} `yaml:"creation_rules"`
+	}
+
+	err := yaml.Unmarshal(content, &config)
+	if err != nil {
+		return false, err
+	}
+
+	for _, rule := range config.CreationRules {
+		if rule.PathRegex != "" {
+			format, err := regexp.Compile(rule.PathRegex)
+			if err != nil {
+				return false, fmt.Errorf("invalid path regex %q, %s", rule.PathRegex, err)
+			}
+
+			if !format.MatchString(path) {
+				continue
+			}
+		}
+
+		keys.Age = splitKeys(rule.Age)
+		keys.PGP = splitKeys(rule.PGP)
+		keys.UnencryptedSuffix = rule.UnencryptedSuffix
+		keys.EncryptedRegex = rule.EncryptedRegex
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// Returns the keys separated by commas.
+func splitKeys(value string) []string {
+	var keys []string
+
+	for _, key := range strings.Split(value, ",") {
+		key = strings.TrimSpace(key)
+
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Creates the temporary directory for the decrypted file in memory (/dev/shm).
+// The directory is created on disk with a warning if there is no memory
+// file system (macOS, Windows).
+func plaintextDir() (string, error) {
+	tempDir := "/dev/shm"
+
+	info, err := os.Stat(tempDir)
+	if err != nil || !info.IsDir() {
+		tempDir = os.TempDir()
+
+		fmt.Fprintf(
+			os.Stderr,
+			"WARNING: no memory file system, the decrypted file is written to disk in %s until the editor is closed\n",
+			tempDir,
+		)
+	}
+
+	dir, err := os.MkdirTemp(tempDir, "prism-env-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory, %s", err)
+	}
+
+	return dir, nil
+}
+
+// Opens the file in the editor of the user.
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+
+	if editor == "" {
+		editor = "vi"
+	}
+
+	fields := strings.Fields(editor)
+
+	command := exec.Command(fields[0], append(fields[1:], path)...)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	err := command.Run()
+	if err != nil {
+		return fmt.Errorf("failed to run editor %s, %s", editor, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sops
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"prism/internal/model"
+	"strings"
+	"testing"
+)
+
+// The files of testdata are encrypted by sops 3.9.4 and age 1.2.1
+// for the identity of testdata/key.txt:
+//
+//	sops encrypt --age <recipient> secrets.yaml > secrets.enc.yaml
+//	printf 'data key' | age -r <recipient> -a > data.age
+const testRecipient = "age1gxd8nqqtmd05cgkpx4km9wjrp7vg7xk2vf5pnhad9nxe4g9lxc9qy2y685"
+
+// Extensions of the test files, one file of each format.
+var testExtensions = []string{"yaml", "json", "env"}
+
+// Uses only the identity of testdata, not the keys of the user.
+func setTestIdentity(t *testing.T) {
+	t.Setenv("SOPS_AGE_KEY", "")
+	os.Unsetenv("SOPS_AGE_KEY")
+	t.Setenv("SOPS_AGE_KEY_FILE", filepath.Join("testdata", "key.txt"))
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+}
+
+func readTestFile(t *testing.T, name string) []byte {
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return content
+}
+
+func TestAgeDecrypt(t *testing.T) {
+	setTestIdentity(t)
+
+	identities, err := readAgeIdentities(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := ageDecrypt(readTestFile(t, "data.age"), identities)
+	if err != nil {
+		t.Fatalf("decrypt: %s", err)
+	}
+
+	if string(decrypted) != "data key" {
+		t.Errorf("decrypt: got %q, expected %q", decrypted, "data key")
+	}
+
+	recipient, err := parseAgeRecipient(testRecipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := ageEncrypt([]byte("data key"), recipient)
+	if err != nil {
+		t.Fatalf("encrypt: %s", err)
+	}
+
+	decrypted, err = ageDecrypt(encrypted, identities)
+	if err != nil || string(decrypted) != "data key" {
+		t.Errorf("decrypt of the encrypted data: got %q, %v", decrypted, err)
+	}
+}
+
+func TestDecryptSopsFiles(t *testing.T) {
+	setTestIdentity(t)
+
+	for _, extension := range testExtensions {
+		format, _ := FileFormat("secrets." + extension)
+		content := readTestFile(t, "secrets.enc."+extension)
+
+		if !NewSops().IsEncrypted(content, format) {
+			t.Errorf("%s: the file is not detected as encrypted", format)
+		}
+
+		decrypted, err := NewSops().Decrypt(content, format, nil)
+		if err != nil {
+			t.Errorf("%s: %s", format, err)
+			continue
+		}
+
+		expected := readTestFile(t, "secrets."+extension)
+
+		if !bytes.Equal(decrypted, expected) {
+			t.Errorf("%s: got\n%s\nexpected\n%s", format, decrypted, expected)
+		}
+	}
+}
+
+func TestDecryptChangedFile(t *testing.T) {
+	setTestIdentity(t)
+
+	content := string(readTestFile(t, "secrets.enc.yaml"))
+
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{
+			// The unencrypted values are authenticated with the MAC.
+			name:    "unencrypted value",
+			content: strings.Replace(content, "token_unencrypted: visible", "token_unencrypted: changed", 1),
+			err:     "failed to verify the MAC of the file",
+		},
+		{
+			name:    "removed value",
+			content: strings.Replace(content, "    debug: ENC[", "    #debug: ENC[", 1),
+			err:     "failed to verify the MAC of the file",
+		},
+		{
+			// The path of the value is the additional data of the cipher.
+			name:    "moved value",
+			content: strings.Replace(content, "    user: ENC[", "    login: ENC[", 1),
+			err:     "failed to decrypt database.login",
+		},
+		{
+			name:    "changed data key",
+			content: strings.Replace(content, "YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IFgyNTUxOSBpZUpJdndtcERSZ0UyTGd3", "YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IFgyNTUxOSBpZUpJdndtcERSZ0UyTGd4", 1),
+			err:     "failed to decrypt the data key",
+		},
+	}
+
+	for _, test := range tests {
+		if test.content == content {
+			t.Fatalf("%s: the file is not changed", test.name)
+		}
+
+		_, err := NewSops().Decrypt([]byte(test.content), FormatYAML, nil)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got %q, expected %q", test.name, err, test.err)
+		}
+	}
+}
+
+// Checks that the files encrypted by prism are decrypted by sops,
+// if the sops command is installed.
+func TestEncryptCompatibility(t *testing.T) {
+	setTestIdentity(t)
+
+	keys := model.SopsKeys{Age: []string{testRecipient}}
+
+	for _, extension := range testExtensions {
+		format, _ := FileFormat("secrets." + extension)
+		plain := readTestFile(t, "secrets."+extension)
+
+		encrypted, err := NewSops().Encrypt(plain, format, keys)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		decrypted, err := NewSops().Decrypt(encrypted, format, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		if !bytes.Equal(decrypted, plain) {
+			t.Errorf("%s: got\n%s\nexpected\n%s", format, decrypted, plain)
+		}
+
+		sopsPath, err := exec.LookPath("sops")
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(t.TempDir(), "secrets."+extension)
+
+		err = os.WriteFile(path, encrypted, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := exec.Command(sopsPath, "decrypt", path).CombinedOutput()
+		if err != nil {
+			t.Errorf("%s: sops: %s, %s", format, err, output)
+			continue
+		}
+
+		// sops writes the json files without the final newline.
+		if !bytes.Equal(bytes.TrimSpace(output), bytes.TrimSpace(plain)) {
+			t.Errorf("%s: sops: got\n%s\nexpected\n%s", format, output, plain)
+		}
+	}
+}
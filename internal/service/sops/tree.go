@@ -0,0 +1,457 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the encrypted files.
+const (
+	FormatYAML   = "yaml"
+	FormatJSON   = "json"
+	FormatDotenv = "dotenv"
+)
+
+// Key of the SOPS metadata in the file.
+const metadataKey = "sops"
+
+// Separator of the flattened key of the metadata in the dotenv files.
+var flattenedSeparator = regexp.MustCompile(`__(map|list)_`)
+
+// Separators of the keys of the metadata in the dotenv files, as in SOPS.
+const (
+	mapSeparator  = "__map_"
+	listSeparator = "__list_"
+)
+
+// Metadata of the encrypted file.
+type metadata struct {
+	Age               []ageKey `yaml:"age,omitempty"`
+	PGP               []pgpKey `yaml:"pgp,omitempty"`
+	LastModified      string   `yaml:"lastmodified"`
+	MAC               string   `yaml:"mac"`
+	UnencryptedSuffix string   `yaml:"unencrypted_suffix,omitempty"`
+	EncryptedSuffix   string   `yaml:"encrypted_suffix,omitempty"`
+	UnencryptedRegex  string   `yaml:"unencrypted_regex,omitempty"`
+	EncryptedRegex    string   `yaml:"encrypted_regex,omitempty"`
+	MACOnlyEncrypted  bool     `yaml:"mac_only_encrypted,omitempty"`
+	Version           string   `yaml:"version"`
+}
+
+// Data key encrypted for the age recipient.
+type ageKey struct {
+	Recipient string `yaml:"recipient"`
+	Enc       string `yaml:"enc"`
+}
+
+// Data key encrypted for the PGP key.
+type pgpKey struct {
+	CreatedAt   string `yaml:"created_at"`
+	Enc         string `yaml:"enc"`
+	Fingerprint string `yaml:"fp"`
+}
+
+// Content of the file: the mapping of the values and the metadata node,
+// the metadata node is nil if the file is not encrypted.
+type document struct {
+	format   string
+	root     *yaml.Node
+	metadata *yaml.Node
+	// Metadata of the encrypted file the document is decrypted from.
+	source *yaml.Node
+}
+
+// Parses the YAML, JSON or dotenv file. The comments are not kept.
+func parseDocument(content []byte, format string) (*document, error) {
+	doc := &document{format: format}
+
+	switch format {
+	case FormatYAML, FormatJSON:
+		var node yaml.Node
+
+		err := yaml.Unmarshal(content, &node)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s file, %s", format, err)
+		}
+
+		doc.root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+
+		if len(node.Content) > 0 {
+			root := node.Content[0]
+			if root.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("failed to parse %s file, the file must contain a mapping", format)
+			}
+
+			doc.root = root
+		}
+	case FormatDotenv:
+		root, err := parseDotenv(content)
+		if err != nil {
+			return nil, err
+		}
+
+		doc.root = root
+	default:
+		return nil, fmt.Errorf("unsupported format %s", format)
+	}
+
+	removeComments(doc.root)
+
+	// The metadata is removed from the values.
+	for index := 0; index < len(doc.root.Content); index += 2 {
+		if doc.root.Content[index].Value == metadataKey {
+			doc.metadata = doc.root.Content[index+1]
+			doc.root.Content = append(doc.root.Content[:index], doc.root.Content[index+2:]...)
+			break
+		}
+	}
+
+	return doc, nil
+}
+
+// Parses the dotenv file into the mapping of strings, the keys
+// of the metadata in the form sops_<key>__list_0__map_<key> are unflattened.
+func parseDotenv(content []byte) (*yaml.Node, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	var metadataNode *yaml.Node
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("failed to parse dotenv file, invalid line %q", line)
+		}
+
+		value = strings.ReplaceAll(value, "\\n", "\n")
+
+		if strings.HasPrefix(key, metadataKey+"_") {
+			if metadataNode == nil {
+				metadataNode = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+
+			err := unflatten(metadataNode, strings.TrimPrefix(key, metadataKey+"_"), value)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		root.Content = append(root.Content, stringNode(key), stringNode(value))
+	}
+
+	if metadataNode != nil {
+		root.Content = append(root.Content, stringNode(metadataKey), metadataNode)
+	}
+
+	return root, nil
+}
+
+// Adds the value of the flattened key to the metadata node.
+func unflatten(node *yaml.Node, key, value string) error {
+	invalid := fmt.Errorf("failed to parse dotenv file, invalid metadata key %q", key)
+	path := flattenedSeparator.Split(key, -1)
+	kinds := flattenedSeparator.FindAllStringSubmatch(key, -1)
+
+	for index, name := range path {
+		last := index == len(path)-1
+
+		var child *yaml.Node
+
+		if node.Kind == yaml.SequenceNode {
+			position, err := strconv.Atoi(name)
+			if err != nil || position > len(node.Content) {
+				return invalid
+			}
+
+			if position < len(node.Content) {
+				child = node.Content[position]
+			}
+		} else {
+			for item := 0; item < len(node.Content); item += 2 {
+				if node.Content[item].Value == name {
+					child = node.Content[item+1]
+				}
+			}
+		}
+
+		if child == nil {
+			switch {
+			case last:
+				// The implicit type, for example of the boolean values.
+				child = &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+			case kinds[index][1] == "list":
+				child = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			default:
+				child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+
+			if node.Kind == yaml.SequenceNode {
+				node.Content = append(node.Content, child)
+			} else {
+				node.Content = append(node.Content, stringNode(name), child)
+			}
+		} else if last {
+			return invalid
+		}
+
+		node = child
+	}
+
+	return nil
+}
+
+// Returns the content of the document in the format of the document.
+func (d *document) emit() ([]byte, error) {
+	root := d.root
+
+	if d.metadata != nil {
+		root = &yaml.Node{
+			Kind:    yaml.MappingNode,
+			Tag:     "!!map",
+			Content: append(append([]*yaml.Node{}, d.root.Content...), stringNode(metadataKey), d.metadata),
+		}
+	}
+
+	switch d.format {
+	case FormatYAML:
+		var buffer bytes.Buffer
+
+		encoder := yaml.NewEncoder(&buffer)
+		encoder.SetIndent(4)
+
+		err := encoder.Encode(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create yaml file, %s", err)
+		}
+
+		return buffer.Bytes(), nil
+	case FormatJSON:
+		var buffer bytes.Buffer
+
+		err := writeJSON(&buffer, root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create json file, %s", err)
+		}
+
+		var result bytes.Buffer
+
+		err = json.Indent(&result, buffer.Bytes(), "", "\t")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create json file, %s", err)
+		}
+
+		result.WriteString("\n")
+		return result.Bytes(), nil
+	}
+
+	var result strings.Builder
+
+	for index := 0; index < len(d.root.Content); index += 2 {
+		value := d.root.Content[index+1]
+		if value.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("failed to create dotenv file, the value of %s is not a string", d.root.Content[index].Value)
+		}
+
+		writeDotenvLine(&result, d.root.Content[index].Value, value.Value)
+	}
+
+	if d.metadata != nil {
+		for index := 0; index < len(d.metadata.Content); index += 2 {
+			flatten(
+				d.metadata.Content[index+1],
+				metadataKey+"_"+d.metadata.Content[index].Value,
+				func(key, value string) {
+					writeDotenvLine(&result, key, value)
+				},
+			)
+		}
+	}
+
+	return []byte(result.String()), nil
+}
+
+func writeDotenvLine(result *strings.Builder, key, value string) {
+	result.WriteString(key + "=" + strings.ReplaceAll(value, "\n", "\\n") + "\n")
+}
+
+// Calls the function for each value of the node with the flattened key.
+func flatten(node *yaml.Node, key string, add func(key, value string)) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for index := 0; index < len(node.Content); index += 2 {
+			flatten(node.Content[index+1], key+mapSeparator+node.Content[index].Value, add)
+		}
+	case yaml.SequenceNode:
+		for index, item := range node.Content {
+			flatten(item, key+listSeparator+strconv.Itoa(index), add)
+		}
+	default:
+		add(key, node.Value)
+	}
+}
+
+// Writes the node as JSON, the order of the keys is kept.
+func writeJSON(buffer *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		buffer.WriteString("{")
+
+		for index := 0; index < len(node.Content); index += 2 {
+			if index > 0 {
+				buffer.WriteString(",")
+			}
+
+			key, _ := json.Marshal(node.Content[index].Value)
+			buffer.Write(key)
+			buffer.WriteString(":")
+
+			err := writeJSON(buffer, node.Content[index+1])
+			if err != nil {
+				return err
+			}
+		}
+
+		buffer.WriteString("}")
+	case yaml.SequenceNode:
+		buffer.WriteString("[")
+
+		for index, item := range node.Content {
+			if index > 0 {
+				buffer.WriteString(",")
+			}
+
+			err := writeJSON(buffer, item)
+			if err != nil {
+				return err
+			}
+		}
+
+		buffer.WriteString("]")
+	case yaml.ScalarNode:
+		value, valueType := scalarValue(node)
+
+		switch valueType {
+		case "int", "float", "bool":
+			buffer.WriteString(value)
+		case "null":
+			buffer.WriteString("null")
+		default:
+			content, _ := json.Marshal(value)
+			buffer.Write(content)
+		}
+	default:
+		return fmt.Errorf("unsupported value of kind %d", node.Kind)
+	}
+
+	return nil
+}
+
+// Returns the value of the scalar node and its type in SOPS:
+// str, int, float, bool or null.
+func scalarValue(node *yaml.Node) (string, string) {
+	switch node.ShortTag() {
+	case "!!int":
+		var value int
+
+		if node.Decode(&value) == nil {
+			return strconv.Itoa(value), "int"
+		}
+	case "!!float":
+		var value float64
+
+		if node.Decode(&value) == nil {
+			return strconv.FormatFloat(value, 'f', -1, 64), "float"
+		}
+	case "!!bool":
+		var value bool
+
+		if node.Decode(&value) == nil {
+			return strconv.FormatBool(value), "bool"
+		}
+	case "!!null":
+		return "", "null"
+	}
+
+	return node.Value, "str"
+}
+
+// Sets the value and the type of the scalar node.
+func setScalar(node *yaml.Node, value, valueType string) {
+	node.Value = value
+	node.Style = 0
+
+	switch valueType {
+	case "int":
+		node.Tag = "!!int"
+	case "float":
+		node.Tag = "!!float"
+	case "bool":
+		node.Tag = "!!bool"
+	default:
+		node.Tag = "!!str"
+	}
+}
+
+// Calls the function for each scalar value of the node with the path
+// of the keys, the values of the lists have the path of the list.
+func walkValues(node *yaml.Node, path []string, visit func(node *yaml.Node, path []string) error) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for index := 0; index < len(node.Content); index += 2 {
+			err := walkValues(
+				node.Content[index+1],
+				append(append([]string{}, path...), node.Content[index].Value),
+				visit,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			err := walkValues(item, path, visit)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		return visit(node, path)
+	case yaml.AliasNode:
+		return fmt.Errorf("aliases are not supported in the encrypted files (%s)", strings.Join(path, "."))
+	}
+
+	return nil
+}
+
+// Removes the comments of the node and the nested nodes.
+func removeComments(node *yaml.Node) {
+	node.HeadComment = ""
+	node.LineComment = ""
+	node.FootComment = ""
+
+	for _, child := range node.Content {
+		removeComments(child)
+	}
+}
+
+func stringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package transformer
+
+import (
+	"fmt"
+	"prism/internal/model"
+	"prism/pkg"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Returns the configuration block of the Nomad job. The blocks and parameters
+// are read from the hcl tags of the API structures, as the job is parsed by Nomad.
+func jobBlock(job *api.Job) model.TemplateBlock {
+	block := model.TemplateBlock{Type: "job", Parameter: make([]map[string]interface{}, 0)}
+
+	if job.Name != nil && *job.Name != "" {
+		block.Label = *job.Name
+	} else if job.ID != nil {
+		block.Label = *job.ID
+	}
+
+	fields(&block, reflect.ValueOf(job).Elem())
+
+	// The ID is the name of the job, if it is not set.
+	block.Parameter = slices.DeleteFunc(block.Parameter, func(parameter map[string]interface{}) bool {
+		return parameter["name"] == block.Label || parameter["id"] == block.Label
+	})
+
+	return block
+}
+
+// Adds the parameters and the blocks of the structure to the block.
+func fields(block *model.TemplateBlock, value reflect.Value) {
+	valueType := value.Type()
+
+	for index := 0; index < valueType.NumField(); index++ {
+		tag, ok := valueType.Field(index).Tag.Lookup("hcl")
+		if !ok || tag == "-" {
+			continue
+		}
+
+		name, kind, _ := strings.Cut(tag, ",")
+		fieldValue := value.Field(index)
+
+		switch kind {
+		case "label":
+			if label, ok := plainValue(fieldValue).(string); ok {
+				block.Label = label
+			}
+		case "block":
+			nestedBlocks(block, fieldValue, name)
+		case "", "optional":
+			if item, ok := attribute(block.Type, name, fieldValue); ok {
+				block.Parameter = append(block.Parameter, map[string]interface{}{name: item})
+			}
+		}
+	}
+}
+
+// Adds the blocks of the field to the block.
+func nestedBlocks(block *model.TemplateBlock, value reflect.Value, name string) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+
+		value = value.Elem()
+	}
+
+	// The static ports are written as the port blocks.
+	if name == "reserved_ports" {
+		name = "port"
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		block.Block = append(block.Block, structBlock(value, name))
+	case reflect.Slice:
+		for index := 0; index < value.Len(); index++ {
+			item := value.Index(index)
+
+			if item.Kind() == reflect.Pointer {
+				if item.IsNil() {
+					continue
+				}
+
+				item = item.Elem()
+			}
+
+			block.Block = append(block.Block, structBlock(item, name))
+		}
+	case reflect.Map:
+		if value.Len() == 0 {
+			return
+		}
+
+		keys := value.MapKeys()
+
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(a.String(), b.String())
+		})
+
+		// The blocks of the map are labeled by the key, such as the volumes of the group.
+		if value.Type().Elem().Kind() == reflect.Pointer {
+			for _, key := range keys {
+				item := value.MapIndex(key)
+				if item.IsNil() {
+					continue
+				}
+
+				nested := structBlock(item.Elem(), name)
+
+				if nested.Label == "" {
+					nested.Label = key.String()
+				}
+
+				block.Block = append(block.Block, nested)
+			}
+
+			return
+		}
+
+		nested := model.TemplateBlock{Type: name, Parameter: make([]map[string]interface{}, 0)}
+
+		for _, key := range keys {
+			nested.Parameter = append(nested.Parameter, map[string]interface{}{
+				key.String(): parameterValue(plainValue(value.MapIndex(key))),
+			})
+		}
+
+		block.Block = append(block.Block, nested)
+	}
+}
+
+// Returns the block of the structure.
+func structBlock(value reflect.Value, name string) model.TemplateBlock {
+	block := model.TemplateBlock{Type: name, Parameter: make([]map[string]interface{}, 0)}
+	fields(&block, value)
+
+	return block
+}
+
+// Returns the value of the parameter of the field, false if it is not set.
+func attribute(blockType, name string, value reflect.Value) (interface{}, bool) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil, false
+		}
+
+		value = value.Elem()
+	} else if value.IsZero() {
+		return nil, false
+	}
+
+	if (value.Kind() == reflect.Slice || value.Kind() == reflect.Map) && value.Len() == 0 {
+		return nil, false
+	}
+
+	if value.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(value.Int()).String(), true
+	}
+
+	item := plainValue(value)
+
+	// The data of the template is written as a string, as the heredoc
+	// of the template data is indented with the block.
+	if text, ok := item.(string); ok && blockType == "template" && name == "data" {
+		return pkg.HCLExpression(pkg.HCLString(text)), true
+	}
+
+	return parameterValue(item), true
+}
+
+// Returns the value of the parameter. The maps and the lists
+// of the maps and the lists are written as HCL expressions.
+func parameterValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			switch item.(type) {
+			case []interface{}, map[string]interface{}, nil:
+				return pkg.HCLExpression(pkg.HCLValue(v))
+			}
+		}
+
+		return v
+	case map[string]interface{}:
+		return pkg.HCLExpression(pkg.HCLValue(v))
+	case nil:
+		return pkg.HCLExpression("null")
+	default:
+		return v
+	}
+}
+
+// Returns the value of the field as a string, a number, a boolean,
+// a list or a map, the numbers without a fraction are integers.
+func plainValue(value reflect.Value) interface{} {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+
+		return plainValue(value.Elem())
+	case reflect.String:
+		return value.String()
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		number := value.Float()
+
+		if number == float64(int(number)) {
+			return int(number)
+		}
+
+		return number
+	case reflect.Slice, reflect.Array:
+		result := make([]interface{}, 0, value.Len())
+
+		for index := 0; index < value.Len(); index++ {
+			result = append(result, plainValue(value.Index(index)))
+		}
+
+		return result
+	case reflect.Map:
+		result := make(map[string]interface{}, value.Len())
+
+		for _, key := range value.MapKeys() {
+			result[fmt.Sprint(key.Interface())] = plainValue(value.MapIndex(key))
+		}
+
+		return result
+	case reflect.Struct:
+		// The structures in the attributes are written as objects.
+		result := make(map[string]interface{})
+
+		for index := 0; index < value.NumField(); index++ {
+			field := value.Type().Field(index)
+
+			name, _, _ := strings.Cut(field.Tag.Get("hcl"), ",")
+			if name == "" || name == "-" || value.Field(index).IsZero() {
+				continue
+			}
+
+			result[name] = plainValue(value.Field(index))
+		}
+
+		return result
+	}
+
+	return fmt.Sprint(value.Interface())
+}
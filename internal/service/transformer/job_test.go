@@ -0,0 +1,88 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package transformer
+
+import (
+	"encoding/json"
+	"prism/internal/service/output"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestJobBlock(t *testing.T) {
+	var job api.Job
+
+	err := json.Unmarshal([]byte(`{
+		"ID": "web",
+		"Name": "web",
+		"Datacenters": ["dc1"],
+		"Meta": {"team": "platform"},
+		"TaskGroups": [{
+			"Name": "app",
+			"Count": 0,
+			"Networks": [{
+				"ReservedPorts": [{"Label": "http", "Value": 80}],
+				"DynamicPorts": [{"Label": "metrics", "To": 9090}]
+			}],
+			"Volumes": {"data": {"Type": "host", "Source": "data"}},
+			"Tasks": [{
+				"Name": "server",
+				"Driver": "docker",
+				"Config": {
+					"image": "nginx",
+					"args": ["-c", "${NOMAD_TASK_DIR}/nginx.conf"],
+					"mount": [{"type": "bind", "target": "/x"}]
+				},
+				"Env": {"PORT": "80"},
+				"KillTimeout": 5000000000,
+				"Templates": [{"EmbeddedTmpl": "port ${PORT}\n", "DestPath": "local/nginx.conf"}]
+			}]
+		}]
+	}`), &job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := output.NewOutput().OutputConfig(jobBlock(&job))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`job "web" {`,
+		`datacenters = ["dc1"]`,
+		`group "app" {`,
+		`count = 0`,
+		`port "http" {`,
+		`static = 80`,
+		`port "metrics" {`,
+		`to = 9090`,
+		`volume "data" {`,
+		`task "server" {`,
+		`driver = "docker"`,
+		`args = ["-c", "$${NOMAD_TASK_DIR}/nginx.conf"]`,
+		`mount = [{ "target" = "/x", "type" = "bind" }]`,
+		`PORT = "80"`,
+		`kill_timeout = "5s"`,
+		`data = "port $${PORT}\n"`,
+		`team = "platform"`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(content, line) {
+			t.Errorf("%s not found in\n%s", line, content)
+		}
+	}
+
+	for _, line := range []string{`id = "web"`, `name = "web"`} {
+		if strings.Contains(content, line) {
+			t.Errorf("%s is written as a parameter in\n%s", line, content)
+		}
+	}
+}
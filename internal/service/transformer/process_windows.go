@@ -0,0 +1,15 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build windows
+
+package transformer
+
+import "os/exec"
+
+// Process groups are not used on Windows, only the command is killed,
+// the output of the processes it started is not waited for after WaitDelay.
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,189 @@
+// Copyright (c) 2023 SUNSHARD
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"prism/internal/model"
+	"prism/internal/service/output"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Transformer run time, if the timeout is not specified.
+const defaultTimeout = 30 * time.Second
+
+// Time to wait for the output of the processes started by the transformer
+// after it is killed, they can keep stdout open.
+const waitDelay = time.Second
+
+type Transformer struct {
+	output output.Output
+}
+
+func NewTransformer() *Transformer {
+	return &Transformer{output: *output.NewOutput()}
+}
+
+// Runs the transformers of the job one after another. The rendered job
+// is parsed by the Nomad cluster and passed to stdin of the transformer
+// as the JSON job specification, the changed job is read from stdout
+// and validated by the cluster. The context of the render is passed
+// in the environment variables. The HCL2 variables are resolved by the
+// parsing, so the transformed job has no declarations.
+func (t *Transformer) Run(
+	job *model.RenderedJob,
+	nomadConfig *api.Config,
+	namespace string,
+	env map[string]string,
+) error {
+	if len(job.Transformers) == 0 {
+		return nil
+	}
+
+	if nomadConfig == nil {
+		nomadConfig = api.DefaultConfig()
+	}
+
+	client, err := api.NewClient(nomadConfig)
+	if err != nil {
+		return fmt.Errorf("error create nomad api client: %s", err)
+	}
+
+	config, err := t.output.OutputConfig(job.Config, job.Declarations...)
+	if err != nil {
+		return err
+	}
+
+	nomadJob, err := client.Jobs().ParseHCLOpts(&api.JobsParseRequest{
+		JobHCL:    config,
+		Variables: job.HCLVariables,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to parse job by the Nomad cluster, %s", err)
+	}
+
+	for _, transformer := range job.Transformers {
+		nomadJob, err = t.run(nomadJob, transformer, env)
+		if err != nil {
+			return fmt.Errorf("transformer %s failed, %s", transformer.Name, err)
+		}
+
+		err = validateJob(client, nomadJob, namespace)
+		if err != nil {
+			return fmt.Errorf("transformer %s failed, invalid output, %s", transformer.Name, err)
+		}
+	}
+
+	job.Config = jobBlock(nomadJob)
+	job.Declarations = nil
+	job.HCLVariables = ""
+
+	return nil
+}
+
+func (t *Transformer) run(
+	job *api.Job,
+	transformer model.Transformer,
+	env map[string]string,
+) (*api.Job, error) {
+	timeout := defaultTimeout
+
+	if transformer.Timeout != "" {
+		var err error
+
+		timeout, err = time.ParseDuration(transformer.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %q, %s", transformer.Timeout, err)
+		}
+	}
+
+	input, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job JSON, %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// The command of the pack transformer is specified relative to the pack.
+	command := transformer.Command
+
+	if transformer.DirPath != "" && !filepath.IsAbs(command) &&
+		strings.ContainsAny(command, `\/`) {
+		command, err = filepath.Abs(filepath.Join(transformer.DirPath, command))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get command path, %s", err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, command, transformer.Args...)
+	cmd.Dir = transformer.DirPath
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = os.Environ()
+	cmd.WaitDelay = waitDelay
+	setProcessGroup(cmd)
+
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	err = cmd.Run()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("timeout of %s has expired", timeout)
+	}
+
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message != "" {
+			return nil, fmt.Errorf("%s: %s", err, message)
+		}
+
+		return nil, err
+	}
+
+	var result api.Job
+
+	err = json.Unmarshal(stdout.Bytes(), &result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output, the job must be a JSON job specification, %s", err)
+	}
+
+	return &result, nil
+}
+
+// Validates the job by the Nomad cluster, as on the registration of the job.
+func validateJob(client *api.Client, job *api.Job, namespace string) error {
+	response, _, err := client.Jobs().Validate(job, &api.WriteOptions{Namespace: namespace})
+	if err != nil {
+		return fmt.Errorf("failed to validate job, %s", err)
+	}
+
+	if len(response.ValidationErrors) > 0 {
+		return errors.New(strings.Join(response.ValidationErrors, ", "))
+	}
+
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+
+	return nil
+}
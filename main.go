@@ -12,6 +12,8 @@ import (
 	"prism/internal/service/builder"
 	"prism/internal/service/output"
 	"prism/internal/service/parser"
+	"prism/internal/service/registry"
+	"prism/internal/service/repository"
 )
 
 func main() {
@@ -20,7 +22,9 @@ func main() {
 	sb := builder.NewStructureBuilder(*bb)
 	o := output.NewOutput()
 	c := builder.NewChanges()
-	s := service.NewService(p, bb, sb, c, o)
+	r := repository.NewRepository()
+	rg := registry.NewRegistry()
+	s := service.NewService(p, bb, sb, c, o, r, rg)
 
 	cmd.Execute(s)
 }
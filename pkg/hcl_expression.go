@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Raw HCL expression of the configuration, the value with the YAML tag !hcl.
+// The expressions are not strings, so a string is never written as an expression.
+type HCLExpression string
+
+// Returns the value as an HCL expression.
+func HCLValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case HCLExpression:
+		return string(v)
+	case string:
+		return HCLString(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		var items []string
+
+		for _, item := range v {
+			items = append(items, HCLValue(item))
+		}
+
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		var items []string
+
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			items = append(items, fmt.Sprintf("%s = %s", HCLString(key), HCLValue(v[key])))
+		}
+
+		return "{ " + strings.Join(items, ", ") + " }"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// Returns the quoted HCL string, the template sequences are escaped.
+func HCLString(value string) string {
+	var buffer bytes.Buffer
+
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+
+	// A string is always encoded.
+	_ = encoder.Encode(value)
+
+	text := strings.TrimSuffix(buffer.String(), "\n")
+	text = strings.ReplaceAll(text, "${", "$${")
+	text = strings.ReplaceAll(text, "%{", "%%{")
+
+	return text
+}
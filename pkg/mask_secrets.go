@@ -0,0 +1,91 @@
+package pkg
+
+import (
+	"fmt"
+	"prism/internal/model"
+	"slices"
+	"strings"
+)
+
+// Text that replaces the values of the secrets in the output.
+const SensitiveMask = "<sensitive>"
+
+// Replaces the values of the secrets in the text, the longer values first.
+func MaskSecrets(text string, secrets []string) string {
+	secrets = slices.Clone(secrets)
+
+	slices.SortFunc(secrets, func(a, b string) int {
+		return len(b) - len(a)
+	})
+
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, SensitiveMask)
+		}
+	}
+
+	return text
+}
+
+// Returns a copy of the job configuration with the values of the secrets masked.
+func MaskConfig(block model.TemplateBlock, secrets []string) model.TemplateBlock {
+	if len(secrets) == 0 {
+		return block
+	}
+
+	masked := model.TemplateBlock{
+		Type:  block.Type,
+		Label: MaskSecrets(block.Label, secrets),
+	}
+
+	for _, item := range block.Parameter {
+		parameter := make(map[string]interface{}, len(item))
+
+		for key, value := range item {
+			parameter[key] = maskValue(value, secrets)
+		}
+
+		masked.Parameter = append(masked.Parameter, parameter)
+	}
+
+	for _, nested := range block.Block {
+		masked.Block = append(masked.Block, MaskConfig(nested, secrets))
+	}
+
+	return masked
+}
+
+// Returns a copy of the parameter value with the values of the secrets masked.
+// A value of another type is masked if it is equal to a secret.
+func maskValue(value interface{}, secrets []string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return MaskSecrets(v, secrets)
+	case HCLExpression:
+		return HCLExpression(MaskSecrets(string(v), secrets))
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+
+		for _, element := range v {
+			list = append(list, maskValue(element, secrets))
+		}
+
+		return list
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(v))
+
+		for key, element := range v {
+			values[key] = maskValue(element, secrets)
+		}
+
+		return values
+	case nil:
+		return v
+	}
+
+	if slices.Contains(secrets, fmt.Sprint(value)) {
+		return SensitiveMask
+	}
+
+	return value
+}